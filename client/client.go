@@ -2,8 +2,10 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 )
 
@@ -14,6 +16,33 @@ type Message struct {
 	Attributes  map[string]string `json:"attributes"`
 	AckID       string            `json:"-"`
 	PublishTime time.Time         `json:"publish_time"`
+
+	// doneFunc is set by Receive, called once by Ack or Nack
+	doneFunc func(msg *Message, ack bool)
+	doneOnce sync.Once
+}
+
+func (m *Message) setDone(fn func(msg *Message, ack bool)) {
+	m.doneFunc = fn
+}
+
+// Ack acknowledges the message received by Receive, the message is not redelivered.
+// Ack and Nack after the first call are ignored.
+func (m *Message) Ack() {
+	m.done(true)
+}
+
+// Nack releases the message received by Receive, the message is redelivered immediately
+func (m *Message) Nack() {
+	m.done(false)
+}
+
+func (m *Message) done(ack bool) {
+	m.doneOnce.Do(func() {
+		if m.doneFunc != nil {
+			m.doneFunc(m, ack)
+		}
+	})
 }
 
 // PublishMessage represent format of publish message
@@ -34,17 +63,42 @@ type Client struct {
 	s service
 }
 
+// ClientOption is optional parameter for the NewClient
+type ClientOption func(*clientSettings)
+
+type clientSettings struct {
+	tlsConfig *tls.Config
+}
+
+// WithTLSConfig specify the TLS config used to connect the server.
+// set Certificates to authenticate by the client certificate.
+func WithTLSConfig(cfg *tls.Config) ClientOption {
+	return func(s *clientSettings) {
+		s.tlsConfig = cfg
+	}
+}
+
 // NewClient returns a new pubsub client
-func NewClient(ctx context.Context, addr string) (*Client, error) {
+func NewClient(ctx context.Context, addr string, opts ...ClientOption) (*Client, error) {
 	if addr[len(addr)-1] != '/' {
 		addr = addr + "/"
 	}
 	if _, err := url.Parse(addr); err != nil {
 		return nil, err
 	}
+	settings := &clientSettings{}
+	for _, opt := range opts {
+		opt(settings)
+	}
 
 	// TODO: enable to designate any client
 	httpClient := http.Client{}
+	if settings.tlsConfig != nil {
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: settings.tlsConfig,
+		}
+	}
 	return &Client{
 		s: &restService{
 			publisher: &restPublisher{
@@ -55,6 +109,10 @@ func NewClient(ctx context.Context, addr string) (*Client, error) {
 				serverURL:  addr + "subscription/",
 				httpClient: httpClient,
 			},
+			schema: &restSchema{
+				serverURL:  addr + "schema/",
+				httpClient: httpClient,
+			},
 			monitoring: &restMonitoring{
 				serverURL:  addr + "stats/",
 				httpClient: httpClient,
@@ -65,7 +123,12 @@ func NewClient(ctx context.Context, addr string) (*Client, error) {
 
 // CreateTopic creates new Topic
 func (c *Client) CreateTopic(ctx context.Context, id string) (*Topic, error) {
-	err := c.s.createTopic(ctx, id)
+	return c.CreateTopicWithConfig(ctx, id, nil)
+}
+
+// CreateTopicWithConfig creates new Topic with the labels and the description
+func (c *Client) CreateTopicWithConfig(ctx context.Context, id string, cfg *TopicConfig) (*Topic, error) {
+	err := c.s.createTopic(ctx, id, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -78,17 +141,17 @@ func (c *Client) Topic(id string) *Topic {
 	return newTopic(id, c.s)
 }
 
-// Topics returns existing the topic list
-func (c *Client) Topics(ctx context.Context) ([]*Topic, error) {
-	ids, err := c.s.listTopics(ctx)
-	if err != nil {
-		return nil, err
-	}
-	topics := []*Topic{}
-	for _, id := range ids {
-		topics = append(topics, newTopic(id, c.s))
+// Topics returns iterator over the existing topics.
+// the iterator fetch the topics page by page.
+func (c *Client) Topics(ctx context.Context, opts ...ListOption) *TopicIterator {
+	return &TopicIterator{
+		it: &nameIterator{
+			ctx:   ctx,
+			q:     newListQuery(opts),
+			fetch: c.s.listTopics,
+		},
+		s: c.s,
 	}
-	return topics, nil
 }
 
 // CreateSubscription creates new Subscription
@@ -106,17 +169,17 @@ func (c *Client) Subscription(id string) *Subscription {
 	return newSubscription(id, c.s)
 }
 
-// Subscriptions returns all existing the subscription list
-func (c *Client) Subscriptions(ctx context.Context) ([]*Subscription, error) {
-	ids, err := c.s.listSubscriptions(ctx)
-	if err != nil {
-		return nil, err
-	}
-	subscriptions := []*Subscription{}
-	for _, id := range ids {
-		subscriptions = append(subscriptions, newSubscription(id, c.s))
+// Subscriptions returns iterator over the existing subscriptions.
+// the iterator fetch the subscriptions page by page.
+func (c *Client) Subscriptions(ctx context.Context, opts ...ListOption) *SubscriptionIterator {
+	return &SubscriptionIterator{
+		it: &nameIterator{
+			ctx:   ctx,
+			q:     newListQuery(opts),
+			fetch: c.s.listSubscriptions,
+		},
+		s: c.s,
 	}
-	return subscriptions, nil
 }
 
 // Stats returns stats summary
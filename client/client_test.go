@@ -2,11 +2,16 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -76,6 +81,34 @@ func publishMessages(t *testing.T, topic *Topic, msgs []*Message) []string {
 	return msgIDs
 }
 
+func allTopics(t *testing.T, it *TopicIterator) []*Topic {
+	topics := []*Topic{}
+	for {
+		topic, err := it.Next()
+		if err == Done {
+			return topics
+		}
+		if err != nil {
+			t.Fatalf("failed to iterate topics, error=%v", err)
+		}
+		topics = append(topics, topic)
+	}
+}
+
+func allSubscriptions(t *testing.T, it *SubscriptionIterator) []*Subscription {
+	subs := []*Subscription{}
+	for {
+		sub, err := it.Next()
+		if err == Done {
+			return subs
+		}
+		if err != nil {
+			t.Fatalf("failed to iterate subscriptions, error=%v", err)
+		}
+		subs = append(subs, sub)
+	}
+}
+
 func TestCreateTopic(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -112,6 +145,232 @@ func TestCreateTopic(t *testing.T) {
 	}
 }
 
+func TestTopicConfig(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("failed to NewClient, error=%v", err)
+	}
+	topic, err := client.CreateTopicWithConfig(ctx, "a", &TopicConfig{
+		Labels:      map[string]string{"env": "dev"},
+		Description: "first",
+	})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if _, err := client.CreateTopic(ctx, "b"); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+
+	second := "second"
+	cases := []struct {
+		input  *TopicConfigToUpdate
+		expect *TopicConfig
+	}{
+		{
+			nil,
+			&TopicConfig{Labels: map[string]string{"env": "dev"}, Description: "first"},
+		},
+		{
+			&TopicConfigToUpdate{Description: &second},
+			&TopicConfig{Labels: map[string]string{"env": "dev"}, Description: "second"},
+		},
+		{
+			&TopicConfigToUpdate{Labels: map[string]string{}},
+			&TopicConfig{Description: "second"},
+		},
+	}
+	for i, c := range cases {
+		if c.input != nil {
+			if _, err := topic.Update(ctx, *c.input); err != nil {
+				t.Fatalf("#%d: want non error, got %v", i, err)
+			}
+		}
+		cfg, err := topic.Config(ctx)
+		if err != nil {
+			t.Fatalf("#%d: want non error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(cfg, c.expect) {
+			t.Errorf("#%d: want %#v, got %#v", i, c.expect, cfg)
+		}
+	}
+
+	// filter by the label
+	if _, err := topic.Update(ctx, TopicConfigToUpdate{Labels: map[string]string{"env": "prod"}}); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	expect := []*Topic{client.Topic("a")}
+	if got := allTopics(t, client.Topics(ctx, WithLabel("env:prod"))); !reflect.DeepEqual(got, expect) {
+		t.Errorf("want %v, got %v", expect, got)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("failed to NewClient, error=%v", err)
+	}
+
+	if _, err := client.CreateSchema(ctx, "s", SchemaConfig{Type: SchemaAvro, Definition: `"unknown"`}); !errors.Is(err, ErrInvalidArgument) {
+		t.Fatalf("want %v, got %v", ErrInvalidArgument, err)
+	}
+	schema, err := client.CreateSchema(ctx, "s", SchemaConfig{
+		Type:       SchemaAvro,
+		Definition: `{"type": "record", "name": "A", "fields": [{"name": "id", "type": "long"}]}`,
+	})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if schema.RevisionID != "1" {
+		t.Errorf("want revision 1, got %s", schema.RevisionID)
+	}
+	if _, err := client.CommitSchema(ctx, "s", `{"type": "record", "name": "A", "fields": [{"name": "id", "type": "string"}]}`); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if got, err := client.Schema(ctx, "s"); err != nil || got.RevisionID != "2" {
+		t.Errorf("want revision 2, got %v, %v", got, err)
+	}
+	if got, err := client.SchemaRevision(ctx, "s", "1"); err != nil || got.Definition != schema.Definition {
+		t.Errorf("want first revision, got %v, %v", got, err)
+	}
+
+	settings := &SchemaSettings{Schema: "s", Encoding: EncodingJSON}
+	topic, err := client.CreateTopicWithConfig(ctx, "a", &TopicConfig{SchemaSettings: settings})
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if cfg, err := topic.Config(ctx); err != nil || !reflect.DeepEqual(cfg.SchemaSettings, settings) {
+		t.Errorf("want %v, got %v, %v", settings, cfg, err)
+	}
+
+	// rejected by the schema
+	_, err = topic.Publish(ctx, &Message{Data: []byte(`{"id": 1}`)}).Get(ctx)
+	if !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("want %v, got %v", ErrSchemaViolation, err)
+	}
+	var detail *ErrorDetail
+	if !errors.As(err, &detail) || detail.Index != 0 {
+		t.Errorf("want a detail of the message 0, got %#v", err)
+	}
+	if _, err := topic.Publish(ctx, &Message{Data: []byte(`{"id": "1"}`)}).Get(ctx); err != nil {
+		t.Errorf("want non error, got %v", err)
+	}
+
+	// the rejected message does not fail the other message in the same bundle
+	topic.PublishSettings = PublishSettings{CountThreshold: 2, DelayThreshold: time.Second}
+	valid := topic.Publish(ctx, &Message{Data: []byte(`{"id": "2"}`)})
+	invalid := topic.Publish(ctx, &Message{Data: []byte(`{"id": 2}`)})
+	if id, err := valid.Get(ctx); err != nil || len(id) == 0 {
+		t.Errorf("want message id, got %q, %v", id, err)
+	}
+	if _, err := invalid.Get(ctx); !errors.Is(err, ErrSchemaViolation) || !errors.As(err, &detail) || detail.Index != 1 {
+		t.Errorf("want %v of the message 1, got %v", ErrSchemaViolation, err)
+	}
+
+	// in use by the topic
+	if err := client.DeleteSchema(ctx, "s"); !errors.Is(err, ErrFailedPrecondition) {
+		t.Errorf("want %v, got %v", ErrFailedPrecondition, err)
+	}
+	if _, err := topic.Update(ctx, TopicConfigToUpdate{SchemaSettings: &SchemaSettings{}}); err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	if err := client.DeleteSchema(ctx, "s"); err != nil {
+		t.Errorf("want non error, got %v", err)
+	}
+}
+
+func TestNewClientWithTLSConfig(t *testing.T) {
+	s, err := server.NewServer("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("failed to server.NewServer, error=%v", err)
+	}
+	if err := s.PrepareServer(); err != nil {
+		t.Fatalf("failed to PrepareServer, error=%v", err)
+	}
+	ts := httptest.NewTLSServer(server.Routes())
+	defer ts.Close()
+
+	ctx := context.Background()
+	roots := x509.NewCertPool()
+	roots.AddCert(ts.Certificate())
+	cases := []struct {
+		opts      []ClientOption
+		expectErr bool
+	}{
+		{[]ClientOption{WithTLSConfig(&tls.Config{RootCAs: roots})}, false},
+		{nil, true}, // unknown authority
+	}
+	for i, c := range cases {
+		client, err := NewClient(ctx, ts.URL, c.opts...)
+		if err != nil {
+			t.Fatalf("#%d: failed to NewClient, error=%v", i, err)
+		}
+		_, err = client.CreateTopic(ctx, fmt.Sprintf("tls-%d", i))
+		if (err != nil) != c.expectErr {
+			t.Errorf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("failed to NewClient, error=%v", err)
+	}
+
+	cases := []struct {
+		call         func() error
+		expectStatus int
+		expectErr    error
+	}{
+		{
+			func() error {
+				_, err := client.CreateTopic(ctx, "topic1")
+				return err
+			},
+			409, ErrAlreadyExists,
+		},
+		{
+			func() error {
+				return client.Topic("unknown").Delete(ctx)
+			},
+			404, ErrNotFound,
+		},
+		{
+			func() error {
+				_, err := client.CreateSubscription(ctx, "sub", SubscriptionConfig{
+					Topic:      client.Topic("unknown"),
+					AckTimeout: time.Second,
+				})
+				return err
+			},
+			404, ErrNotFound,
+		},
+	}
+	for i, c := range cases {
+		err := c.call()
+		if !errors.Is(err, c.expectErr) {
+			t.Errorf("#%d: want error %v, got %v", i, c.expectErr, err)
+		}
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("#%d: want APIError, got %T", i, err)
+		}
+		if apiErr.StatusCode != c.expectStatus {
+			t.Errorf("#%d: want status %d, got %d", i, c.expectStatus, apiErr.StatusCode)
+		}
+	}
+}
+
 func TestCreateSubscription(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -153,10 +412,7 @@ func TestCreateSubscription(t *testing.T) {
 			t.Fatalf("#%d: want exists, but not exists", i)
 		}
 
-		subs, err := c.inputCfg.Topic.Subscriptions(ctx)
-		if err != nil {
-			t.Fatalf("#%d: want non error, got %v", i, err)
-		}
+		subs := allSubscriptions(t, c.inputCfg.Topic.Subscriptions(ctx))
 		contain := false
 		for _, s := range subs {
 			if s.ID == sub.ID {
@@ -199,11 +455,8 @@ func TestListTopics(t *testing.T) {
 			}
 		}
 
-		topics, err := client.Topics(ctx)
+		topics := allTopics(t, client.Topics(ctx, WithPageSize(1)))
 		sort.Sort(ByTopicID(topics))
-		if err != nil {
-			t.Fatalf("#%d: want non error, got %v", i, err)
-		}
 		if !reflect.DeepEqual(topics, c.expect) {
 			t.Errorf("#%d: want topic list %v, got %v", i, c.expect, topics)
 		}
@@ -250,21 +503,15 @@ func TestListSubscription(t *testing.T) {
 		}
 
 		// check all subscriptions
-		subs, err := client.Subscriptions(ctx)
+		subs := allSubscriptions(t, client.Subscriptions(ctx, WithPageSize(1)))
 		sort.Sort(BySubscriptionID(subs))
-		if err != nil {
-			t.Fatalf("#%d: want non error, got %v", i, err)
-		}
 		if !reflect.DeepEqual(subs, c.expectAll) {
 			t.Errorf("#%d: want Subscription list %v, got %v", i, c.expectAll, subs)
 		}
 
 		// check subscriptions in the topic
-		subs, err = client.Topic(c.inputTopic).Subscriptions(ctx)
+		subs = allSubscriptions(t, client.Topic(c.inputTopic).Subscriptions(ctx, WithPageSize(1)))
 		sort.Sort(BySubscriptionID(subs))
-		if err != nil {
-			t.Fatalf("#%d: want non error, got %v", i, err)
-		}
 		if !reflect.DeepEqual(subs, c.expectInTopic) {
 			t.Errorf("#%d: want topic list %v, got %v", i, c.expectInTopic, subs)
 		}
@@ -292,10 +539,7 @@ func TestDeleteTopic(t *testing.T) {
 	expect := []*Topic{
 		client.Topic("topic2"),
 	}
-	topics, err := client.Topics(ctx)
-	if err != nil {
-		t.Fatalf("want non error, got %v", err)
-	}
+	topics := allTopics(t, client.Topics(ctx))
 	if !reflect.DeepEqual(expect, topics) {
 		t.Errorf("want topic list %v, got %v", expect, topics)
 	}
@@ -323,10 +567,7 @@ func TestDeleteSubscription(t *testing.T) {
 	expect := []*Subscription{
 		client.Subscription("sub2"),
 	}
-	subs, err := client.Subscriptions(ctx)
-	if err != nil {
-		t.Fatalf("want non error, got %v", err)
-	}
+	subs := allSubscriptions(t, client.Subscriptions(ctx))
 	if !reflect.DeepEqual(expect, subs) {
 		t.Errorf("want subscription list %v, got %v", expect, subs)
 	}
@@ -382,6 +623,217 @@ func TestPublish(t *testing.T) {
 	}
 }
 
+func TestPublishBundle(t *testing.T) {
+	s, err := server.NewServer("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("failed to server.NewServer, error=%v", err)
+	}
+	if err := s.PrepareServer(); err != nil {
+		t.Fatalf("failed to PrepareServer, error=%v", err)
+	}
+	var (
+		mu       sync.Mutex
+		requests int
+	)
+	routes := server.Routes()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/publish") {
+			mu.Lock()
+			requests++
+			mu.Unlock()
+		}
+		routes.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+
+	cases := []struct {
+		settings       PublishSettings
+		inputs         int
+		expectRequests int
+	}{
+		// flushed by the count
+		{PublishSettings{DelayThreshold: time.Hour, CountThreshold: 2}, 5, 3},
+		// flushed by the bytes
+		{PublishSettings{DelayThreshold: time.Hour, ByteThreshold: 8}, 3, 2},
+		// flushed by the delay
+		{PublishSettings{DelayThreshold: 10 * time.Millisecond, CountThreshold: 100}, 3, 1},
+	}
+	for i, c := range cases {
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+
+		topic := client.Topic("topic1")
+		topic.PublishSettings = c.settings
+		results := []*PublishResult{}
+		for mi := 0; mi < c.inputs; mi++ {
+			results = append(results, topic.Publish(ctx, &Message{Data: []byte(fmt.Sprintf("msg%d", mi))}))
+		}
+		if c.settings.DelayThreshold == time.Hour {
+			topic.Flush()
+		}
+		ids := map[string]bool{}
+		for ri, r := range results {
+			id, err := r.Get(ctx)
+			if err != nil {
+				t.Fatalf("#%d-%d: want non-error, got %v", i, ri, err)
+			}
+			ids[id] = true
+		}
+		if len(ids) != c.inputs {
+			t.Errorf("#%d: want %d unique message ids, got %v", i, c.inputs, ids)
+		}
+		mu.Lock()
+		if requests != c.expectRequests {
+			t.Errorf("#%d: want %d requests, got %d", i, c.expectRequests, requests)
+		}
+		mu.Unlock()
+
+		topic.Stop()
+		if _, err := topic.Publish(ctx, &Message{}).Get(ctx); err != ErrTopicStopped {
+			t.Errorf("#%d: want %v, got %v", i, ErrTopicStopped, err)
+		}
+	}
+}
+
+func TestPublishRetryAndFlowControl(t *testing.T) {
+	s, err := server.NewServer("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("failed to server.NewServer, error=%v", err)
+	}
+	if err := s.PrepareServer(); err != nil {
+		t.Fatalf("failed to PrepareServer, error=%v", err)
+	}
+	var (
+		mu       sync.Mutex
+		failures int
+		block    chan struct{}
+	)
+	routes := server.Routes()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/publish") {
+			mu.Lock()
+			fail := failures > 0
+			if fail {
+				failures--
+			}
+			wait := block
+			mu.Unlock()
+			if fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if wait != nil {
+				<-wait
+			}
+		}
+		routes.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+
+	// retried until succeeded
+	topic := client.Topic("topic1")
+	topic.PublishSettings = PublishSettings{CountThreshold: 1, InitialBackoff: time.Millisecond}
+	mu.Lock()
+	failures = 2
+	mu.Unlock()
+	if _, err := topic.Publish(ctx, &Message{Data: []byte(`msg`)}).Get(ctx); err != nil {
+		t.Errorf("want non-error, got %v", err)
+	}
+
+	// timed out while retrying
+	topic = client.Topic("topic1")
+	topic.PublishSettings = PublishSettings{CountThreshold: 1, InitialBackoff: time.Millisecond, Timeout: 50 * time.Millisecond}
+	mu.Lock()
+	failures = 1000
+	mu.Unlock()
+	if _, err := topic.Publish(ctx, &Message{Data: []byte(`msg`)}).Get(ctx); !errors.Is(err, ErrInternal) {
+		t.Errorf("want %v, got %v", ErrInternal, err)
+	}
+	mu.Lock()
+	failures = 0
+	mu.Unlock()
+
+	// not retried by the client error
+	topic = client.Topic("none")
+	topic.PublishSettings = PublishSettings{CountThreshold: 1}
+	if _, err := topic.Publish(ctx, &Message{Data: []byte(`msg`)}).Get(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("want %v, got %v", ErrNotFound, err)
+	}
+
+	cases := []struct {
+		behavior  LimitExceededBehavior
+		expectErr error
+	}{
+		{FlowControlSignalError, ErrFlowControlLimitExceeded},
+		{FlowControlBlock, context.DeadlineExceeded},
+	}
+	for i, c := range cases {
+		mu.Lock()
+		block = make(chan struct{})
+		mu.Unlock()
+
+		topic := client.Topic("topic1")
+		topic.PublishSettings = PublishSettings{
+			CountThreshold:         1,
+			MaxOutstandingMessages: 1,
+			LimitExceededBehavior:  c.behavior,
+		}
+		first := topic.Publish(ctx, &Message{Data: []byte(`msg1`)})
+		timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		_, err := topic.Publish(timeout, &Message{Data: []byte(`msg2`)}).Get(ctx)
+		cancel()
+		if err != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+
+		mu.Lock()
+		close(block)
+		block = nil
+		mu.Unlock()
+		if _, err := first.Get(ctx); err != nil {
+			t.Errorf("#%d: want non-error, got %v", i, err)
+		}
+		if _, err := topic.Publish(ctx, &Message{Data: []byte(`msg3`)}).Get(ctx); err != nil {
+			t.Errorf("#%d: want non-error, got %v", i, err)
+		}
+	}
+}
+
+// receiveOne returns the first received message, the message is not acked
+func receiveOne(t *testing.T, sub *Subscription, timeout time.Duration) *Message {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var (
+		mu       sync.Mutex
+		received *Message
+	)
+	err := sub.Receive(ctx, func(ctx context.Context, msg *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		if received == nil {
+			received = msg
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	return received
+}
+
 func TestReceiveAndAck(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -394,46 +846,163 @@ func TestReceiveAndAck(t *testing.T) {
 	createDummySubscriptions(t, ts, client.Topic("topic1"))
 
 	cases := []struct {
-		inputs []*Message
+		inputs   []*Message
+		settings ReceiveSettings
 	}{
 		{
 			[]*Message{
 				&Message{Data: []byte(`msg1`)},
 				&Message{Data: []byte(`msg2`), Attributes: map[string]string{"msg2": "foo"}},
 			},
+			ReceiveSettings{},
+		},
+		{
+			[]*Message{
+				&Message{Data: []byte(`msg3`)},
+				&Message{Data: []byte(`msg4`)},
+				&Message{Data: []byte(`msg5`)},
+			},
+			ReceiveSettings{MaxOutstandingMessages: 1, NumGoroutines: 2},
 		},
 	}
 	for i, c := range cases {
 		msgIDs := publishMessages(t, client.Topic("topic1"), c.inputs)
 
 		sub := client.Subscription("sub1")
-		ackIDs := []string{}
-		for j := 0; j < len(msgIDs); j++ {
-			err := sub.Receive(ctx, func(ctx context.Context, msg *Message) {
-				// expect: the received message ID exists in recently published messages
-				contain := false
-				for _, pid := range msgIDs {
-					if msg.ID == pid {
-						contain = true
-						break
-					}
-				}
-				if !contain {
-					t.Errorf("#%d: want message id %s contain publish messaged", i, msg.ID)
-				}
-
-				// collect AckID
-				ackIDs = append(ackIDs, msg.AckID)
-			})
-			if err != nil {
-				t.Fatalf("#%d: want non-error, got %v", i, err)
+		sub.ReceiveSettings = c.settings
+		rctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		var (
+			mu       sync.Mutex
+			received = map[string]bool{}
+			running  int
+		)
+		err := sub.Receive(rctx, func(ctx context.Context, msg *Message) {
+			mu.Lock()
+			running++
+			if max := c.settings.MaxOutstandingMessages; max > 0 && running > max {
+				t.Errorf("#%d: want concurrency up to %d, got %d", i, max, running)
 			}
-		}
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+			msg.Ack()
 
-		err := sub.Ack(ctx, ackIDs)
+			mu.Lock()
+			defer mu.Unlock()
+			running--
+			received[msg.ID] = true
+			if len(received) == len(msgIDs) {
+				cancel()
+			}
+		})
+		cancel()
 		if err != nil {
 			t.Fatalf("#%d: want non-error, got %v", i, err)
 		}
+		for _, id := range msgIDs {
+			if !received[id] {
+				t.Errorf("#%d: want message id %s received, got %v", i, id, received)
+			}
+		}
+
+		// acked messages are not redelivered
+		if msg := receiveOne(t, sub, 300*time.Millisecond); msg != nil {
+			t.Errorf("#%d: want no message, got %v", i, msg)
+		}
+	}
+}
+
+func TestReceiveExtendAndNack(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", SubscriptionConfig{
+		Topic:      client.Topic("topic1"),
+		AckTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+
+	// the message holds over the ack deadline is not redelivered, and redelivered after Nack
+	sub.ReceiveSettings = ReceiveSettings{NumGoroutines: 2}
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var (
+		mu         sync.Mutex
+		deliveries int
+	)
+	err = sub.Receive(rctx, func(ctx context.Context, msg *Message) {
+		mu.Lock()
+		deliveries++
+		n := deliveries
+		mu.Unlock()
+		switch n {
+		case 1:
+			time.Sleep(2500 * time.Millisecond)
+			msg.Nack()
+		default:
+			msg.Ack()
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	if deliveries != 2 {
+		t.Errorf("want 2 deliveries, got %d", deliveries)
+	}
+}
+
+func TestReceiveCancelPull(t *testing.T) {
+	s, err := server.NewServer("testdata/config.yaml")
+	if err != nil {
+		t.Fatalf("failed to server.NewServer, error=%v", err)
+	}
+	if err := s.PrepareServer(); err != nil {
+		t.Fatalf("failed to PrepareServer, error=%v", err)
+	}
+	ctx := context.Background()
+	rctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	routes := server.Routes()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the pull is served after Receive is cancelled
+		if strings.HasSuffix(r.URL.Path, "/pull") {
+			<-rctx.Done()
+		}
+		routes.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
+
+	// the in-flight pull finishes, and the messages leased by it are nacked
+	sub := client.Subscription("sub1")
+	err = sub.Receive(rctx, func(ctx context.Context, msg *Message) {
+		t.Errorf("want no message after cancelled, got %v", msg)
+		msg.Ack()
+	})
+	if err != nil {
+		t.Errorf("want non-error, got %v", err)
+	}
+	msg := receiveOne(t, sub, time.Second)
+	if msg == nil {
+		t.Fatalf("want nacked message, got nil")
+	}
+	if err := sub.Ack(ctx, []string{msg.AckID}); err != nil {
+		t.Errorf("want non error, got %v", err)
 	}
 }
 
@@ -458,9 +1027,8 @@ func TestAckAndNack(t *testing.T) {
 					t.Errorf("want non error, got %v", err)
 				}
 				// expect can't pull message after the Ack
-				err = sub.Receive(ctx, func(ctx context.Context, msg *Message) {})
-				if err != ErrNotFoundMessage {
-					t.Errorf("want error %v, got %v", ErrNotFoundMessage, err)
+				if msg := receiveOne(t, sub, 300*time.Millisecond); msg != nil {
+					t.Errorf("want no message, got %v", msg)
 				}
 			},
 		},
@@ -470,17 +1038,33 @@ func TestAckAndNack(t *testing.T) {
 				if err != nil {
 					t.Errorf("want non error, got %v", err)
 				}
-				// expect can't pull message after the Ack
-				err = sub.Receive(ctx, func(ctx context.Context, msg *Message) {})
-				if err != nil {
-					t.Errorf("want non error, got %v", err)
+				// expect can pull message after the Nack
+				if msg := receiveOne(t, sub, time.Second); msg == nil {
+					t.Errorf("want message, got nil")
+				}
+			},
+		},
+		{
+			func(sub *Subscription, ackIDs []string) {
+				// the unknown ack id does not abort the valid ack id
+				err := sub.Ack(ctx, append(ackIDs, "unknown"))
+				var batchErr *BatchError
+				if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 {
+					t.Fatalf("want BatchError, got %v", err)
+				}
+				if batchErr.Errors[0] != nil || !errors.Is(batchErr.Errors[1], ErrNotFound) {
+					t.Errorf("want errors [nil, not found], got %v", batchErr.Errors)
+				}
+				if msg := receiveOne(t, sub, 300*time.Millisecond); msg != nil {
+					t.Errorf("want no message, got %v", msg)
 				}
 			},
 		},
 	}
 	for i, c := range cases {
 		sub, err := client.CreateSubscription(ctx, fmt.Sprintf("sub-%d", i), SubscriptionConfig{
-			Topic: client.Topic("topic1"),
+			Topic:      client.Topic("topic1"),
+			AckTimeout: 10 * time.Second,
 		})
 		if err != nil {
 			t.Fatalf("#%d: want non error, got %v", i, err)
@@ -488,12 +1072,77 @@ func TestAckAndNack(t *testing.T) {
 
 		// publish and receive one message
 		publishMessages(t, client.Topic("topic1"), []*Message{&Message{Data: []byte(`msg1`)}})
-		var ackIDs []string
-		sub.Receive(ctx, func(ctx context.Context, msg *Message) {
-			ackIDs = []string{msg.AckID}
-		})
+		msg := receiveOne(t, sub, time.Second)
+		if msg == nil {
+			t.Fatalf("#%d: want message, got nil", i)
+		}
 
-		c.fn(sub, ackIDs)
+		c.fn(sub, []string{msg.AckID})
+	}
+}
+
+func TestDetachSubscription(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	publishDummyMessage(t, client.Topic("topic1"))
+
+	sub := client.Subscription("sub1")
+	if err := sub.Detach(ctx); err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	cfg, err := sub.Config(ctx)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	if !cfg.Detached {
+		t.Errorf("want detached, got %v", cfg)
+	}
+	err = sub.Receive(ctx, func(ctx context.Context, msg *Message) {
+		t.Errorf("want no message, got %v", msg)
+	})
+	if !errors.Is(err, ErrFailedPrecondition) {
+		t.Errorf("want %v, got %v", ErrFailedPrecondition, err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummyTopics(t, ts)
+	ctx := context.Background()
+	client, err := NewClient(ctx, ts.URL)
+	if err != nil {
+		t.Fatalf("want non-error, got %v", err)
+	}
+	createDummySubscriptions(t, ts, client.Topic("topic1"))
+	publishDummyMessage(t, client.Topic("topic1"))
+
+	sub := client.Subscription("sub1")
+	cases := []struct {
+		input  time.Time
+		expect int
+	}{
+		{time.Now().Add(-time.Hour), 0},
+		{time.Time{}, 2},
+	}
+	for i, c := range cases {
+		n, err := sub.Purge(ctx, c.input)
+		if err != nil {
+			t.Fatalf("#%d: want non-error, got %v", i, err)
+		}
+		if n != c.expect {
+			t.Errorf("#%d: want %d, got %d", i, c.expect, n)
+		}
+	}
+	if msg := receiveOne(t, sub, 300*time.Millisecond); msg != nil {
+		t.Errorf("want no message, got %v", msg)
 	}
 }
 
@@ -517,8 +1166,23 @@ func TestConfigUpdateSubscription(t *testing.T) {
 	toUpdate := &PushConfig{
 		Endpoint:   ts.URL,
 		Attributes: map[string]string{"a": "b"},
+		Format:     PushFormatBatch,
+
+		MaxConcurrency: 2,
+		BatchSize:      10,
+		Timeout:        5 * time.Second,
 	}
-	err = sub.Update(ctx, &SubscriptionConfigToUpdate{PushConfig: toUpdate})
+	desc := "updated"
+	retention := time.Hour
+	filter := `attributes:env`
+	err = sub.Update(ctx, &SubscriptionConfigToUpdate{
+		PushConfig:        toUpdate,
+		AckTimeout:        30 * time.Second,
+		RetentionDuration: &retention,
+		Filter:            &filter,
+		Labels:            map[string]string{"env": "dev"},
+		Description:       &desc,
+	})
 	if err != nil {
 		t.Fatalf("want non-error, got %v", err)
 	}
@@ -530,8 +1194,17 @@ func TestConfigUpdateSubscription(t *testing.T) {
 	if reflect.DeepEqual(originConf, updatedConf) {
 		t.Errorf("want differ config from in before and after update")
 	}
+	if !reflect.DeepEqual(toUpdate, updatedConf.PushConfig) {
+		t.Errorf("want push config %v, got %v", toUpdate, updatedConf.PushConfig)
+	}
 	expectUpdateConf := originConf
 	expectUpdateConf.PushConfig = updatedConf.PushConfig
+	expectUpdateConf.PushHealth = updatedConf.PushHealth
+	expectUpdateConf.AckTimeout = 30 * time.Second
+	expectUpdateConf.RetentionDuration = retention
+	expectUpdateConf.Filter = filter
+	expectUpdateConf.Labels = map[string]string{"env": "dev"}
+	expectUpdateConf.Description = desc
 	if !reflect.DeepEqual(expectUpdateConf, updatedConf) {
 		t.Errorf("want update config %v, got %v", expectUpdateConf, updatedConf)
 	}
@@ -592,6 +1265,7 @@ func TestStatsSubscriptionDetail(t *testing.T) {
 	createDummyTopics(t, ts)
 	createDummySubscriptions(t, ts, client.Topic("topic1"))
 	msgIDs := publishDummyMessage(t, client.Topic("topic1"))
+	sort.Strings(msgIDs)
 
 	expect := []byte(fmt.Sprintf("\"subscription.sub1.current_messages\":[\"%s\",\"%s\"]", msgIDs[0], msgIDs[1]))
 	payload, err := client.Subscription("sub1").StatsDetail(ctx)
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// Errors corresponding to the error code from the server.
+// APIError matches these errors with errors.Is.
+var (
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrInternal         = errors.New("internal server error")
+
+	// ErrFailedPrecondition represent the resource is not in the state required for the operation
+	ErrFailedPrecondition = errors.New("failed precondition")
+
+	// ErrSchemaViolation represent the published message does not conform to the schema of the topic,
+	// PublishResult.Get returns *ErrorDetail of the message
+	ErrSchemaViolation = errors.New("schema violation")
+
+	// ErrRequestTooLarge represent the request body exceeds the limit of the server
+	ErrRequestTooLarge = errors.New("request too large")
+
+	// ErrLimitExceeded represent the published message exceeds the size limits of the server,
+	// PublishResult.Get returns *ErrorDetail of the message
+	ErrLimitExceeded = errors.New("limit exceeded")
+
+	// ErrNotFoundMessage represent currently not exist message on the subscription server
+	ErrNotFoundMessage = errors.New("not found message")
+)
+
+// codeErrors is mapping from the error code to the error
+var codeErrors = map[string]error{
+	"invalid_argument":    ErrInvalidArgument,
+	"unauthenticated":     ErrUnauthenticated,
+	"permission_denied":   ErrPermissionDenied,
+	"not_found":           ErrNotFound,
+	"already_exists":      ErrAlreadyExists,
+	"empty_message":       ErrNotFoundMessage,
+	"failed_precondition": ErrFailedPrecondition,
+	"schema_violation":    ErrSchemaViolation,
+	"request_too_large":   ErrRequestTooLarge,
+	"limit_exceeded":      ErrLimitExceeded,
+	"internal":            ErrInternal,
+}
+
+// statusErrors is used when the response has no error code
+var statusErrors = map[int]string{
+	http.StatusBadRequest:   "invalid_argument",
+	http.StatusUnauthorized: "unauthenticated",
+	http.StatusForbidden:    "permission_denied",
+	http.StatusNotFound:     "not_found",
+	http.StatusConflict:     "already_exists",
+
+	http.StatusRequestEntityTooLarge: "request_too_large",
+}
+
+// APIError represent the error response from the server
+type APIError struct {
+	StatusCode int           `json:"-"`
+	Code       string        `json:"code"`
+	Reason     string        `json:"reason"`
+	Details    []ErrorDetail `json:"details,omitempty"`
+}
+
+// ErrorDetail represent the error of the each item in the request, e.g. the messages of the publish
+type ErrorDetail struct {
+	Index  int    `json:"index"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+func (e *ErrorDetail) Error() string {
+	return fmt.Sprintf("item %d error: code %s, reason %s", e.Index, e.Code, e.Reason)
+}
+
+// Is reports whether the error code corresponds to the target
+func (e *ErrorDetail) Is(target error) bool {
+	err, ok := codeErrors[e.Code]
+	return ok && err == target
+}
+
+// BatchError represent the partial failure of the batch request, e.g. the publish or the ack.
+// Errors are the same order as the items of the request, nil for the succeeded item and *ErrorDetail for the failed item.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d items failed", failed, len(e.Errors))
+}
+
+// newBatchError returns BatchError when any item failed, returns nil when the all items succeeded
+func newBatchError(size int, details []ErrorDetail) error {
+	if len(details) == 0 {
+		return nil
+	}
+	e := &BatchError{Errors: make([]error, size)}
+	for i := range details {
+		if d := &details[i]; d.Index >= 0 && d.Index < size {
+			e.Errors[d.Index] = d
+		}
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("HTTP response error: status code %d, code %s, reason %s", e.StatusCode, e.Code, e.Reason)
+}
+
+// Is reports whether the error code corresponds to the target
+func (e *APIError) Is(target error) bool {
+	err, ok := codeErrors[e.Code]
+	return ok && err == target
+}
+
+// retryableStatus is the HTTP status codes which the request may succeed by the retry
+var retryableStatus = map[int]bool{
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// isRetryable returns whether the error is temporary, the transport errors are retryable
+func isRetryable(err error) bool {
+	switch e := errors.Cause(err).(type) {
+	case *APIError:
+		return retryableStatus[e.StatusCode]
+	case *url.Error:
+		return e.Err != context.Canceled && e.Err != context.DeadlineExceeded
+	default:
+		return false
+	}
+}
+
+// decodeAPIError returns APIError from the error response
+func decodeAPIError(res *http.Response) error {
+	e := &APIError{StatusCode: res.StatusCode}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read error response, status code %d", res.StatusCode)
+	}
+	if err := json.Unmarshal(body, e); err != nil || len(e.Code) == 0 {
+		e.Reason = string(body)
+		e.Code = "internal"
+		if code, ok := statusErrors[res.StatusCode]; ok {
+			e.Code = code
+		}
+	}
+	return e
+}
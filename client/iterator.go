@@ -0,0 +1,148 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Done is returned by the iterator's Next method when no more items
+var Done = errors.New("no more items in iterator")
+
+// defaultPageSize is number of the items fetched by one request
+const defaultPageSize = 100
+
+// ListOption is optional parameter for the list methods
+type ListOption func(*listQuery)
+
+// WithPageSize specify number of the items fetched by one request
+func WithPageSize(size int) ListOption {
+	return func(q *listQuery) {
+		q.pageSize = size
+	}
+}
+
+// WithPrefix filters the items by the name prefix
+func WithPrefix(prefix string) ListOption {
+	return func(q *listQuery) {
+		q.prefix = prefix
+	}
+}
+
+// WithLabel filters the items by the label selector.
+// the selector is "key" to require the label, or "key:value" to require the value.
+func WithLabel(selector string) ListOption {
+	return func(q *listQuery) {
+		q.labels = append(q.labels, selector)
+	}
+}
+
+// WithOrderBy specify the sort order, "name" or "name desc"
+func WithOrderBy(orderBy string) ListOption {
+	return func(q *listQuery) {
+		q.orderBy = orderBy
+	}
+}
+
+// listQuery represent query parameters of the list API
+type listQuery struct {
+	pageSize  int
+	pageToken string
+	prefix    string
+	labels    []string
+	orderBy   string
+}
+
+func newListQuery(opts []ListOption) listQuery {
+	q := listQuery{pageSize: defaultPageSize}
+	for _, opt := range opts {
+		opt(&q)
+	}
+	return q
+}
+
+// encode returns query string with "?" prefix
+func (q listQuery) encode() string {
+	v := url.Values{}
+	if q.pageSize > 0 {
+		v.Set("page_size", strconv.Itoa(q.pageSize))
+	}
+	if len(q.pageToken) != 0 {
+		v.Set("page_token", q.pageToken)
+	}
+	if len(q.prefix) != 0 {
+		v.Set("prefix", q.prefix)
+	}
+	for _, l := range q.labels {
+		v.Add("label", l)
+	}
+	if len(q.orderBy) != 0 {
+		v.Set("order_by", q.orderBy)
+	}
+	if len(v) == 0 {
+		return ""
+	}
+	return "?" + v.Encode()
+}
+
+// fetchFunc returns names in the page and the next page token
+type fetchFunc func(ctx context.Context, q listQuery) ([]string, string, error)
+
+// nameIterator fetch next page when consumed the current page
+type nameIterator struct {
+	ctx   context.Context
+	q     listQuery
+	fetch fetchFunc
+	names []string
+	done  bool
+}
+
+func (it *nameIterator) next() (string, error) {
+	for len(it.names) == 0 {
+		if it.done {
+			return "", Done
+		}
+		names, token, err := it.fetch(it.ctx, it.q)
+		if err != nil {
+			return "", err
+		}
+		it.names = names
+		it.q.pageToken = token
+		it.done = len(token) == 0
+	}
+	name := it.names[0]
+	it.names = it.names[1:]
+	return name, nil
+}
+
+// TopicIterator is an iterator over the topics
+type TopicIterator struct {
+	it *nameIterator
+	s  service
+}
+
+// Next returns next topic. returns Done when no more topics
+func (t *TopicIterator) Next() (*Topic, error) {
+	id, err := t.it.next()
+	if err != nil {
+		return nil, err
+	}
+	return newTopic(id, t.s), nil
+}
+
+// SubscriptionIterator is an iterator over the subscriptions
+type SubscriptionIterator struct {
+	it *nameIterator
+	s  service
+}
+
+// Next returns next subscription. returns Done when no more subscriptions
+func (s *SubscriptionIterator) Next() (*Subscription, error) {
+	id, err := s.it.next()
+	if err != nil {
+		return nil, err
+	}
+	return newSubscription(id, s.s), nil
+}
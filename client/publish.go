@@ -0,0 +1,331 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// publish errors
+var (
+	// ErrTopicStopped represent Publish is called after Topic.Stop
+	ErrTopicStopped = errors.New("topic has been stopped")
+
+	// ErrFlowControlLimitExceeded represent the outstanding messages exceed the limit of the PublishSettings
+	ErrFlowControlLimitExceeded = errors.New("flow control limit exceeded")
+)
+
+// LimitExceededBehavior is the behavior of Publish when the outstanding messages exceed the limit
+type LimitExceededBehavior int
+
+const (
+	// FlowControlBlock blocks Publish until the outstanding messages are done or the context is done
+	FlowControlBlock LimitExceededBehavior = iota
+	// FlowControlSignalError returns ErrFlowControlLimitExceeded from PublishResult.Get
+	FlowControlSignalError
+)
+
+// PublishSettings control the bundling, the flow control and the retry of the published messages.
+// the bundle is sent to the server when any threshold is reached.
+type PublishSettings struct {
+	// DelayThreshold is the maximum time to wait before sending the bundle
+	DelayThreshold time.Duration
+
+	// CountThreshold is the maximum number of the messages in the bundle
+	CountThreshold int
+
+	// ByteThreshold is the maximum total bytes of the message data in the bundle
+	ByteThreshold int
+
+	// MaxOutstandingMessages is the maximum number of the messages published and not yet done.
+	// negative value disables the limit.
+	MaxOutstandingMessages int
+
+	// MaxOutstandingBytes is the maximum total bytes of the messages published and not yet done.
+	// negative value disables the limit.
+	MaxOutstandingBytes int
+
+	// LimitExceededBehavior is the behavior when the outstanding limits are exceeded
+	LimitExceededBehavior LimitExceededBehavior
+
+	// Timeout is the maximum time to send the bundle including the retries
+	Timeout time.Duration
+
+	// InitialBackoff and MaxBackoff is the range of the delay between the retries,
+	// the delay doubles from InitialBackoff up to MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultPublishSettings is the default value of Topic.PublishSettings
+var DefaultPublishSettings = PublishSettings{
+	DelayThreshold:         10 * time.Millisecond,
+	CountThreshold:         100,
+	ByteThreshold:          1e6,
+	MaxOutstandingMessages: 1000,
+	MaxOutstandingBytes:    1e8,
+	LimitExceededBehavior:  FlowControlBlock,
+	Timeout:                60 * time.Second,
+	InitialBackoff:         100 * time.Millisecond,
+	MaxBackoff:             5 * time.Second,
+}
+
+// publishBundle is buffered messages sent by one request
+type publishBundle struct {
+	msgs    []*Message
+	results []*PublishResult
+	size    int
+	timer   *time.Timer
+}
+
+// Publish buffers the message and returns PublishResult.
+// the message is sent with the other messages when any threshold of the PublishSettings is reached.
+// Publish blocks while the outstanding messages exceed the limit with FlowControlBlock,
+// ctx is only used for the blocking.
+func (t *Topic) Publish(ctx context.Context, msg *Message) *PublishResult {
+	pr := &PublishResult{
+		done: make(chan struct{}),
+	}
+
+	t.mu.Lock()
+	if t.flow == nil {
+		t.flow = newFlowController(t.publishSettings())
+	}
+	flow := t.flow
+	t.mu.Unlock()
+	if err := flow.acquire(ctx, len(msg.Data)); err != nil {
+		pr.set("", err)
+		return pr
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		flow.release(len(msg.Data))
+		pr.set("", ErrTopicStopped)
+		return pr
+	}
+
+	settings := t.publishSettings()
+	if b := t.bundle; b != nil && b.size+len(msg.Data) > settings.ByteThreshold {
+		t.flushLocked()
+	}
+	if t.bundle == nil {
+		b := &publishBundle{}
+		b.timer = time.AfterFunc(settings.DelayThreshold, func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.bundle == b {
+				t.flushLocked()
+			}
+		})
+		t.bundle = b
+	}
+	b := t.bundle
+	b.msgs = append(b.msgs, msg)
+	b.results = append(b.results, pr)
+	b.size += len(msg.Data)
+	if len(b.msgs) >= settings.CountThreshold || b.size >= settings.ByteThreshold {
+		t.flushLocked()
+	}
+	return pr
+}
+
+// Flush sends the buffered messages, and blocks until all of the sent messages are done
+func (t *Topic) Flush() {
+	t.mu.Lock()
+	t.flushLocked()
+	t.mu.Unlock()
+	t.inFlight.Wait()
+}
+
+// Stop sends the buffered messages and waits for them, Publish after Stop returns ErrTopicStopped
+func (t *Topic) Stop() {
+	t.mu.Lock()
+	t.stopped = true
+	t.mu.Unlock()
+	t.Flush()
+}
+
+// publishSettings returns PublishSettings filled the zero fields by the default
+func (t *Topic) publishSettings() PublishSettings {
+	s := t.PublishSettings
+	if s.DelayThreshold <= 0 {
+		s.DelayThreshold = DefaultPublishSettings.DelayThreshold
+	}
+	if s.CountThreshold <= 0 {
+		s.CountThreshold = DefaultPublishSettings.CountThreshold
+	}
+	if s.ByteThreshold <= 0 {
+		s.ByteThreshold = DefaultPublishSettings.ByteThreshold
+	}
+	if s.MaxOutstandingMessages == 0 {
+		s.MaxOutstandingMessages = DefaultPublishSettings.MaxOutstandingMessages
+	}
+	if s.MaxOutstandingBytes == 0 {
+		s.MaxOutstandingBytes = DefaultPublishSettings.MaxOutstandingBytes
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = DefaultPublishSettings.Timeout
+	}
+	if s.InitialBackoff <= 0 {
+		s.InitialBackoff = DefaultPublishSettings.InitialBackoff
+	}
+	if s.MaxBackoff <= 0 {
+		s.MaxBackoff = DefaultPublishSettings.MaxBackoff
+	}
+	return s
+}
+
+// flushLocked sends the current bundle asynchronously, requires the lock
+func (t *Topic) flushLocked() {
+	b := t.bundle
+	if b == nil {
+		return
+	}
+	t.bundle = nil
+	b.timer.Stop()
+
+	settings := t.publishSettings()
+	flow := t.flow
+	t.inFlight.Add(1)
+	go func() {
+		defer t.inFlight.Done()
+		t.sendBundle(b, settings)
+		for _, msg := range b.msgs {
+			flow.release(len(msg.Data))
+		}
+	}()
+}
+
+// sendBundle publish the messages by one request and set the results.
+// the request is retried with the exponential backoff while the error is retryable and not timed out.
+func (t *Topic) sendBundle(b *publishBundle, settings PublishSettings) {
+	ctx, cancel := context.WithTimeout(context.Background(), settings.Timeout)
+	defer cancel()
+
+	var (
+		msgIDs  []string
+		err     error
+		backoff = settings.InitialBackoff
+	)
+	for {
+		msgIDs, err = t.s.publishMessages(ctx, t.ID, b.msgs)
+		if err == nil || !isRetryable(err) {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if backoff *= 2; backoff > settings.MaxBackoff {
+			backoff = settings.MaxBackoff
+		}
+	}
+	// the partial failure is not retried, because the succeeded messages are already published
+	batchErr, partial := errors.Cause(err).(*BatchError)
+	if apiErr, ok := errors.Cause(err).(*APIError); ok && len(apiErr.Details) != 0 {
+		// all of the messages failed, e.g. rejected by the schema, the error of the each message is set
+		batchErr, partial = detailErrors(len(b.msgs), apiErr), true
+		msgIDs = make([]string, len(b.msgs))
+	}
+	if (err == nil || partial) && len(msgIDs) != len(b.msgs) {
+		err, partial = errors.Errorf("want %d message ids, got %d", len(b.msgs), len(msgIDs)), false
+	}
+	for i, pr := range b.results {
+		switch {
+		case partial:
+			pr.set(msgIDs[i], batchErr.Errors[i])
+		case err != nil:
+			pr.set("", err)
+		default:
+			pr.set(msgIDs[i], nil)
+		}
+	}
+}
+
+// detailErrors returns BatchError holding the detail of the each message, the message without the detail has err
+func detailErrors(size int, err *APIError) *BatchError {
+	e := newBatchError(size, err.Details).(*BatchError)
+	for i := range e.Errors {
+		if e.Errors[i] == nil {
+			e.Errors[i] = err
+		}
+	}
+	return e
+}
+
+// flowController limits the outstanding messages and bytes
+type flowController struct {
+	maxCount int
+	maxBytes int
+	behavior LimitExceededBehavior
+
+	mu    sync.Mutex
+	count int
+	bytes int
+	// changed is closed when the outstanding messages are released
+	changed chan struct{}
+}
+
+func newFlowController(s PublishSettings) *flowController {
+	return &flowController{
+		maxCount: s.MaxOutstandingMessages,
+		maxBytes: s.MaxOutstandingBytes,
+		behavior: s.LimitExceededBehavior,
+		changed:  make(chan struct{}),
+	}
+}
+
+// acquire reserves the message, a message exceeding the bytes limit alone is accepted when nothing is outstanding
+func (f *flowController) acquire(ctx context.Context, size int) error {
+	for {
+		f.mu.Lock()
+		if f.fits(size) {
+			f.count++
+			f.bytes += size
+			f.mu.Unlock()
+			return nil
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		if f.behavior == FlowControlSignalError {
+			return ErrFlowControlLimitExceeded
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (f *flowController) fits(size int) bool {
+	if f.count == 0 {
+		return true
+	}
+	if f.maxCount > 0 && f.count+1 > f.maxCount {
+		return false
+	}
+	if f.maxBytes > 0 && f.bytes+size > f.maxBytes {
+		return false
+	}
+	return true
+}
+
+func (f *flowController) release(size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count--
+	f.bytes -= size
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
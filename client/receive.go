@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// ReceiveSettings control Receive
+type ReceiveSettings struct {
+	// MaxExtension is the maximum time to extend the ack deadline of the message not yet acked.
+	// negative value disables the extension.
+	MaxExtension time.Duration
+
+	// MaxOutstandingMessages is the maximum number of the messages received and not yet acked.
+	// fn of Receive is called concurrently up to this number.
+	MaxOutstandingMessages int
+
+	// NumGoroutines is the number of the goroutines pulling the messages
+	NumGoroutines int
+}
+
+// DefaultReceiveSettings is the default value of Subscription.ReceiveSettings
+var DefaultReceiveSettings = ReceiveSettings{
+	MaxExtension:           10 * time.Minute,
+	MaxOutstandingMessages: 1000,
+	NumGoroutines:          1,
+}
+
+const (
+	// maxPullMessages is the maximum number of the messages pulled by one request
+	maxPullMessages = 100
+
+	// emptyPullInterval is the interval of the pull when the subscription has no message
+	emptyPullInterval = 100 * time.Millisecond
+
+	// defaultAckDeadline is used to extend the deadline when the subscription has no ack deadline
+	defaultAckDeadline = 10 * time.Second
+
+	// ackRequestTimeout is the timeout of the ack and the nack sent regardless of ctx of Receive
+	ackRequestTimeout = 5 * time.Second
+
+	// pullRequestTimeout is the timeout of the pull, the in-flight pull is not cancelled by ctx of Receive
+	// because the server leases the messages regardless of the cancel of the request
+	pullRequestTimeout = 30 * time.Second
+)
+
+// receiveSettings returns ReceiveSettings filled the zero fields by the default
+func (s *Subscription) receiveSettings() ReceiveSettings {
+	rs := s.ReceiveSettings
+	if rs.MaxExtension == 0 {
+		rs.MaxExtension = DefaultReceiveSettings.MaxExtension
+	}
+	if rs.MaxOutstandingMessages <= 0 {
+		rs.MaxOutstandingMessages = DefaultReceiveSettings.MaxOutstandingMessages
+	}
+	if rs.NumGoroutines <= 0 {
+		rs.NumGoroutines = DefaultReceiveSettings.NumGoroutines
+	}
+	return rs
+}
+
+// Receive calls fn concurrently for the messages pulled from the Subscription, and blocks until ctx is done.
+// fn must call Message.Ack or Message.Nack, the ack deadline of the message is extended until then up to MaxExtension.
+// Receive returns nil when ctx is done, or returns the error of the pull.
+// the messages not yet acked when Receive returns are nacked.
+func (s *Subscription) Receive(ctx context.Context, fn func(ctx context.Context, msg *Message)) error {
+	cfg, err := s.s.getSubscriptionConfig(ctx, s.ID)
+	if err != nil {
+		return err
+	}
+	deadline := cfg.AckTimeout
+	if deadline < time.Second {
+		deadline = defaultAckDeadline
+	}
+	settings := s.receiveSettings()
+	r := &receiver{
+		sub:      s,
+		settings: settings,
+		deadline: deadline,
+		slots:    make(chan struct{}, settings.MaxOutstandingMessages),
+		inFlight: make(map[string]time.Time),
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		pullers sync.WaitGroup
+		errOnce sync.Once
+		pullErr error
+	)
+	for i := 0; i < settings.NumGoroutines; i++ {
+		pullers.Add(1)
+		go func() {
+			defer pullers.Done()
+			if err := r.pullLoop(ctx, fn); err != nil {
+				errOnce.Do(func() {
+					pullErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+	extendDone := make(chan struct{})
+	go func() {
+		defer close(extendDone)
+		r.extendLoop(ctx)
+	}()
+
+	pullers.Wait()
+	r.handlers.Wait()
+	<-extendDone
+	r.nackAll()
+	return pullErr
+}
+
+// receiver holds the state of the running Receive
+type receiver struct {
+	sub      *Subscription
+	settings ReceiveSettings
+	deadline time.Duration
+
+	// slots is semaphore of the outstanding messages
+	slots    chan struct{}
+	handlers sync.WaitGroup
+
+	mu sync.Mutex
+	// inFlight is the received time of the messages not yet acked, the key is AckID
+	inFlight map[string]time.Time
+}
+
+// acquire blocks until a slot is available, and returns the number of the acquired slots
+func (r *receiver) acquire(ctx context.Context) (int, error) {
+	select {
+	case r.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	n := 1
+	for n < maxPullMessages {
+		select {
+		case r.slots <- struct{}{}:
+			n++
+		default:
+			return n, nil
+		}
+	}
+	return n, nil
+}
+
+func (r *receiver) releaseSlots(n int) {
+	for i := 0; i < n; i++ {
+		<-r.slots
+	}
+}
+
+func (r *receiver) pullLoop(ctx context.Context, fn func(ctx context.Context, msg *Message)) error {
+	backoff := DefaultPublishSettings.InitialBackoff
+	for {
+		n, err := r.acquire(ctx)
+		if err != nil {
+			return nil
+		}
+		// the messages pulled after ctx is done are nacked to be redelivered immediately
+		msgs, err := r.pull(n)
+		if err == nil && ctx.Err() != nil {
+			r.releaseSlots(n)
+			ackIDs := make([]string, 0, len(msgs))
+			for _, msg := range msgs {
+				ackIDs = append(ackIDs, msg.AckID)
+			}
+			r.nack(ackIDs)
+			return nil
+		}
+		if err != nil {
+			r.releaseSlots(n)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != ErrNotFoundMessage && !isRetryable(err) {
+				return err
+			}
+			wait := emptyPullInterval
+			if err != ErrNotFoundMessage {
+				wait = backoff
+				if backoff *= 2; backoff > DefaultPublishSettings.MaxBackoff {
+					backoff = DefaultPublishSettings.MaxBackoff
+				}
+			}
+			if !sleep(ctx, wait) {
+				return nil
+			}
+			continue
+		}
+		backoff = DefaultPublishSettings.InitialBackoff
+		r.releaseSlots(n - len(msgs))
+
+		now := time.Now()
+		r.mu.Lock()
+		for _, msg := range msgs {
+			r.inFlight[msg.AckID] = now
+		}
+		r.mu.Unlock()
+		for _, msg := range msgs {
+			msg.setDone(r.done)
+			r.handlers.Add(1)
+			go func(msg *Message) {
+				defer r.handlers.Done()
+				fn(ctx, msg)
+			}(msg)
+		}
+	}
+}
+
+// pull waits for the response of the pull up to pullRequestTimeout, even if ctx of Receive is done
+func (r *receiver) pull(n int) ([]*Message, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), pullRequestTimeout)
+	defer cancel()
+	return r.sub.s.pullMessages(ctx, r.sub.ID, n)
+}
+
+// done sends ack or nack of the message, and releases the slot
+func (r *receiver) done(msg *Message, ack bool) {
+	r.mu.Lock()
+	_, ok := r.inFlight[msg.AckID]
+	delete(r.inFlight, msg.AckID)
+	r.mu.Unlock()
+
+	if ack {
+		ctx, cancel := context.WithTimeout(context.Background(), ackRequestTimeout)
+		if err := r.sub.s.ack(ctx, r.sub.ID, []string{msg.AckID}); err != nil {
+			log.Printf("failed to ack message, subscription=%s, ack_id=%s, error=%v", r.sub.ID, msg.AckID, err)
+		}
+		cancel()
+	} else {
+		r.nack([]string{msg.AckID})
+	}
+	if ok {
+		r.releaseSlots(1)
+	}
+}
+
+// extendLoop extends the ack deadline of the in-flight messages before expired.
+// the messages exceeded MaxExtension are released from the slot and redelivered after the deadline.
+func (r *receiver) extendLoop(ctx context.Context) {
+	if r.settings.MaxExtension < 0 {
+		return
+	}
+	ticker := time.NewTicker(r.deadline / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var (
+			extend  []string
+			expired int
+		)
+		now := time.Now()
+		r.mu.Lock()
+		for ackID, received := range r.inFlight {
+			if now.Sub(received) < r.settings.MaxExtension {
+				extend = append(extend, ackID)
+				continue
+			}
+			delete(r.inFlight, ackID)
+			expired++
+		}
+		r.mu.Unlock()
+
+		r.releaseSlots(expired)
+		if len(extend) != 0 {
+			r.sub.s.modifyAckDeadline(ctx, r.sub.ID, r.deadline, extend)
+		}
+	}
+}
+
+// nackAll nacks the in-flight messages
+func (r *receiver) nackAll() {
+	r.mu.Lock()
+	ackIDs := make([]string, 0, len(r.inFlight))
+	for ackID := range r.inFlight {
+		ackIDs = append(ackIDs, ackID)
+	}
+	r.inFlight = make(map[string]time.Time)
+	r.mu.Unlock()
+	r.nack(ackIDs)
+}
+
+// nack sends the nack of the messages with ackRequestTimeout, ctx of Receive may already be done
+func (r *receiver) nack(ackIDs []string) {
+	if len(ackIDs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ackRequestTimeout)
+	defer cancel()
+	if err := r.sub.s.modifyAckDeadline(ctx, r.sub.ID, 0, ackIDs); err != nil {
+		log.Printf("failed to nack messages, subscription=%s, ack_ids=%v, error=%v", r.sub.ID, ackIDs, err)
+	}
+}
+
+// sleep waits the duration, returns false when ctx is done
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// SchemaType is the definition language of the schema
+type SchemaType string
+
+// supported schema types
+const (
+	SchemaJSON SchemaType = "json_schema"
+	SchemaAvro SchemaType = "avro"
+)
+
+// SchemaEncoding is the encoding of the messages published to the topic
+type SchemaEncoding string
+
+// supported encodings, EncodingBinary is only supported by the Avro schema
+const (
+	EncodingJSON   SchemaEncoding = "json"
+	EncodingBinary SchemaEncoding = "binary"
+)
+
+// SchemaConfig represent a revision of the schema
+type SchemaConfig struct {
+	Name               string     `json:"name"`
+	Type               SchemaType `json:"type"`
+	Definition         string     `json:"definition"`
+	RevisionID         string     `json:"revision_id,omitempty"`
+	RevisionCreateTime time.Time  `json:"revision_create_time,omitempty"`
+}
+
+// SchemaSettings is the schema attached to the topic.
+// the messages published to the topic are validated with the latest revision of the schema.
+type SchemaSettings struct {
+	Schema   string         `json:"schema"`
+	Encoding SchemaEncoding `json:"encoding"`
+}
+
+// CreateSchema creates new schema, the created schema has the first revision
+func (c *Client) CreateSchema(ctx context.Context, id string, cfg SchemaConfig) (*SchemaConfig, error) {
+	return c.s.createSchema(ctx, id, cfg)
+}
+
+// Schema returns the latest revision of the schema
+func (c *Client) Schema(ctx context.Context, id string) (*SchemaConfig, error) {
+	return c.s.getSchema(ctx, id, "")
+}
+
+// SchemaRevision returns the specified revision of the schema
+func (c *Client) SchemaRevision(ctx context.Context, id, revisionID string) (*SchemaConfig, error) {
+	return c.s.getSchema(ctx, id, revisionID)
+}
+
+// CommitSchema adds new revision to the schema, the type of the schema is not changeable
+func (c *Client) CommitSchema(ctx context.Context, id, definition string) (*SchemaConfig, error) {
+	return c.s.commitSchema(ctx, id, definition)
+}
+
+// DeleteSchema deletes the schema and the all revisions.
+// the schema attached to any topic is not deletable, returns ErrFailedPrecondition.
+func (c *Client) DeleteSchema(ctx context.Context, id string) error {
+	return c.s.deleteSchema(ctx, id)
+}
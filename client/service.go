@@ -7,6 +7,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -16,26 +17,36 @@ import (
 // service is an accessor to server API used by this package
 type service interface {
 	// handle topic
-	createTopic(ctx context.Context, id string) error
-	deleteTopic(ctx context.Context, id string) error
+	createTopic(ctx context.Context, id string, cfg *TopicConfig) error
+	getTopicConfig(ctx context.Context, id string) (*TopicConfig, error)
+	updateTopic(ctx context.Context, id string, cfg TopicConfigToUpdate) (*TopicConfig, error)
+	deleteTopic(ctx context.Context, id string, cascade bool) error
 	topicExists(ctx context.Context, id string) (bool, error)
-	listTopics(ctx context.Context) ([]string, error)
-	listTopicSubscriptions(ctx context.Context, id string) ([]string, error)
+	listTopics(ctx context.Context, q listQuery) ([]string, string, error)
+	listTopicSubscriptions(ctx context.Context, id string, q listQuery) ([]string, string, error)
 
 	// handle subscription
 	createSubscription(ctx context.Context, id string, cfg SubscriptionConfig) error
 	getSubscriptionConfig(ctx context.Context, id string) (*SubscriptionConfig, error)
-	listSubscriptions(ctx context.Context) ([]string, error)
+	updateSubscription(ctx context.Context, id string, cfg *SubscriptionConfigToUpdate) error
+	listSubscriptions(ctx context.Context, q listQuery) ([]string, string, error)
 	deleteSubscription(ctx context.Context, id string) error
+	detachSubscription(ctx context.Context, id string) error
+	purgeSubscription(ctx context.Context, id string, olderThan time.Time) (int, error)
 	subscriptionExists(ctx context.Context, id string) (bool, error)
-	modifyPushConfig(ctx context.Context, id string, cfg *PushConfig) error
 
 	// handle message
 	modifyAckDeadline(ctx context.Context, subID string, deadline time.Duration, ackIDs []string) error
 	pullMessages(ctx context.Context, subID string, maxMessages int) ([]*Message, error)
-	publishMessages(ctx context.Context, topicID string, msg *Message) (string, error)
+	publishMessages(ctx context.Context, topicID string, msgs []*Message) ([]string, error)
 	ack(ctx context.Context, subID string, ackIDs []string) error
 
+	// handle schema
+	createSchema(ctx context.Context, id string, cfg SchemaConfig) (*SchemaConfig, error)
+	getSchema(ctx context.Context, id, revisionID string) (*SchemaConfig, error)
+	commitSchema(ctx context.Context, id, definition string) (*SchemaConfig, error)
+	deleteSchema(ctx context.Context, id string) error
+
 	// monitoring
 	statsSummary(ctx context.Context) ([]byte, error)
 	statsTopicDetail(ctx context.Context, id string) ([]byte, error)
@@ -46,6 +57,7 @@ type service interface {
 type restService struct {
 	publisher  *restPublisher
 	subscriber *restSubscriber
+	schema     *restSchema
 	monitoring *restMonitoring
 }
 
@@ -59,6 +71,11 @@ type restSubscriber struct {
 	httpClient http.Client
 }
 
+type restSchema struct {
+	serverURL  string
+	httpClient http.Client
+}
+
 type restMonitoring struct {
 	serverURL  string
 	httpClient http.Client
@@ -72,6 +89,10 @@ func (s *restSubscriber) sendRequest(ctx context.Context, method, url string, bo
 	return sendRequest(ctx, s.httpClient, method, s.serverURL+url, body)
 }
 
+func (s *restSchema) sendRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
+	return sendRequest(ctx, s.httpClient, method, s.serverURL+url, body)
+}
+
 func (s *restMonitoring) sendRequest(ctx context.Context, method, url string, body io.Reader) (*http.Response, error) {
 	return sendRequest(ctx, s.httpClient, method, s.serverURL+url, body)
 }
@@ -86,8 +107,37 @@ func sendRequest(ctx context.Context, client http.Client, method, url string, bo
 	return client.Do(req)
 }
 
-func (s *restService) createTopic(ctx context.Context, id string) error {
-	res, err := s.publisher.sendRequest(ctx, "PUT", id, nil)
+// ResourceTopic represent the payload of the Topic API
+type ResourceTopic struct {
+	Name           string            `json:"name,omitempty"`
+	SchemaSettings *SchemaSettings   `json:"schema_settings,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Description    string            `json:"description,omitempty"`
+}
+
+// ResourceUpdateTopic represent the payload of the request Topic update API
+type ResourceUpdateTopic struct {
+	SchemaSettings *SchemaSettings   `json:"schema_settings,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Description    string            `json:"description,omitempty"`
+	UpdateMask     string            `json:"update_mask"`
+}
+
+func (s *restService) createTopic(ctx context.Context, id string, cfg *TopicConfig) error {
+	var body io.Reader
+	if cfg != nil {
+		var buf bytes.Buffer
+		rt := &ResourceTopic{
+			SchemaSettings: cfg.SchemaSettings,
+			Labels:         cfg.Labels,
+			Description:    cfg.Description,
+		}
+		if err := json.NewEncoder(&buf).Encode(rt); err != nil {
+			return err
+		}
+		body = &buf
+	}
+	res, err := s.publisher.sendRequest(ctx, "PUT", id, body)
 	if err != nil {
 		return err
 	}
@@ -96,8 +146,69 @@ func (s *restService) createTopic(ctx context.Context, id string) error {
 	return verifyHTTPStatusCode(http.StatusCreated, res)
 }
 
-func (s *restService) deleteTopic(ctx context.Context, id string) error {
-	res, err := s.publisher.sendRequest(ctx, "DELETE", id, nil)
+func (s *restService) getTopicConfig(ctx context.Context, id string) (*TopicConfig, error) {
+	res, err := s.publisher.sendRequest(ctx, "GET", id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeTopicConfig(res)
+}
+
+func (s *restService) updateTopic(ctx context.Context, id string, cfg TopicConfigToUpdate) (*TopicConfig, error) {
+	ru := &ResourceUpdateTopic{}
+	mask := []string{}
+	if cfg.SchemaSettings != nil {
+		if len(cfg.SchemaSettings.Schema) != 0 {
+			ru.SchemaSettings = cfg.SchemaSettings
+		}
+		mask = append(mask, "schema_settings")
+	}
+	if cfg.Labels != nil {
+		ru.Labels = cfg.Labels
+		mask = append(mask, "labels")
+	}
+	if cfg.Description != nil {
+		ru.Description = *cfg.Description
+		mask = append(mask, "description")
+	}
+	ru.UpdateMask = strings.Join(mask, ",")
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(ru); err != nil {
+		return nil, err
+	}
+
+	res, err := s.publisher.sendRequest(ctx, "PATCH", id, &buf)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeTopicConfig(res)
+}
+
+func decodeTopicConfig(res *http.Response) (*TopicConfig, error) {
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, err
+	}
+	rt := &ResourceTopic{}
+	if err := json.NewDecoder(res.Body).Decode(rt); err != nil {
+		return nil, err
+	}
+	return &TopicConfig{
+		SchemaSettings: rt.SchemaSettings,
+		Labels:         rt.Labels,
+		Description:    rt.Description,
+	}, nil
+}
+
+func (s *restService) deleteTopic(ctx context.Context, id string, cascade bool) error {
+	path := id
+	if cascade {
+		path += "?cascade=true"
+	}
+	res, err := s.publisher.sendRequest(ctx, "DELETE", path, nil)
 	if err != nil {
 		return err
 	}
@@ -113,49 +224,60 @@ func (s *restService) topicExists(ctx context.Context, id string) (bool, error)
 	}
 	defer res.Body.Close()
 
-	return http.StatusOK == res.StatusCode, nil
+	return verifyExists(res)
 }
 
-func (s *restService) listTopics(ctx context.Context) ([]string, error) {
-	res, err := s.publisher.sendRequest(ctx, "GET", "", nil)
+func (s *restService) listTopics(ctx context.Context, q listQuery) ([]string, string, error) {
+	res, err := s.publisher.sendRequest(ctx, "GET", q.encode(), nil)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, "", err
+	}
 
 	type topicID struct {
 		Name string
 	}
-	ids := []topicID{}
-	err = json.NewDecoder(res.Body).Decode(&ids)
+	type topicList struct {
+		Topics        []topicID `json:"topics"`
+		NextPageToken string    `json:"next_page_token"`
+	}
+	list := topicList{}
+	err = json.NewDecoder(res.Body).Decode(&list)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	ret := []string{}
-	for _, v := range ids {
+	for _, v := range list.Topics {
 		ret = append(ret, v.Name)
 	}
-	return ret, nil
+	return ret, list.NextPageToken, nil
 }
 
-func (s *restService) listTopicSubscriptions(ctx context.Context, id string) ([]string, error) {
-	res, err := s.publisher.sendRequest(ctx, "GET", id+"/subscriptions", nil)
+func (s *restService) listTopicSubscriptions(ctx context.Context, id string, q listQuery) ([]string, string, error) {
+	res, err := s.publisher.sendRequest(ctx, "GET", id+"/subscriptions"+q.encode(), nil)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, "", err
+	}
 
 	type SubIDs struct {
-		Subscription []string `json:"subscriptions"`
+		Subscription  []string `json:"subscriptions"`
+		NextPageToken string   `json:"next_page_token"`
 	}
 	subs := SubIDs{}
 	err = json.NewDecoder(res.Body).Decode(&subs)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return subs.Subscription, nil
+	return subs.Subscription, subs.NextPageToken, nil
 }
 
 // ResourcePublishRequest represent the payload of the request Publish API
@@ -165,39 +287,64 @@ type ResourcePublishRequest struct {
 
 // ResourcePublishResponse represent the payload of the response Publish API
 type ResourcePublishResponse struct {
-	MessageIDs []string `json:"message_ids"`
+	MessageIDs []string                `json:"message_ids"`
+	Results    []ResourcePublishResult `json:"results"`
+}
+
+// ResourcePublishResult represent the result of the each message of the Publish API
+type ResourcePublishResult struct {
+	MessageID string `json:"message_id,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Reason    string `json:"reason,omitempty"`
 }
 
-func (s *restService) publishMessages(ctx context.Context, id string, msg *Message) (string, error) {
-	// TODO: acceptable the Message slice in args
-	b := &ResourcePublishRequest{Messages: []PublishMessage{msg.toPublish()}}
+func (s *restService) publishMessages(ctx context.Context, id string, msgs []*Message) ([]string, error) {
+	b := &ResourcePublishRequest{Messages: make([]PublishMessage, 0, len(msgs))}
+	for _, msg := range msgs {
+		b.Messages = append(b.Messages, msg.toPublish())
+	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(b)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	res, err := s.publisher.sendRequest(ctx, "POST", id+"/publish", &buf)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, err
+	}
 
 	msgIDs := ResourcePublishResponse{}
 	err = json.NewDecoder(res.Body).Decode(&msgIDs)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	// NOTE: expect sent a one message only
-	return msgIDs.MessageIDs[0], nil
+	var failed []ErrorDetail
+	for i, r := range msgIDs.Results {
+		if len(r.Code) != 0 {
+			failed = append(failed, ErrorDetail{Index: i, Code: r.Code, Reason: r.Reason})
+		}
+	}
+	return msgIDs.MessageIDs, newBatchError(len(msgs), failed)
 }
 
 // ResourceSusbscription represent body of request/response the Subscription parameter
 type ResourceSusbscription struct {
-	Name       string      `json:"name"`
-	Topic      string      `json:"topic"`
-	PushConfig *PushConfig `json:"push_config"`
-	AckTimeout int64       `json:"ack_deadline_seconds"`
+	Name       string        `json:"name"`
+	Topic      string        `json:"topic"`
+	PushConfig *PushConfig   `json:"push_config"`
+	AckTimeout int64         `json:"ack_deadline_seconds"`
+	Retention  int64         `json:"message_retention_seconds,omitempty"`
+	Filter     string        `json:"filter,omitempty"`
+	Detached   bool          `json:"detached,omitempty"`
+	PushHealth *PushHealth   `json:"push_health,omitempty"`
+	Export     *ExportConfig `json:"export_config,omitempty"`
+
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
 }
 
 func (s *restService) createSubscription(ctx context.Context, id string, cfg SubscriptionConfig) error {
@@ -213,6 +360,12 @@ func (s *restService) createSubscription(ctx context.Context, id string, cfg Sub
 		Topic:      cfg.Topic.ID,
 		PushConfig: cfg.PushConfig,
 		AckTimeout: int64(cfg.AckTimeout.Seconds()),
+		Retention:  int64(cfg.RetentionDuration.Seconds()),
+		Filter:     cfg.Filter,
+		Export:     cfg.ExportConfig,
+
+		Labels:      cfg.Labels,
+		Description: cfg.Description,
 	}
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(rs)
@@ -235,6 +388,9 @@ func (s *restService) getSubscriptionConfig(ctx context.Context, id string) (*Su
 		return nil, err
 	}
 	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, err
+	}
 
 	rs := &ResourceSusbscription{}
 	err = json.NewDecoder(res.Body).Decode(rs)
@@ -242,32 +398,103 @@ func (s *restService) getSubscriptionConfig(ctx context.Context, id string) (*Su
 		return nil, err
 	}
 	cfg := &SubscriptionConfig{
-		Topic:      newTopic(rs.Topic, s),
-		PushConfig: rs.PushConfig,
-		AckTimeout: time.Duration(rs.AckTimeout),
+		Topic:             newTopic(rs.Topic, s),
+		PushConfig:        rs.PushConfig,
+		AckTimeout:        time.Duration(rs.AckTimeout) * time.Second,
+		RetentionDuration: time.Duration(rs.Retention) * time.Second,
+		Filter:            rs.Filter,
+		Detached:          rs.Detached,
+		PushHealth:        rs.PushHealth,
+		ExportConfig:      rs.Export,
+
+		Labels:      rs.Labels,
+		Description: rs.Description,
 	}
 
 	return cfg, nil
 }
 
-func (s *restService) listSubscriptions(ctx context.Context) ([]string, error) {
-	res, err := s.subscriber.sendRequest(ctx, "GET", "", nil)
+// ResourceUpdateSubscription represent the payload of the request Subscription update API
+type ResourceUpdateSubscription struct {
+	PushConfig  *PushConfig       `json:"push_config,omitempty"`
+	AckTimeout  int64             `json:"ack_deadline_seconds,omitempty"`
+	Retention   int64             `json:"message_retention_seconds,omitempty"`
+	Filter      string            `json:"filter,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+	UpdateMask  string            `json:"update_mask"`
+}
+
+func (s *restService) updateSubscription(ctx context.Context, id string, cfg *SubscriptionConfigToUpdate) error {
+	ru := &ResourceUpdateSubscription{}
+	mask := []string{}
+	if cfg.PushConfig != nil {
+		ru.PushConfig = cfg.PushConfig
+		mask = append(mask, "push_config")
+	}
+	if cfg.AckTimeout != 0 {
+		ru.AckTimeout = int64(cfg.AckTimeout.Seconds())
+		mask = append(mask, "ack_deadline_seconds")
+	}
+	if cfg.RetentionDuration != nil {
+		ru.Retention = int64(cfg.RetentionDuration.Seconds())
+		mask = append(mask, "message_retention_seconds")
+	}
+	if cfg.Filter != nil {
+		ru.Filter = *cfg.Filter
+		mask = append(mask, "filter")
+	}
+	if cfg.Labels != nil {
+		ru.Labels = cfg.Labels
+		mask = append(mask, "labels")
+	}
+	if cfg.Description != nil {
+		ru.Description = *cfg.Description
+		mask = append(mask, "description")
+	}
+	if len(mask) == 0 {
+		return nil
+	}
+	ru.UpdateMask = strings.Join(mask, ",")
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(ru); err != nil {
+		return err
+	}
+
+	res, err := s.subscriber.sendRequest(ctx, "PATCH", id, &buf)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer res.Body.Close()
 
-	subs := []*ResourceSusbscription{}
-	err = json.NewDecoder(res.Body).Decode(&subs)
+	return verifyHTTPStatusCode(http.StatusOK, res)
+}
+
+func (s *restService) listSubscriptions(ctx context.Context, q listQuery) ([]string, string, error) {
+	res, err := s.subscriber.sendRequest(ctx, "GET", q.encode(), nil)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return nil, "", err
+	}
+
+	type subscriptionList struct {
+		Subscriptions []*ResourceSusbscription `json:"subscriptions"`
+		NextPageToken string                   `json:"next_page_token"`
+	}
+	list := subscriptionList{}
+	err = json.NewDecoder(res.Body).Decode(&list)
+	if err != nil {
+		return nil, "", err
 	}
 
 	ret := []string{}
-	for _, v := range subs {
+	for _, v := range list.Subscriptions {
 		ret = append(ret, v.Name)
 	}
-	return ret, nil
+	return ret, list.NextPageToken, nil
 }
 
 func (s *restService) deleteSubscription(ctx context.Context, id string) error {
@@ -280,38 +507,55 @@ func (s *restService) deleteSubscription(ctx context.Context, id string) error {
 	return verifyHTTPStatusCode(http.StatusNoContent, res)
 }
 
-func (s *restService) subscriptionExists(ctx context.Context, id string) (bool, error) {
-	res, err := s.subscriber.sendRequest(ctx, "GET", id, nil)
+func (s *restService) detachSubscription(ctx context.Context, id string) error {
+	res, err := s.subscriber.sendRequest(ctx, "POST", id+"/detach", nil)
 	if err != nil {
-		return false, err
+		return err
 	}
 	defer res.Body.Close()
 
-	return http.StatusOK == res.StatusCode, nil
+	return verifyHTTPStatusCode(http.StatusOK, res)
 }
 
-// ResourceModifyPush represent the payload of the ModifyPush API
-type ResourceModifyPush struct {
-	PushConfig *PushConfig `json:"push_config"`
+// ResourcePurge represent the payload of the request Purge API
+type ResourcePurge struct {
+	OlderThan time.Time `json:"older_than"`
 }
 
-func (s *restService) modifyPushConfig(ctx context.Context, id string, cfg *PushConfig) error {
-	payload := &ResourceModifyPush{
-		PushConfig: cfg,
-	}
+// ResourcePurgeResponse represent the payload of the response Purge API
+type ResourcePurgeResponse struct {
+	PurgedCount int `json:"purged_count"`
+}
+
+func (s *restService) purgeSubscription(ctx context.Context, id string, olderThan time.Time) (int, error) {
 	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(payload)
+	if err := json.NewEncoder(&buf).Encode(&ResourcePurge{OlderThan: olderThan}); err != nil {
+		return 0, err
+	}
+	res, err := s.subscriber.sendRequest(ctx, "POST", id+"/purge", &buf)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return 0, err
+	}
+
+	var body ResourcePurgeResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return 0, err
 	}
+	return body.PurgedCount, nil
+}
 
-	res, err := s.subscriber.sendRequest(ctx, "POST", id+"/push/modify", &buf)
+func (s *restService) subscriptionExists(ctx context.Context, id string) (bool, error) {
+	res, err := s.subscriber.sendRequest(ctx, "GET", id, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer res.Body.Close()
 
-	return verifyHTTPStatusCode(http.StatusOK, res)
+	return verifyExists(res)
 }
 
 // ResourceModifyAck represent the payload of the ModifyAck API
@@ -353,9 +597,6 @@ type ResourcePullResponse struct {
 	} `json:"receive_messages"`
 }
 
-// ErrNotFoundMessage represent currently not exist message on the subscription server
-var ErrNotFoundMessage = errors.New("not found message")
-
 func (s *restService) pullMessages(ctx context.Context, subID string, maxMessages int) ([]*Message, error) {
 	if maxMessages <= 0 {
 		maxMessages = 1
@@ -377,12 +618,10 @@ func (s *restService) pullMessages(ctx context.Context, subID string, maxMessage
 	defer res.Body.Close()
 
 	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
-		var errBuf bytes.Buffer
-		io.Copy(&errBuf, res.Body)
-		if strings.Contains(errBuf.String(), "not found message") {
+		if e, ok := err.(*APIError); ok && e.Is(ErrNotFoundMessage) {
 			return nil, ErrNotFoundMessage
 		}
-		return nil, errors.Wrapf(err, "message: %s", errBuf.String())
+		return nil, err
 	}
 
 	rawMsgs := &ResourcePullResponse{}
@@ -404,6 +643,18 @@ type ResourceAck struct {
 	AckIDs []string `json:"ack_ids"`
 }
 
+// ResourceAckResponse represent the payload of the response Ack API
+type ResourceAckResponse struct {
+	Results []ResourceAckResult `json:"results"`
+}
+
+// ResourceAckResult represent the result of the each ack id of the Ack API
+type ResourceAckResult struct {
+	AckID  string `json:"ack_id"`
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
 func (s *restService) ack(ctx context.Context, subID string, ackIDs []string) error {
 	payload := &ResourceAck{
 		AckIDs: ackIDs,
@@ -419,8 +670,89 @@ func (s *restService) ack(ctx context.Context, subID string, ackIDs []string) er
 		return err
 	}
 	defer res.Body.Close()
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return err
+	}
 
-	return verifyHTTPStatusCode(http.StatusOK, res)
+	var body ResourceAckResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return err
+	}
+	var failed []ErrorDetail
+	for i, r := range body.Results {
+		if len(r.Code) != 0 {
+			failed = append(failed, ErrorDetail{Index: i, Code: r.Code, Reason: r.Reason})
+		}
+	}
+	return newBatchError(len(ackIDs), failed)
+}
+
+// ResourceCommitSchema represent the payload of the schema commit API
+type ResourceCommitSchema struct {
+	Definition string `json:"definition"`
+}
+
+func (s *restService) createSchema(ctx context.Context, id string, cfg SchemaConfig) (*SchemaConfig, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(&cfg); err != nil {
+		return nil, err
+	}
+	res, err := s.schema.sendRequest(ctx, "PUT", id, &buf)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeSchemaConfig(http.StatusCreated, res)
+}
+
+func (s *restService) getSchema(ctx context.Context, id, revisionID string) (*SchemaConfig, error) {
+	path := id
+	if len(revisionID) != 0 {
+		path += "?revision_id=" + url.QueryEscape(revisionID)
+	}
+	res, err := s.schema.sendRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeSchemaConfig(http.StatusOK, res)
+}
+
+func (s *restService) commitSchema(ctx context.Context, id, definition string) (*SchemaConfig, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(&ResourceCommitSchema{Definition: definition}); err != nil {
+		return nil, err
+	}
+	res, err := s.schema.sendRequest(ctx, "POST", id+"/commit", &buf)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	return decodeSchemaConfig(http.StatusOK, res)
+}
+
+func decodeSchemaConfig(expect int, res *http.Response) (*SchemaConfig, error) {
+	if err := verifyHTTPStatusCode(expect, res); err != nil {
+		return nil, err
+	}
+	cfg := &SchemaConfig{}
+	if err := json.NewDecoder(res.Body).Decode(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (s *restService) deleteSchema(ctx context.Context, id string) error {
+	res, err := s.schema.sendRequest(ctx, "DELETE", id, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return verifyHTTPStatusCode(http.StatusNoContent, res)
 }
 
 func (s *restService) statsSummary(ctx context.Context) ([]byte, error) {
@@ -468,13 +800,25 @@ func (s *restService) statsSubscriptionDetail(ctx context.Context, id string) ([
 	return ioutil.ReadAll(res.Body)
 }
 
+// verifyHTTPStatusCode returns APIError when the status code is not expected
 func verifyHTTPStatusCode(expect int, res *http.Response) error {
 	if c := res.StatusCode; c != expect {
-		return errors.Errorf("HTTP response error: expecte status code %d, but received %d", expect, c)
+		return decodeAPIError(res)
 	}
 	return nil
 }
 
+// verifyExists returns whether the resource exists, and returns error except not found
+func verifyExists(res *http.Response) (bool, error) {
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err := verifyHTTPStatusCode(http.StatusOK, res); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func isValidAckDeadlineRange(deadline time.Duration) bool {
 	// TODO: AckDeadline needs to determine upper and lower limits
 	return deadline > 0
@@ -2,15 +2,18 @@ package client
 
 import (
 	"context"
+	"encoding/json"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // Subscription is a accessor to a server subscription
 type Subscription struct {
 	ID string
-	s  service
+
+	// ReceiveSettings control Receive, the zero fields use DefaultReceiveSettings
+	ReceiveSettings ReceiveSettings
+
+	s service
 }
 
 // SubscriptionConfig represent parameter of the Subscription
@@ -18,19 +21,160 @@ type SubscriptionConfig struct {
 	Topic      *Topic
 	PushConfig *PushConfig
 	AckTimeout time.Duration
+
+	// RetentionDuration is duration to retain the undelivered messages, 0 is unlimited
+	RetentionDuration time.Duration
+	// Filter selects the messages by the attributes, e.g. `attributes.env = "prod"`
+	Filter string
+
+	// Detached is output only, true when the subscription is detached from the topic
+	Detached bool
+	// PushHealth is output only, the delivery state of the push endpoint
+	PushHealth *PushHealth
+	// ExportConfig makes the export subscription writing the messages to the files of the server instead of the push and the pull,
+	// it is set only at the creation
+	ExportConfig *ExportConfig
+
+	Labels      map[string]string
+	Description string
 }
 
-// SubscriptionConfigToUpdate is updatable parameter for the existed Subscription
+// SubscriptionConfigToUpdate is updatable parameter for the existed Subscription.
+// nil fields are not updated, set an empty map to remove all labels.
 type SubscriptionConfigToUpdate struct {
+	// PushConfig changes to the pull mode when Endpoint is empty
 	PushConfig *PushConfig
+	// AckTimeout is not updated when zero
+	AckTimeout        time.Duration
+	RetentionDuration *time.Duration
+	Filter            *string
+	Labels            map[string]string
+	Description       *string
 }
 
 // PushConfig represent parameter of the push mode in Subscription
 type PushConfig struct {
-	Endpoint   string
-	Attributes map[string]string
+	Endpoint   string            `json:"endpoint"`
+	Attributes map[string]string `json:"attributes"`
+	// Format is the payload format of the push request, empty is PushFormatWrapped
+	Format PushFormat `json:"format,omitempty"`
+	// Auth is the authentication of the push request, the server does not respond Token and Secret
+	Auth *PushAuth `json:"auth,omitempty"`
+	// MaxConcurrency is the number of the in-flight push requests up to 100, 0 is 1
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	// BatchSize is the messages per request of PushFormatBatch up to 1000, 0 is 100
+	BatchSize int `json:"batch_size,omitempty"`
+	// Timeout overrides the timeout of the push request of the server in seconds up to 10 minutes, 0 uses the server config
+	Timeout time.Duration `json:"-"`
+}
+
+// pushConfigJSON is PushConfig with the timeout in seconds
+type pushConfigJSON struct {
+	*pushConfigAlias
+	TimeoutSeconds int64 `json:"timeout_seconds,omitempty"`
+}
+
+type pushConfigAlias PushConfig
+
+// MarshalJSON encode PushConfig with the timeout in seconds
+func (c PushConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(pushConfigJSON{
+		pushConfigAlias: (*pushConfigAlias)(&c),
+		TimeoutSeconds:  int64(c.Timeout / time.Second),
+	})
+}
+
+// UnmarshalJSON decode PushConfig with the timeout in seconds
+func (c *PushConfig) UnmarshalJSON(b []byte) error {
+	v := pushConfigJSON{pushConfigAlias: (*pushConfigAlias)(c)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	c.Timeout = time.Duration(v.TimeoutSeconds) * time.Second
+	return nil
+}
+
+// ExportConfig represent parameter of the export Subscription
+type ExportConfig struct {
+	// Directory is relative to the export root of the server
+	Directory string `json:"directory"`
+	// Format is the file format, empty is ExportFormatJSONLines
+	Format ExportFormat `json:"format,omitempty"`
+	// FilenameTemplate is the file name with "{subscription}", "{topic}", "{timestamp}", "{seq}" and "{ext}"
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	// MaxBytes and MaxDuration rotate the file, 0 uses the server default
+	MaxBytes    int64         `json:"max_bytes,omitempty"`
+	MaxDuration time.Duration `json:"-"`
+}
+
+// exportConfigJSON is ExportConfig with the max duration in seconds
+type exportConfigJSON struct {
+	*exportConfigAlias
+	MaxDurationSeconds int64 `json:"max_duration_seconds,omitempty"`
+}
+
+type exportConfigAlias ExportConfig
+
+// MarshalJSON encode ExportConfig with the max duration in seconds
+func (c ExportConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(exportConfigJSON{
+		exportConfigAlias:  (*exportConfigAlias)(&c),
+		MaxDurationSeconds: int64(c.MaxDuration / time.Second),
+	})
 }
 
+// UnmarshalJSON decode ExportConfig with the max duration in seconds
+func (c *ExportConfig) UnmarshalJSON(b []byte) error {
+	v := exportConfigJSON{exportConfigAlias: (*exportConfigAlias)(c)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	c.MaxDuration = time.Duration(v.MaxDurationSeconds) * time.Second
+	return nil
+}
+
+// ExportFormat is the file format of the export Subscription
+type ExportFormat string
+
+// Export file formats
+const (
+	ExportFormatJSONLines ExportFormat = "jsonl"
+	ExportFormatAvro      ExportFormat = "avro"
+)
+
+// PushHealth represent the delivery state of the push endpoint
+type PushHealth struct {
+	LastError           string     `json:"last_error"`
+	LastErrorTime       *time.Time `json:"last_error_time"`
+	LastSuccessTime     *time.Time `json:"last_success_time"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// NextAttemptTime is the time the backoff of the failed push expires
+	NextAttemptTime *time.Time `json:"next_attempt_time"`
+	// CircuitOpen is true while the push is paused by the consecutive failures
+	CircuitOpen bool `json:"circuit_open"`
+}
+
+// PushAuth represent the authentication of the push request
+type PushAuth struct {
+	// Type is "bearer" with Token, "hmac" with Secret, or "oidc" with optional Audience
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	Secret   string `json:"secret,omitempty"`
+	Audience string `json:"audience,omitempty"`
+}
+
+// PushFormat is the payload format of the push request
+type PushFormat string
+
+// Push payload formats
+const (
+	PushFormatWrapped               PushFormat = "wrapped"
+	PushFormatNoWrapper             PushFormat = "no_wrapper"
+	PushFormatCloudEventsBinary     PushFormat = "cloudevents_binary"
+	PushFormatCloudEventsStructured PushFormat = "cloudevents_structured"
+	PushFormatBatch                 PushFormat = "batch"
+)
+
 func newSubscription(id string, s service) *Subscription {
 	return &Subscription{
 		ID: id,
@@ -60,32 +204,20 @@ func (s *Subscription) Delete(ctx context.Context) error {
 	return s.s.deleteSubscription(ctx, s.ID)
 }
 
-// Receive calls fn for the fetched messages from the Subscription.
-// send a nack requests when an error occurs via the Pull API.
-func (s *Subscription) Receive(ctx context.Context, fn func(ctx context.Context, msg *Message)) error {
-	// TODO: number of receive message extract to ReceiveConfig
-	msgs, err := s.s.pullMessages(ctx, s.ID, 1)
-	if err != nil {
-		// send nack request to the pulled messages
-		if msgs != nil {
-			ackIDs := []string{}
-			for _, msg := range msgs {
-				ackIDs = append(ackIDs, msg.AckID)
-			}
-			if nackErr := s.Nack(ctx, ackIDs); nackErr != nil {
-				errors.Wrapf(err, "failed to nack messages: %s", nackErr.Error())
-			}
-		}
-		return err
-	}
+// Detach detaches the Subscription from the topic, the config is kept and the messages not yet acked are dropped.
+// the detached Subscription receives no message, Receive returns ErrFailedPrecondition.
+func (s *Subscription) Detach(ctx context.Context) error {
+	return s.s.detachSubscription(ctx, s.ID)
+}
 
-	for _, msg := range msgs {
-		fn(ctx, msg)
-	}
-	return nil
+// Purge acks the messages published before olderThan, the zero olderThan purges the all messages.
+// returns number of the purged messages.
+func (s *Subscription) Purge(ctx context.Context, olderThan time.Time) (int, error) {
+	return s.s.purgeSubscription(ctx, s.ID, olderThan)
 }
 
-// Ack calls Ack API for the ackIDs
+// Ack calls Ack API for the ackIDs.
+// when a part of the ackIDs failed, returns *BatchError holding the error of the each ack id.
 func (s *Subscription) Ack(ctx context.Context, ackIDs []string) error {
 	return s.s.ack(ctx, s.ID, ackIDs)
 }
@@ -97,9 +229,9 @@ func (s *Subscription) Nack(ctx context.Context, ackIDs []string) error {
 	return s.s.modifyAckDeadline(ctx, s.ID, 0, ackIDs)
 }
 
-// Update updates an existing Subscription
+// Update updates an existing Subscription, only the non-nil fields are updated at once
 func (s *Subscription) Update(ctx context.Context, cfg *SubscriptionConfigToUpdate) error {
-	return s.s.modifyPushConfig(ctx, s.ID, cfg.PushConfig)
+	return s.s.updateSubscription(ctx, s.ID, cfg)
 }
 
 // StatsDetail returns stats detail of the Subscription
@@ -1,11 +1,43 @@
 package client
 
-import "context"
+import (
+	"context"
+	"sync"
+)
 
 // Topic is a accessor to a server topic
 type Topic struct {
 	ID string
-	s  service
+
+	// PublishSettings control the bundling of Publish, the zero fields use DefaultPublishSettings
+	PublishSettings PublishSettings
+
+	s service
+
+	mu       sync.Mutex
+	bundle   *publishBundle
+	flow     *flowController
+	stopped  bool
+	inFlight sync.WaitGroup
+}
+
+// DeletedTopic is the topic ID of the subscriptions detached by the topic deletion
+const DeletedTopic = "_deleted-topic_"
+
+// TopicConfig represent parameter of the Topic
+type TopicConfig struct {
+	SchemaSettings *SchemaSettings
+	Labels         map[string]string
+	Description    string
+}
+
+// TopicConfigToUpdate is updatable parameter for the existed Topic.
+// nil fields are not updated, set an empty map to remove all labels
+// and set an empty SchemaSettings to detach the schema.
+type TopicConfigToUpdate struct {
+	SchemaSettings *SchemaSettings
+	Labels         map[string]string
+	Description    *string
 }
 
 func newTopic(id string, s service) *Topic {
@@ -43,48 +75,55 @@ func (p *PublishResult) Get(ctx context.Context) (string, error) {
 	case <-p.done:
 		return p.msgID, p.err
 	case <-ctx.Done():
-		return "", p.err
+		return "", ctx.Err()
 	}
 }
 
+// set the result and notify to Get
+func (p *PublishResult) set(msgID string, err error) {
+	p.msgID = msgID
+	p.err = err
+	close(p.done)
+}
+
 // Exists return whether the topic exists on the server.
 func (t *Topic) Exists(ctx context.Context) (bool, error) {
 	return t.s.topicExists(ctx, t.ID)
 }
 
-// Delete deletes the topic
-func (t *Topic) Delete(ctx context.Context) error {
-	return t.s.deleteTopic(ctx, t.ID)
+// Config returns the current configuration for the topic
+func (t *Topic) Config(ctx context.Context) (*TopicConfig, error) {
+	return t.s.getTopicConfig(ctx, t.ID)
 }
 
-// Subscriptions returns subscription list matched topic
-func (t *Topic) Subscriptions(ctx context.Context) ([]*Subscription, error) {
-	subIDs, err := t.s.listTopicSubscriptions(ctx, t.ID)
-	if err != nil {
-		return nil, err
-	}
-
-	subs := []*Subscription{}
-	for _, id := range subIDs {
-		subs = append(subs, newSubscription(id, t.s))
-	}
-	return subs, nil
+// Update updates the labels and the description of the topic, and returns updated configuration
+func (t *Topic) Update(ctx context.Context, cfg TopicConfigToUpdate) (*TopicConfig, error) {
+	return t.s.updateTopic(ctx, t.ID, cfg)
 }
 
-// Publish asynchronously send message, and return immediate PublishResult
-func (t *Topic) Publish(ctx context.Context, msg *Message) *PublishResult {
-	pr := &PublishResult{
-		done: make(chan struct{}),
-	}
+// Delete deletes the topic.
+// the subscriptions of the topic are detached, the topic of them becomes DeletedTopic.
+func (t *Topic) Delete(ctx context.Context) error {
+	return t.s.deleteTopic(ctx, t.ID, false)
+}
 
-	go func() {
-		msgID, err := t.s.publishMessages(ctx, t.ID, msg)
-		pr.msgID = msgID
-		pr.err = err
-		close(pr.done)
-	}()
+// DeleteWithSubscriptions deletes the topic and the subscriptions of the topic
+func (t *Topic) DeleteWithSubscriptions(ctx context.Context) error {
+	return t.s.deleteTopic(ctx, t.ID, true)
+}
 
-	return pr
+// Subscriptions returns iterator over the subscriptions matched topic
+func (t *Topic) Subscriptions(ctx context.Context, opts ...ListOption) *SubscriptionIterator {
+	return &SubscriptionIterator{
+		it: &nameIterator{
+			ctx: ctx,
+			q:   newListQuery(opts),
+			fetch: func(ctx context.Context, q listQuery) ([]string, string, error) {
+				return t.s.listTopicSubscriptions(ctx, t.ID, q)
+			},
+		},
+		s: t.s,
+	}
 }
 
 // StatsDetail returns stats detail of the Topic
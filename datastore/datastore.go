@@ -19,6 +19,7 @@ type Datastore interface {
 	Get(key interface{}) (interface{}, error)
 	Delete(key interface{}) error
 	Dump() (map[interface{}]interface{}, error)
+	Close() error
 }
 
 // LoadDatastore load backend datastore from cnofiguration json file.
@@ -74,14 +75,16 @@ func SpecifyDump(d Datastore, key string) (map[interface{}]interface{}, error) {
 
 // Memory is datastore driver for "in memory"
 type Memory struct {
-	Store map[interface{}]interface{}
-	mu    sync.RWMutex
+	Store  map[interface{}]interface{}
+	leases map[string]memoryLease
+	mu     sync.RWMutex
 }
 
 // NewMemory create memory object
 func NewMemory(_ *Config) *Memory {
 	return &Memory{
-		Store: make(map[interface{}]interface{}),
+		Store:  make(map[interface{}]interface{}),
+		leases: make(map[string]memoryLease),
 	}
 }
 
@@ -115,12 +118,21 @@ func (m *Memory) Delete(key interface{}) error {
 	return nil
 }
 
-// Dump dump store values
+// Dump dump store values, returns a copy to iterate it while the push loops write the store
 func (m *Memory) Dump() (map[interface{}]interface{}, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	return m.Store, nil
+	res := make(map[interface{}]interface{}, len(m.Store))
+	for k, v := range m.Store {
+		res[k] = v
+	}
+	return res, nil
+}
+
+// Close is nothing to do on memory
+func (m *Memory) Close() error {
+	return nil
 }
 
 // Redis is datastore driver for redis
@@ -226,6 +238,11 @@ func (r *Redis) DumpPrefix(p string) (map[interface{}]interface{}, error) {
 	return res, nil
 }
 
+// Close release connection pool
+func (r *Redis) Close() error {
+	return r.Pool.Close()
+}
+
 // MySQL is MySQL datastore driver
 type MySQL struct {
 	Conn *sql.DB
@@ -324,6 +341,11 @@ func (m *MySQL) DumpPrefix(p string) (map[interface{}]interface{}, error) {
 	return m.convertRowsToMap(rows)
 }
 
+// Close close connection to the MySQL
+func (m *MySQL) Close() error {
+	return m.Conn.Close()
+}
+
 func (m *MySQL) convertRowsToMap(rows *sql.Rows) (map[interface{}]interface{}, error) {
 	res := make(map[interface{}]interface{}, 0)
 	for rows.Next() {
@@ -3,6 +3,7 @@ package datastore
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -134,3 +135,50 @@ func TestMemoryDelete(t *testing.T) {
 		}
 	}
 }
+
+// testLeaser checks the lease behavior common to the Leaser datastores
+func testLeaser(t *testing.T, l Leaser) {
+	ttl := 100 * time.Millisecond
+	cases := []struct {
+		owner  string
+		wait   time.Duration
+		expect bool
+	}{
+		{"a", 0, true},
+		// renew
+		{"a", 0, true},
+		// held by the other owner
+		{"b", 0, false},
+		// expired
+		{"b", 2 * ttl, true},
+		{"a", 0, false},
+	}
+	for i, c := range cases {
+		time.Sleep(c.wait)
+		got, err := l.AcquireLease("lease", c.owner, ttl)
+		if err != nil {
+			t.Fatalf("#%d: failed to acquire lease, got err %v", i, err)
+		}
+		if got != c.expect {
+			t.Errorf("#%d: want acquired %t, got %t", i, c.expect, got)
+		}
+	}
+
+	// the other owner can not release
+	if err := l.ReleaseLease("lease", "a"); err != nil {
+		t.Fatalf("failed to release lease, got err %v", err)
+	}
+	if got, _ := l.AcquireLease("lease", "a", ttl); got {
+		t.Errorf("want not acquired after released by the other owner")
+	}
+	if err := l.ReleaseLease("lease", "b"); err != nil {
+		t.Fatalf("failed to release lease, got err %v", err)
+	}
+	if got, _ := l.AcquireLease("lease", "a", ttl); !got {
+		t.Errorf("want acquired after released")
+	}
+}
+
+func TestMemoryLease(t *testing.T) {
+	testLeaser(t, NewMemory(nil))
+}
@@ -174,3 +174,9 @@ func TestMySQLDump(t *testing.T) {
 		}
 	}
 }
+
+func TestMySQLLease(t *testing.T) {
+	client := dummyMySQL(t)
+	clearTable(t, client.Conn)
+	testLeaser(t, client)
+}
@@ -54,3 +54,14 @@ func TestRedisSetAndGet(t *testing.T) {
 		}
 	}
 }
+
+func TestRedisLease(t *testing.T) {
+	client := dummyRedis(t)
+	conn := client.Pool.Get()
+	_, err := conn.Do("DEL", "lease")
+	conn.Close()
+	if err != nil {
+		t.Fatalf("failed to clear lease, got err %v", err)
+	}
+	testLeaser(t, client)
+}
@@ -0,0 +1,118 @@
+package datastore
+
+import (
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Leaser is the Datastore supporting the exclusive lease with the expiration,
+// the owners on the other processes share the lease through the datastore
+type Leaser interface {
+	// AcquireLease acquire the lease of the key, or renew it when the owner already holds it.
+	// returns false when the other owner holds the unexpired lease.
+	AcquireLease(key, owner string, ttl time.Duration) (bool, error)
+	// ReleaseLease release the lease of the key when the owner holds it
+	ReleaseLease(key, owner string) error
+}
+
+// memoryLease is the lease of the Memory
+type memoryLease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// AcquireLease acquire or renew the lease of the key
+func (m *Memory) AcquireLease(key, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := m.leases[key]; ok && l.owner != owner && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	if m.leases == nil {
+		m.leases = make(map[string]memoryLease)
+	}
+	m.leases[key] = memoryLease{owner: owner, expiresAt: now.Add(ttl)}
+	return true, nil
+}
+
+// ReleaseLease release the lease of the key held by the owner
+func (m *Memory) ReleaseLease(key, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.leases[key]; ok && l.owner == owner {
+		delete(m.leases, key)
+	}
+	return nil
+}
+
+// acquireLeaseScript set the owner with the expiration when the key is expired or held by the owner
+var acquireLeaseScript = redis.NewScript(1, `
+local v = redis.call("GET", KEYS[1])
+if v == false or v == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// releaseLeaseScript delete the key when held by the owner
+var releaseLeaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// AcquireLease acquire or renew the lease of the key, the expired key is removed by Redis
+func (r *Redis) AcquireLease(key, owner string, ttl time.Duration) (bool, error) {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	ms := int64(ttl / time.Millisecond)
+	if ms <= 0 {
+		ms = 1
+	}
+	return redis.Bool(acquireLeaseScript.Do(conn, key, owner, ms))
+}
+
+// ReleaseLease release the lease of the key held by the owner
+func (r *Redis) ReleaseLease(key, owner string) error {
+	conn := r.Pool.Get()
+	defer conn.Close()
+
+	_, err := releaseLeaseScript.Do(conn, key, owner)
+	return err
+}
+
+// mysqlNowNanos is the current time of the MySQL server in nanoseconds,
+// the expiration is compared by the clock of the database not to depend on the clocks of the processes
+const mysqlNowNanos = "CAST(UNIX_TIMESTAMP(NOW(6)) * 1000000000 AS SIGNED)"
+
+// AcquireLease acquire or renew the lease of the key in the "pubsub_lease" table.
+// the owner is replaced when expired, and the expiration is updated only when the owner holds it after that.
+func (m *MySQL) AcquireLease(key, owner string, ttl time.Duration) (bool, error) {
+	_, err := m.Conn.Exec(`INSERT INTO pubsub_lease (id, owner, expires_at) VALUES (?, ?, `+mysqlNowNanos+` + ?)
+		ON DUPLICATE KEY UPDATE
+		owner = IF(owner = VALUES(owner) OR expires_at < `+mysqlNowNanos+`, VALUES(owner), owner),
+		expires_at = IF(owner = VALUES(owner), VALUES(expires_at), expires_at)`,
+		key, owner, ttl.Nanoseconds())
+	if err != nil {
+		return false, err
+	}
+
+	var current string
+	if err := m.Conn.QueryRow("SELECT owner FROM pubsub_lease WHERE id=?", key).Scan(&current); err != nil {
+		return false, err
+	}
+	return current == owner, nil
+}
+
+// ReleaseLease release the lease of the key held by the owner
+func (m *MySQL) ReleaseLease(key, owner string) error {
+	_, err := m.Conn.Exec("DELETE FROM pubsub_lease WHERE id=? AND owner=?", key, owner)
+	return err
+}
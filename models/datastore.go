@@ -0,0 +1,33 @@
+package models
+
+import "github.com/pkg/errors"
+
+// CloseDatastore close all global datastore objects
+func CloseDatastore() error {
+	if globalTopics != nil {
+		if err := globalTopics.Close(); err != nil {
+			return errors.Wrap(err, "failed to close datastore topic")
+		}
+	}
+	if d := getGlobalSubscription(); d != nil {
+		if err := d.Close(); err != nil {
+			return errors.Wrap(err, "failed to close datastore subscription")
+		}
+	}
+	if globalMessage != nil {
+		if err := globalMessage.Close(); err != nil {
+			return errors.Wrap(err, "failed to close datastore message")
+		}
+	}
+	if d := getGlobalMessageStatus(); d != nil {
+		if err := d.Close(); err != nil {
+			return errors.Wrap(err, "failed to close datastore message status")
+		}
+	}
+	if globalSchemas != nil {
+		if err := globalSchemas.Close(); err != nil {
+			return errors.Wrap(err, "failed to close datastore schema")
+		}
+	}
+	return nil
+}
@@ -83,6 +83,11 @@ func (d *DatastoreMessage) Delete(key string) error {
 	return d.store.Delete(d.prefix(key))
 }
 
+// Close close the backend datastore
+func (d *DatastoreMessage) Close() error {
+	return d.store.Close()
+}
+
 func (d *DatastoreMessage) prefix(key string) string {
 	return "message_" + key
 }
@@ -174,6 +174,11 @@ func (d *DatastoreMessageStatus) collectByField(fn func(ms *MessageStatus) bool)
 	return res, nil
 }
 
+// Close close the backend datastore
+func (d *DatastoreMessageStatus) Close() error {
+	return d.store.Close()
+}
+
 func (d *DatastoreMessageStatus) prefix(key string) string {
 	return "message_status_" + key
 }
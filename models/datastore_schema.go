@@ -0,0 +1,108 @@
+package models
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+)
+
+// globalSchemas global Schema datastore
+var globalSchemas *DatastoreSchema
+
+// DatastoreSchema is adapter between actual datastore and datastore client
+type DatastoreSchema struct {
+	store datastore.Datastore
+}
+
+// NewDatastoreSchema create DatastoreSchema object
+func NewDatastoreSchema(cfg *datastore.Config) (*DatastoreSchema, error) {
+	d, err := datastore.LoadDatastore(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load datastore")
+	}
+	return &DatastoreSchema{
+		store: d,
+	}, nil
+}
+
+// InitDatastoreSchema initialize global datastore object
+func InitDatastoreSchema() error {
+	d, err := NewDatastoreSchema(datastore.GlobalConfig)
+	if err != nil {
+		return err
+	}
+	globalSchemas = d
+	return nil
+}
+
+func decodeRawSchema(r interface{}) (*SchemaRevisions, error) {
+	switch a := r.(type) {
+	case []byte:
+		return decodeGobSchema(a)
+	default:
+		return nil, ErrNotMatchTypeSchema
+	}
+}
+
+func decodeGobSchema(e []byte) (*SchemaRevisions, error) {
+	var res *SchemaRevisions
+	buf := bytes.NewReader(e)
+	if err := gob.NewDecoder(buf).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Get return item via datastore
+func (d *DatastoreSchema) Get(key string) (*SchemaRevisions, error) {
+	v, err := d.store.Get(d.prefix(key))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, ErrNotFoundEntry
+	}
+	return decodeRawSchema(v)
+}
+
+// List return all schema slice
+func (d *DatastoreSchema) List() ([]*SchemaRevisions, error) {
+	sources, err := datastore.SpecifyDump(d.store, d.prefix(""))
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*SchemaRevisions, 0, len(sources))
+	for _, v := range sources {
+		t, err := decodeRawSchema(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+// Set save item to datastore
+func (d *DatastoreSchema) Set(sr *SchemaRevisions) error {
+	v, err := datastore.EncodeGob(sr)
+	if err != nil {
+		return err
+	}
+	return d.store.Set(d.prefix(sr.Name), v)
+}
+
+// Delete delete item
+func (d *DatastoreSchema) Delete(key string) error {
+	return d.store.Delete(d.prefix(key))
+}
+
+// Close close the backend datastore
+func (d *DatastoreSchema) Close() error {
+	return d.store.Close()
+}
+
+func (d *DatastoreSchema) prefix(key string) string {
+	return "schema_" + key
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
@@ -148,6 +149,65 @@ func (d *DatastoreSubscription) Delete(key string) error {
 	return d.store.Delete(d.prefix(key))
 }
 
+// Close close the backend datastore
+func (d *DatastoreSubscription) Close() error {
+	return d.store.Close()
+}
+
 func (d *DatastoreSubscription) prefix(key string) string {
 	return "subscription_" + key
 }
+
+// AcquirePushLease acquire or renew the lease of the push loop of the subscription,
+// the datastore without the lease is always acquired because it is not shared by the processes
+func (d *DatastoreSubscription) AcquirePushLease(name, owner string, ttl time.Duration) (bool, error) {
+	l, ok := d.store.(datastore.Leaser)
+	if !ok {
+		return true, nil
+	}
+	return l.AcquireLease(d.pushLeaseKey(name), owner, ttl)
+}
+
+// ReleasePushLease release the lease of the push loop of the subscription held by the owner
+func (d *DatastoreSubscription) ReleasePushLease(name, owner string) error {
+	l, ok := d.store.(datastore.Leaser)
+	if !ok {
+		return nil
+	}
+	return l.ReleaseLease(d.pushLeaseKey(name), owner)
+}
+
+func (d *DatastoreSubscription) pushLeaseKey(name string) string {
+	return "push_lease_" + name
+}
+
+// GetPushHealth return the delivery state of the push endpoint, the zero value when not saved
+func (d *DatastoreSubscription) GetPushHealth(key string) (PushHealth, error) {
+	var h PushHealth
+	v, err := d.store.Get(d.pushHealthKey(key))
+	if err == datastore.ErrNotFoundEntry {
+		return h, nil
+	}
+	if err != nil || v == nil {
+		return h, err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		return h, ErrNotMatchTypeSubscription
+	}
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(&h)
+	return h, err
+}
+
+// SetPushHealth save the delivery state of the push endpoint
+func (d *DatastoreSubscription) SetPushHealth(key string, h PushHealth) error {
+	v, err := datastore.EncodeGob(h)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode gob")
+	}
+	return d.store.Set(d.pushHealthKey(key), v)
+}
+
+func (d *DatastoreSubscription) pushHealthKey(key string) string {
+	return "push_health_" + key
+}
@@ -98,6 +98,11 @@ func (d *DatastoreTopic) Delete(key string) error {
 	return d.store.Delete(d.prefix(key))
 }
 
+// Close close the backend datastore
+func (d *DatastoreTopic) Close() error {
+	return d.store.Close()
+}
+
 func (d *DatastoreTopic) prefix(key string) string {
 	return "topic_" + key
 }
@@ -5,6 +5,7 @@ import "github.com/pkg/errors"
 // topic errors
 var (
 	ErrAlreadyExistTopic = errors.New("already exist topic")
+	ErrInvalidTopicName  = errors.New("invalid topic name, reserved by the deleted topic")
 )
 
 // subscription errors
@@ -12,6 +13,36 @@ var (
 	ErrAlreadyExistSubscription = errors.New("already exist subscription")
 	ErrNotFoundAckID            = errors.New("not found message dependent to ack id")
 	ErrInvalidEndpoint          = errors.New("invalid endpoint URL format")
+	ErrInvalidPushEndpoint      = errors.New("push endpoint is not allowed by the server")
+	ErrInvalidPushAuth          = errors.New("invalid push auth, bearer with token, hmac with secret or oidc")
+	ErrInvalidPushFormat        = errors.New("invalid push format, wrapped, no_wrapper, cloudevents_binary, cloudevents_structured or batch")
+	ErrInvalidPushConcurrency   = errors.New("invalid push max concurrency, up to 100")
+	ErrInvalidPushBatchSize     = errors.New("invalid push batch size, up to 1000")
+	ErrInvalidPushTimeout       = errors.New("invalid push timeout, up to 10 minutes")
+	ErrInvalidRetention         = errors.New("invalid message retention, up to 7 days")
+	ErrInvalidFilter            = errors.New("invalid filter")
+	ErrSubscriptionDetached     = errors.New("subscription is detached from the topic")
+	ErrInvalidExport            = errors.New("invalid export config")
+	ErrExportDisabled           = errors.New("export is disabled, require the export root directory")
+	ErrExportSubscription       = errors.New("export subscription does not support push and pull")
+)
+
+// metadata errors
+var (
+	ErrInvalidLabel       = errors.New("invalid labels, key must match [a-z][a-z0-9_-]* and key or value up to 63 characters, up to 64 labels")
+	ErrInvalidDescription = errors.New("invalid description, up to 1024 characters")
+	ErrEmptyUpdateMask    = errors.New("empty update mask")
+	ErrInvalidUpdateMask  = errors.New("invalid update mask")
+)
+
+// schema errors
+var (
+	ErrAlreadyExistSchema    = errors.New("already exist schema")
+	ErrInvalidSchema         = errors.New("invalid schema definition")
+	ErrInvalidSchemaType     = errors.New("invalid schema type, json_schema or avro")
+	ErrInvalidSchemaSettings = errors.New("invalid schema settings")
+	ErrSchemaInUse           = errors.New("schema is used by the topic")
+	ErrSchemaViolation       = errors.New("message does not conform to the schema")
 )
 
 // message errors
@@ -29,6 +60,7 @@ var (
 	ErrNotMatchTypeMessageStatus = errors.New("not match type message status")
 	ErrNotMatchTypeSubscription  = errors.New("not match type subscription")
 	ErrNotMatchTypeTopic         = errors.New("not match type topic")
+	ErrNotMatchTypeSchema        = errors.New("not match type schema")
 	ErrNotSupportOperation       = errors.New("not support operation")
 	ErrNotSupportDriver          = errors.New("not support driver")
 )
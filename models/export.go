@@ -0,0 +1,466 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/stats"
+)
+
+// ExportFormat is the file format of the export subscription
+type ExportFormat string
+
+// Export file formats
+const (
+	// ExportFormatJSONLines writes an ExportRecord per line in JSON, it is the default
+	ExportFormatJSONLines ExportFormat = "jsonl"
+	// ExportFormatAvro writes the ExportRecords in the Avro object container file
+	ExportFormatAvro ExportFormat = "avro"
+)
+
+// export variables
+const (
+	DefaultExportMaxBytes         = 100 << 20
+	DefaultExportMaxDuration      = 5 * time.Minute
+	MaxExportMaxDuration          = 24 * time.Hour
+	DefaultExportFilenameTemplate = "{subscription}-{timestamp}-{seq}.{ext}"
+)
+
+// ExportAvroSchema is the Avro schema of the ExportRecord
+const ExportAvroSchema = `{"type": "record", "name": "ExportRecord", "namespace": "com.github.takashabe.gopubsub", "fields": [` +
+	`{"name": "message_id", "type": "string"}, ` +
+	`{"name": "subscription", "type": "string"}, ` +
+	`{"name": "publish_time", "type": {"type": "long", "logicalType": "timestamp-micros"}}, ` +
+	`{"name": "attributes", "type": {"type": "map", "values": "string"}}, ` +
+	`{"name": "data", "type": "bytes"}]}`
+
+// avroMagic is the header of the Avro object container file
+var avroMagic = []byte{'O', 'b', 'j', 1}
+
+// Export is the config of the export subscription, which writes the messages to the rotating local files
+// instead of the push and the pull
+type Export struct {
+	// Directory is the directory of the files, relative to the export root
+	Directory string
+	// Format is the file format, empty is ExportFormatJSONLines
+	Format ExportFormat
+	// FilenameTemplate is the file name with "{subscription}", "{topic}", "{timestamp}", "{seq}" and "{ext}",
+	// empty is DefaultExportFilenameTemplate
+	FilenameTemplate string
+	// MaxBytes and MaxDuration rotate the file, 0 is the default
+	MaxBytes    int64
+	MaxDuration time.Duration
+}
+
+// validate returns error when the export config is invalid
+func (e *Export) validate() error {
+	if e == nil {
+		return nil
+	}
+	switch e.Format {
+	case "", ExportFormatJSONLines, ExportFormatAvro:
+	default:
+		return errors.Wrapf(ErrInvalidExport, "unknown format %q", e.Format)
+	}
+	if e.MaxBytes < 0 || e.MaxDuration < 0 || e.MaxDuration > MaxExportMaxDuration {
+		return errors.Wrap(ErrInvalidExport, "invalid rotation")
+	}
+	if t := e.FilenameTemplate; strings.ContainsAny(t, `/\`) || t == "." || t == ".." {
+		return errors.Wrap(ErrInvalidExport, "filename template must not contain the directory")
+	}
+	if _, err := exportDirectory(e.Directory); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (e *Export) format() ExportFormat {
+	if len(e.Format) == 0 {
+		return ExportFormatJSONLines
+	}
+	return e.Format
+}
+
+func (e *Export) maxBytes() int64 {
+	if e.MaxBytes <= 0 {
+		return DefaultExportMaxBytes
+	}
+	return e.MaxBytes
+}
+
+func (e *Export) maxDuration() time.Duration {
+	if e.MaxDuration <= 0 {
+		return DefaultExportMaxDuration
+	}
+	return e.MaxDuration
+}
+
+func (e *Export) filenameTemplate() string {
+	if len(e.FilenameTemplate) == 0 {
+		return DefaultExportFilenameTemplate
+	}
+	return e.FilenameTemplate
+}
+
+var (
+	exportRootMu sync.RWMutex
+	exportRoot   string
+)
+
+// SetExportRoot set the root directory of the export subscriptions, the empty root disables the export
+func SetExportRoot(dir string) {
+	exportRootMu.Lock()
+	defer exportRootMu.Unlock()
+	exportRoot = dir
+}
+
+// exportDirectory returns the directory under the export root, the directory can not escape from the root
+func exportDirectory(dir string) (string, error) {
+	exportRootMu.RLock()
+	root := exportRoot
+	exportRootMu.RUnlock()
+
+	if len(root) == 0 {
+		return "", ErrExportDisabled
+	}
+	return filepath.Join(root, filepath.Clean("/"+dir)), nil
+}
+
+// ExportRecord is a message written by the export subscription
+type ExportRecord struct {
+	MessageID    string            `json:"message_id"`
+	Subscription string            `json:"subscription"`
+	PublishTime  time.Time         `json:"publish_time"`
+	Attributes   map[string]string `json:"attributes"`
+	Data         []byte            `json:"data"`
+}
+
+func newExportRecord(msg *Message, sub *Subscription) ExportRecord {
+	return ExportRecord{
+		MessageID:    msg.ID,
+		Subscription: sub.Name,
+		PublishTime:  msg.PublishedAt,
+		Attributes:   msg.Attributes,
+		Data:         msg.Data,
+	}
+}
+
+// exportWriter writes the messages of a subscription to the current file, and rotates it
+type exportWriter struct {
+	config Export
+	dir    string
+
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	seq      int
+	// opened is the number of the files created by the writer
+	opened int
+	// sync is the sync marker of the current Avro file
+	sync [16]byte
+}
+
+// exportWriters keep the writers of the export subscriptions running in this process
+var exportWriters = struct {
+	sync.Mutex
+	m map[string]*exportWriter
+}{m: make(map[string]*exportWriter)}
+
+// getExportWriter returns the writer of the subscription, the writer is renewed when the config is changed
+func getExportWriter(s *Subscription) (*exportWriter, error) {
+	exportWriters.Lock()
+	defer exportWriters.Unlock()
+
+	if w, ok := exportWriters.m[s.Name]; ok {
+		if reflect.DeepEqual(w.config, *s.ExportConfig) {
+			return w, nil
+		}
+		w.close()
+	}
+	dir, err := exportDirectory(s.ExportConfig.Directory)
+	if err != nil {
+		return nil, err
+	}
+	w := &exportWriter{
+		config: *s.ExportConfig,
+		dir:    dir,
+	}
+	exportWriters.m[s.Name] = w
+	return w, nil
+}
+
+// closeExportWriter close the current file of the subscription
+func closeExportWriter(name string) error {
+	exportWriters.Lock()
+	defer exportWriters.Unlock()
+
+	w, ok := exportWriters.m[name]
+	if !ok {
+		return nil
+	}
+	delete(exportWriters.m, name)
+	return w.close()
+}
+
+func (w *exportWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	w.size = 0
+	return errors.Wrap(err, "failed to close export file")
+}
+
+// rotateIfExpired close the current file opened before MaxDuration
+func (w *exportWriter) rotateIfExpired(now time.Time) error {
+	if w.file != nil && now.Sub(w.openedAt) >= w.config.maxDuration() {
+		return w.close()
+	}
+	return nil
+}
+
+// filename returns the file name of the template
+func (w *exportWriter) filename(sub *Subscription, now time.Time) string {
+	ext := "jsonl"
+	if w.config.format() == ExportFormatAvro {
+		ext = "avro"
+	}
+	return strings.NewReplacer(
+		"{subscription}", sub.Name,
+		"{topic}", sub.TopicID,
+		"{timestamp}", now.UTC().Format("20060102T150405Z"),
+		"{seq}", strconv.Itoa(w.seq),
+		"{ext}", ext,
+	).Replace(w.config.filenameTemplate())
+}
+
+// open create the new file not overwriting the existing files, and write the header
+func (w *exportWriter) open(sub *Subscription, now time.Time) error {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		return errors.Wrap(err, "failed to create export directory")
+	}
+	var (
+		f   *os.File
+		err error
+	)
+	for i := 0; i < 1000; i++ {
+		name := w.filename(sub, now)
+		if filepath.Base(name) != name {
+			return errors.Wrapf(ErrInvalidExport, "invalid file name %q", name)
+		}
+		path := filepath.Join(w.dir, name)
+		w.seq++
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to create export file")
+	}
+	w.file = f
+	w.size = 0
+	w.openedAt = now
+	w.opened++
+
+	if w.config.format() == ExportFormatAvro {
+		if _, err := rand.Read(w.sync[:]); err != nil {
+			return errors.Wrap(err, "failed to generate avro sync marker")
+		}
+		if err := w.writeSync(avroHeader(w.sync)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write appends the messages to the file and fsync it, returns the written bytes.
+// the file is closed at the failure, and the next write creates the new file.
+func (w *exportWriter) write(msgs []*Message, sub *Subscription, now time.Time) (int, error) {
+	var (
+		b   []byte
+		err error
+	)
+	if w.config.format() == ExportFormatAvro {
+		b, err = encodeAvroBlock(msgs, sub)
+	} else {
+		b, err = encodeJSONLines(msgs, sub)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if w.file != nil && w.size+int64(len(b)) > w.config.maxBytes() {
+		if err := w.close(); err != nil {
+			return 0, err
+		}
+	}
+	if w.file == nil {
+		if err := w.open(sub, now); err != nil {
+			w.close()
+			return 0, err
+		}
+	}
+	if err := w.writeSync(b); err != nil {
+		w.close()
+		return 0, err
+	}
+	if w.config.format() == ExportFormatAvro {
+		// the sync marker of the block
+		if err := w.writeSync(w.sync[:]); err != nil {
+			w.close()
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// writeSync write b and fsync the file
+func (w *exportWriter) writeSync(b []byte) error {
+	n, err := w.file.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "failed to write export file")
+	}
+	return errors.Wrap(w.file.Sync(), "failed to sync export file")
+}
+
+func encodeJSONLines(msgs []*Message, sub *Subscription) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, msg := range msgs {
+		if err := enc.Encode(newExportRecord(msg, sub)); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// avroWriter is the Avro binary encoder
+type avroWriter struct {
+	bytes.Buffer
+}
+
+func (w *avroWriter) writeLong(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	// zig-zag encoding same as the Avro
+	n := binary.PutVarint(b[:], v)
+	w.Write(b[:n])
+}
+
+func (w *avroWriter) writeBytes(b []byte) {
+	w.writeLong(int64(len(b)))
+	w.Write(b)
+}
+
+func (w *avroWriter) writeString(s string) {
+	w.writeBytes([]byte(s))
+}
+
+func (w *avroWriter) writeMap(m map[string][]byte) {
+	if len(m) > 0 {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.writeLong(int64(len(keys)))
+		for _, k := range keys {
+			w.writeString(k)
+			w.writeBytes(m[k])
+		}
+	}
+	w.writeLong(0)
+}
+
+// avroHeader returns the header of the object container file
+func avroHeader(sync [16]byte) []byte {
+	var w avroWriter
+	w.Write(avroMagic)
+	w.writeMap(map[string][]byte{
+		"avro.schema": []byte(ExportAvroSchema),
+		"avro.codec":  []byte("null"),
+	})
+	w.Write(sync[:])
+	return w.Bytes()
+}
+
+// encodeAvroBlock returns the data block of the messages without the sync marker
+func encodeAvroBlock(msgs []*Message, sub *Subscription) ([]byte, error) {
+	var records avroWriter
+	for _, msg := range msgs {
+		r := newExportRecord(msg, sub)
+		records.writeString(r.MessageID)
+		records.writeString(r.Subscription)
+		records.writeLong(r.PublishTime.UnixNano() / int64(time.Microsecond))
+		attr := make(map[string][]byte, len(r.Attributes))
+		for k, v := range r.Attributes {
+			attr[k] = []byte(v)
+		}
+		records.writeMap(attr)
+		records.writeBytes(r.Data)
+	}
+
+	var block avroWriter
+	block.writeLong(int64(len(msgs)))
+	block.writeLong(int64(records.Len()))
+	block.Write(records.Bytes())
+	return block.Bytes(), nil
+}
+
+// Export writes the readable messages to the file of the export subscription, and acks them after the file is synced.
+// the failed messages are redelivered after the ack deadline.
+func (s *Subscription) Export(size int) (SentState, error) {
+	if s.Detached {
+		return notSent, ErrSubscriptionDetached
+	}
+	if s.ExportConfig == nil {
+		return notSent, errors.Wrap(ErrInvalidExport, "not export subscription")
+	}
+	if err := s.expireMessages(); err != nil {
+		return notSent, err
+	}
+	w, err := getExportWriter(s)
+	if err != nil {
+		return notSent, err
+	}
+	if err := w.rotateIfExpired(time.Now()); err != nil {
+		return notSent, err
+	}
+
+	msgs, err := s.Message.CollectReadableMessage(size)
+	if err != nil {
+		// empty message is non error
+		if errors.Cause(err) == ErrEmptyMessage {
+			return notSent, nil
+		}
+		return notSent, err
+	}
+	msgs, ackIDs, err := s.deliverMessages(msgs)
+	if err != nil {
+		return notSent, err
+	}
+
+	opened := w.opened
+	n, err := w.write(msgs, s, time.Now())
+	if err != nil {
+		return sentFailed, err
+	}
+	if err := s.Ack(ackIDs...); err != nil {
+		return sentFailed, err
+	}
+	stats.GetSubscriptionAdapter().ExportProgress(s.Name, w.opened-opened, n, len(msgs))
+	return sentSucceed, nil
+}
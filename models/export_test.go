@@ -0,0 +1,277 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func setupExportRoot(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "pubsub-export")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	SetExportRoot(dir)
+	return dir
+}
+
+func teardownExportRoot(dir string) {
+	SetExportRoot("")
+	os.RemoveAll(dir)
+}
+
+// setupExportSubscription returns the export subscription without the loop to export manually
+func setupExportSubscription(t *testing.T, name string, e *Export) *Subscription {
+	sub := setupSubscription(t, name, "A")
+	sub.ExportConfig = e
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	return sub
+}
+
+func readExportFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatalf("failed to list export files, got err %v", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestExportValidate(t *testing.T) {
+	root := setupExportRoot(t)
+	defer teardownExportRoot(root)
+
+	cases := []struct {
+		input  *Export
+		expect error
+	}{
+		{nil, nil},
+		{&Export{Directory: "archive", Format: ExportFormatAvro, MaxBytes: 1024, MaxDuration: time.Minute}, nil},
+		{&Export{Directory: "../../escape"}, nil},
+		{&Export{Format: "csv"}, ErrInvalidExport},
+		{&Export{MaxBytes: -1}, ErrInvalidExport},
+		{&Export{MaxDuration: MaxExportMaxDuration + time.Second}, ErrInvalidExport},
+		{&Export{FilenameTemplate: "../{seq}.jsonl"}, ErrInvalidExport},
+	}
+	for i, c := range cases {
+		if err := c.input.validate(); errors.Cause(err) != c.expect {
+			t.Errorf("#%d: want error %v, got %v", i, c.expect, err)
+		}
+	}
+
+	// the directory is kept under the root
+	dir, err := exportDirectory("../../escape")
+	if err != nil || dir != filepath.Join(root, "escape") {
+		t.Errorf("want directory under the root, got %s and err %v", dir, err)
+	}
+
+	SetExportRoot("")
+	if err := (&Export{}).validate(); err != ErrExportDisabled {
+		t.Errorf("want error %v, got %v", ErrExportDisabled, err)
+	}
+}
+
+func TestExportJSONLines(t *testing.T) {
+	root := setupExportRoot(t)
+	defer teardownExportRoot(root)
+	setupDatastore(t)
+	setupDummyTopics(t)
+
+	// rotate every write
+	sub := setupExportSubscription(t, "export-jsonl", &Export{
+		Directory:        "jsonl",
+		FilenameTemplate: "{topic}-{subscription}-{seq}.{ext}",
+		MaxBytes:         1,
+	})
+	defer closeExportWriter(sub.Name)
+	for _, data := range []string{"a", "b", "c"} {
+		publishMessage(t, "A", data, map[string]string{"key": data})
+	}
+	sub = mustGetSubscription(t, sub.Name)
+
+	for i := 0; i < 2; i++ {
+		if state, err := sub.Export(2); state != sentSucceed || err != nil {
+			t.Fatalf("#%d: want state %s, got %s and err %v", i, sentSucceed, state, err)
+		}
+	}
+	if state, err := sub.Export(2); state != notSent || err != nil {
+		t.Errorf("want state %s, got %s and err %v", notSent, state, err)
+	}
+
+	// acked after written
+	if peeked, err := sub.Message.Peek(); err != nil || len(peeked) != 0 {
+		t.Errorf("want no message, got %v and err %v", peeked, err)
+	}
+	files := readExportFiles(t, filepath.Join(root, "jsonl"))
+	if len(files) != 2 || filepath.Base(files[0]) != "A-export-jsonl-0.jsonl" {
+		t.Fatalf("want 2 files, got %v", files)
+	}
+	var data []string
+	for i, expect := range []int{2, 1} {
+		b, err := ioutil.ReadFile(files[i])
+		if err != nil {
+			t.Fatalf("#%d: failed to read file, got err %v", i, err)
+		}
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		if len(lines) != expect {
+			t.Errorf("#%d: want %d lines, got %q", i, expect, lines)
+		}
+		for _, line := range lines {
+			var r ExportRecord
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatalf("#%d: failed to unmarshal line, got err %v", i, err)
+			}
+			if r.Subscription != sub.Name || r.Attributes["key"] != string(r.Data) {
+				t.Errorf("#%d: want record of the message, got %s", i, line)
+			}
+			data = append(data, string(r.Data))
+		}
+	}
+	sort.Strings(data)
+	if got := strings.Join(data, ","); got != "a,b,c" {
+		t.Errorf("want exported a,b,c, got %s", got)
+	}
+
+	// pull and push are not supported
+	if _, err := sub.Pull(1); err != ErrExportSubscription {
+		t.Errorf("want error %v, got %v", ErrExportSubscription, err)
+	}
+	if err := sub.SetPushConfig("http://localhost:8080", nil, PushOptions{}); err != ErrExportSubscription {
+		t.Errorf("want error %v, got %v", ErrExportSubscription, err)
+	}
+}
+
+func TestExportAvro(t *testing.T) {
+	root := setupExportRoot(t)
+	defer teardownExportRoot(root)
+	setupDatastore(t)
+	setupDummyTopics(t)
+
+	sub := setupExportSubscription(t, "export-avro", &Export{Format: ExportFormatAvro})
+	publishMessage(t, "A", "a", map[string]string{"key": "a"})
+	publishMessage(t, "A", "b", nil)
+	sub = mustGetSubscription(t, sub.Name)
+	for i := 0; i < 2; i++ {
+		if state, err := sub.Export(1); state != sentSucceed || err != nil {
+			t.Fatalf("#%d: want state %s, got %s and err %v", i, sentSucceed, state, err)
+		}
+	}
+	if err := closeExportWriter(sub.Name); err != nil {
+		t.Fatalf("failed to close export writer, got err %v", err)
+	}
+
+	files := readExportFiles(t, root)
+	if len(files) != 1 || !strings.HasSuffix(files[0], "-0.avro") {
+		t.Fatalf("want an avro file, got %v", files)
+	}
+	b, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("failed to read file, got err %v", err)
+	}
+
+	// object container file with the blocks of a record
+	r := &avroReader{buf: b}
+	if magic, err := r.read(4, "magic"); err != nil || !bytes.Equal(magic, avroMagic) {
+		t.Fatalf("want avro magic, got %q and err %v", magic, err)
+	}
+	meta := map[string]string{}
+	for {
+		n, err := r.readLong("meta")
+		if err != nil {
+			t.Fatalf("failed to read metadata, got err %v", err)
+		}
+		if n == 0 {
+			break
+		}
+		for i := int64(0); i < n; i++ {
+			kl, _ := r.readLong("key")
+			k, _ := r.read(int(kl), "key")
+			vl, _ := r.readLong("value")
+			v, _ := r.read(int(vl), "value")
+			meta[string(k)] = string(v)
+		}
+	}
+	if meta["avro.schema"] != ExportAvroSchema || meta["avro.codec"] != "null" {
+		t.Fatalf("want avro metadata, got %v", meta)
+	}
+	schema, err := compileAvroSchema(meta["avro.schema"])
+	if err != nil {
+		t.Fatalf("failed to compile schema, got err %v", err)
+	}
+	sync, _ := r.read(16, "sync")
+
+	blocks := 0
+	for len(r.buf) > 0 {
+		count, _ := r.readLong("count")
+		size, _ := r.readLong("size")
+		data, err := r.read(int(size), "data")
+		if err != nil {
+			t.Fatalf("#%d: failed to read block, got err %v", blocks, err)
+		}
+		records := &avroReader{buf: data}
+		for i := int64(0); i < count; i++ {
+			if err := schema.readBinary(records, "$"); err != nil {
+				t.Fatalf("#%d: want valid record, got err %v", blocks, err)
+			}
+		}
+		if len(records.buf) != 0 {
+			t.Errorf("#%d: want no remaining data, got %d bytes", blocks, len(records.buf))
+		}
+		if marker, _ := r.read(16, "sync"); !bytes.Equal(marker, sync) {
+			t.Fatalf("#%d: want sync marker, got %x", blocks, marker)
+		}
+		blocks++
+	}
+	if blocks != 2 {
+		t.Errorf("want 2 blocks, got %d", blocks)
+	}
+}
+
+func TestExportLoop(t *testing.T) {
+	root := setupExportRoot(t)
+	defer teardownExportRoot(root)
+	setupDatastore(t)
+	setupDummyTopics(t)
+
+	sub, err := NewSubscription("export-loop", "A", 10, "", nil, SubscriptionOptions{
+		Export: &Export{MaxDuration: time.Second},
+	})
+	if err != nil {
+		t.Fatalf("failed to create export subscription, got err %v", err)
+	}
+	publishMessage(t, "A", "test", nil)
+
+	// the loop wakes up at the published message
+	deadline := time.Now().Add(time.Second)
+	for {
+		files := readExportFiles(t, root)
+		if len(files) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want exported file, got %v", files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := sub.Detach(); err != nil {
+		t.Fatalf("failed to detach, got err %v", err)
+	}
+	waitPushRunningDisable(t, "export-loop")
+
+	if _, err := NewSubscription("export-push", "A", 10, "http://localhost:8080", nil, SubscriptionOptions{
+		Export: &Export{},
+	}); err != ErrExportSubscription {
+		t.Errorf("want error %v, got %v", ErrExportSubscription, err)
+	}
+}
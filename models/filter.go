@@ -0,0 +1,305 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is the message attribute filter of the Subscription.
+//
+// The syntax is below, operators are case-sensitive:
+//
+//	attributes:key                      the attribute exists
+//	attributes.key = "value"            the attribute equals the value
+//	attributes.key != "value"           the attribute not exists or not equals the value
+//	hasPrefix(attributes.key, "prefix") the attribute starts with the prefix
+//	NOT expr, expr AND expr, expr OR expr, (expr)
+type Filter struct {
+	root filterNode
+}
+
+// filterNode is evaluated node of the filter expression
+type filterNode func(attr map[string]string) bool
+
+// ParseFilter returns parsed Filter, an empty expression matches all messages
+func ParseFilter(expr string) (*Filter, error) {
+	if len(strings.TrimSpace(expr)) == 0 {
+		return &Filter{}, nil
+	}
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q", p.peek().value)
+	}
+	return &Filter{root: root}, nil
+}
+
+// Match returns whether the attributes satisfy the filter
+func (f *Filter) Match(attr map[string]string) bool {
+	if f == nil || f.root == nil {
+		return true
+	}
+	return f.root(attr)
+}
+
+type filterTokenKind int
+
+const (
+	_ filterTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenSymbol
+)
+
+type filterToken struct {
+	kind  filterTokenKind
+	value string
+}
+
+func isFilterIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-'
+}
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '!' && i+1 < len(rs) && rs[i+1] == '=':
+			tokens = append(tokens, filterToken{tokenSymbol, "!="})
+			i += 2
+		case strings.ContainsRune("():.,=", r):
+			tokens = append(tokens, filterToken{tokenSymbol, string(r)})
+			i++
+		case r == '"':
+			j := i + 1
+			for ; j < len(rs) && rs[j] != '"'; j++ {
+				if rs[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(rs) {
+				return nil, errors.Wrap(ErrInvalidFilter, "unterminated string")
+			}
+			s, err := strconv.Unquote(string(rs[i : j+1]))
+			if err != nil {
+				return nil, errors.Wrapf(ErrInvalidFilter, "invalid string %s", string(rs[i:j+1]))
+			}
+			tokens = append(tokens, filterToken{tokenString, s})
+			i = j + 1
+		case isFilterIdentRune(r):
+			j := i
+			for ; j < len(rs) && isFilterIdentRune(rs[j]); j++ {
+			}
+			tokens = append(tokens, filterToken{tokenIdent, string(rs[i:j])})
+			i = j
+		default:
+			return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser is recursive descent parser for the filter expression
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) eof() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.eof() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept consume the token when matched the kind and the value
+func (p *filterParser) accept(kind filterTokenKind, value string) bool {
+	if t := p.peek(); t.kind == kind && t.value == value {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(kind filterTokenKind, value string) error {
+	if !p.accept(kind, value) {
+		return errors.Wrapf(ErrInvalidFilter, "want %q, got %q", value, p.peek().value)
+	}
+	return nil
+}
+
+func (p *filterParser) expectString() (string, error) {
+	t := p.next()
+	if t.kind != tokenString {
+		return "", errors.Wrapf(ErrInvalidFilter, "want string, got %q", t.value)
+	}
+	return t.value, nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenIdent, "OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(attr map[string]string) bool { return l(attr) || right(attr) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(tokenIdent, "AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(attr map[string]string) bool { return l(attr) && right(attr) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept(tokenIdent, "NOT") {
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(attr map[string]string) bool { return !n(attr) }, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	switch {
+	case p.accept(tokenSymbol, "("):
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenSymbol, ")"); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case p.accept(tokenIdent, "hasPrefix"):
+		if err := p.expect(tokenSymbol, "("); err != nil {
+			return nil, err
+		}
+		key, err := p.parseAttributeKey()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenSymbol, ","); err != nil {
+			return nil, err
+		}
+		prefix, err := p.expectString()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenSymbol, ")"); err != nil {
+			return nil, err
+		}
+		return func(attr map[string]string) bool {
+			v, ok := attr[key]
+			return ok && strings.HasPrefix(v, prefix)
+		}, nil
+
+	case p.accept(tokenIdent, "attributes"):
+		if p.accept(tokenSymbol, ":") {
+			key, err := p.parseKey()
+			if err != nil {
+				return nil, err
+			}
+			return func(attr map[string]string) bool {
+				_, ok := attr[key]
+				return ok
+			}, nil
+		}
+		if err := p.expect(tokenSymbol, "."); err != nil {
+			return nil, err
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case p.accept(tokenSymbol, "="):
+			value, err := p.expectString()
+			if err != nil {
+				return nil, err
+			}
+			return func(attr map[string]string) bool {
+				v, ok := attr[key]
+				return ok && v == value
+			}, nil
+		case p.accept(tokenSymbol, "!="):
+			value, err := p.expectString()
+			if err != nil {
+				return nil, err
+			}
+			return func(attr map[string]string) bool {
+				v, ok := attr[key]
+				return !ok || v != value
+			}, nil
+		default:
+			return nil, errors.Wrapf(ErrInvalidFilter, "want \"=\" or \"!=\", got %q", p.peek().value)
+		}
+
+	default:
+		return nil, errors.Wrapf(ErrInvalidFilter, "unexpected %q", p.peek().value)
+	}
+}
+
+// parseAttributeKey parse "attributes.key"
+func (p *filterParser) parseAttributeKey() (string, error) {
+	if err := p.expect(tokenIdent, "attributes"); err != nil {
+		return "", err
+	}
+	if err := p.expect(tokenSymbol, "."); err != nil {
+		return "", err
+	}
+	return p.parseKey()
+}
+
+// parseKey parse the identifier or the quoted key
+func (p *filterParser) parseKey() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent && t.kind != tokenString {
+		return "", errors.Wrapf(ErrInvalidFilter, "want attribute key, got %q", t.value)
+	}
+	return t.value, nil
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFilter(t *testing.T) {
+	attr := map[string]string{"env": "prod", "region": "asia-northeast1", "empty": ""}
+	cases := []struct {
+		input     string
+		expect    bool
+		expectErr error
+	}{
+		{``, true, nil},
+		{`attributes:env`, true, nil},
+		{`attributes:team`, false, nil},
+		{`attributes.env = "prod"`, true, nil},
+		{`attributes.env = "dev"`, false, nil},
+		{`attributes.env != "dev"`, true, nil},
+		{`attributes.team != "a"`, true, nil},
+		{`attributes."empty" = ""`, true, nil},
+		{`hasPrefix(attributes.region, "asia-")`, true, nil},
+		{`hasPrefix(attributes.team, "")`, false, nil},
+		{`NOT attributes:env`, false, nil},
+		{`attributes:team OR attributes.env = "prod"`, true, nil},
+		{`attributes:team AND attributes.env = "prod"`, false, nil},
+		{`attributes:env AND (attributes:team OR NOT attributes.region = "us")`, true, nil},
+		{`attributes.env = prod`, false, ErrInvalidFilter},
+		{`attributes.env = "prod`, false, ErrInvalidFilter},
+		{`(attributes:env`, false, ErrInvalidFilter},
+		{`attributes:env attributes:region`, false, ErrInvalidFilter},
+		{`data = "x"`, false, ErrInvalidFilter},
+	}
+	for i, c := range cases {
+		f, err := ParseFilter(c.input)
+		if errors.Cause(err) != c.expectErr {
+			t.Fatalf("#%d: want error %v, got %v", i, c.expectErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		if got := f.Match(attr); got != c.expect {
+			t.Errorf("#%d: want %t, got %t, filter=%s", i, c.expect, got, c.input)
+		}
+	}
+}
@@ -3,4 +3,11 @@ CREATE TABLE IF NOT EXISTS `pubsub` (
   `value` blob NOT NULL,
   PRIMARY KEY (`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+CREATE TABLE IF NOT EXISTS `pubsub_lease` (
+  `id` varchar(255) NOT NULL,
+  `owner` varchar(255) NOT NULL,
+  `expires_at` bigint NOT NULL,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 DELETE FROM `pubsub`;
+DELETE FROM `pubsub_lease`;
@@ -54,6 +54,7 @@ type MessageStatus struct {
 	AckDeadline    time.Duration
 	AckState       messageState
 	DeliveredAt    time.Time
+	DeliveryCount  int
 }
 
 func newMessageStatus(subID, msgID string, deadline time.Duration) *MessageStatus {
@@ -71,11 +72,22 @@ func makeMessageStatusID(subID, msgID string) string {
 	return fmt.Sprintf("%s-%s", subID, msgID)
 }
 
-// Deliver setting deliver state and new AckID
-func (ms *MessageStatus) Deliver(ackID string) {
+// Deliver setting deliver state, new AckID and the ack deadline
+func (ms *MessageStatus) Deliver(ackID string, deadline time.Duration) {
 	ms.AckState = stateDeliver
 	ms.AckID = ackID
+	ms.AckDeadline = deadline
 	ms.DeliveredAt = time.Now()
+	ms.DeliveryCount++
+}
+
+// ModifyDeadline set the ack deadline to the duration from now, zero makes the message readable immediately
+func (ms *MessageStatus) ModifyDeadline(d time.Duration) {
+	if d <= 0 {
+		ms.AckDeadline = 0
+		return
+	}
+	ms.AckDeadline = time.Since(ms.DeliveredAt) + d
 }
 
 // Save save MessageStatus to backend datastore
@@ -88,17 +100,17 @@ func (ms *MessageStatus) Delete() error {
 	return getGlobalMessageStatus().Delete(ms.ID)
 }
 
-// MessageStatusStore is holds and adapter for MessageStatus
+// MessageStatusStore is holds and adapter for MessageStatus.
+// the MessageStatus of the subscription are found by the SubscriptionID, they are not saved with the subscription
+// not to be overwritten by the concurrent updates of the subscription.
 type MessageStatusStore struct {
 	SubscriptionID string
-	Status         []string
 }
 
 // NewMessageStatusStore return created MessageStatusStore
 func NewMessageStatusStore(subID string) *MessageStatusStore {
 	return &MessageStatusStore{
 		SubscriptionID: subID,
-		Status:         make([]string, 0),
 	}
 }
 
@@ -108,23 +120,12 @@ func (mss *MessageStatusStore) NewMessageStatus(subID, msgID string, deadline ti
 	if err := ms.Save(); err != nil {
 		return nil, err
 	}
-	mss.Status = append(mss.Status, ms.ID)
 	return ms, nil
 }
 
 // CollectReadableMessage return readable messages
 func (mss *MessageStatusStore) CollectReadableMessage(size int) ([]*Message, error) {
-	// check size
-	storeLength := len(mss.Status)
-	if storeLength == 0 {
-		return nil, ErrEmptyMessage
-	}
-	if storeLength < size {
-		size = storeLength
-	}
-
-	// collect messages
-	msList, err := getGlobalMessageStatus().CollectByIDs(mss.Status...)
+	msList, err := mss.CollectAllMessages()
 	if err != nil {
 		return nil, err
 	}
@@ -156,8 +157,8 @@ func (mss *MessageStatusStore) CollectAllMessages() ([]*MessageStatus, error) {
 	return getGlobalMessageStatus().ListBySubscriptionID(mss.SubscriptionID)
 }
 
-// Deliver register AckID to message
-func (mss *MessageStatusStore) Deliver(msgID, ackID string) error {
+// Deliver register AckID and the ack deadline to message
+func (mss *MessageStatusStore) Deliver(msgID, ackID string, deadline time.Duration) error {
 	ms, err := getGlobalMessageStatus().FindBySubscriptionIDAndMessageID(mss.SubscriptionID, msgID)
 	if err != nil {
 		return err
@@ -165,7 +166,7 @@ func (mss *MessageStatusStore) Deliver(msgID, ackID string) error {
 	if ms.AckState == stateAck {
 		return ErrAlreadyReadMessage
 	}
-	ms.Deliver(ackID)
+	ms.Deliver(ackID, deadline)
 	return ms.Save()
 }
 
@@ -175,6 +176,42 @@ func (mss *MessageStatusStore) Ack(ackID string) error {
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to FindByAckID, AckID=%s", ackID))
 	}
+	return mss.release(ms)
+}
+
+// ExpireMessages release the messages published before the retention, returns number of released messages
+func (mss *MessageStatusStore) ExpireMessages(retention time.Duration) (int, error) {
+	return mss.ReleaseBefore(time.Now().Add(-retention))
+}
+
+// ReleaseBefore release the messages published before t, the zero t releases the all messages.
+// returns number of released messages.
+func (mss *MessageStatusStore) ReleaseBefore(t time.Time) (int, error) {
+	msList, err := mss.CollectAllMessages()
+	if err != nil {
+		return 0, err
+	}
+	released := 0
+	for _, ms := range msList {
+		m, err := globalMessage.Get(ms.MessageID)
+		if err != nil {
+			log.Printf("failed to get message, id=%s, error=%v", ms.MessageID, err)
+			continue
+		}
+		if !t.IsZero() && !m.PublishedAt.Before(t) {
+			continue
+		}
+		if err := mss.release(ms); err != nil {
+			return released, err
+		}
+		released++
+	}
+	return released, nil
+}
+
+// release remove the subscription from the Message and delete the MessageStatus.
+// the Message is deleted when all of the subscriptions released it.
+func (mss *MessageStatusStore) release(ms *MessageStatus) error {
 	m, err := globalMessage.Get(ms.MessageID)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("failed to get message, MessageID=%s", ms.MessageID))
@@ -198,6 +235,98 @@ func (mss *MessageStatusStore) Ack(ackID string) error {
 	return nil
 }
 
+// releaseAll release the all MessageStatus of the subscription, the MessageStatus of the lost Message is just deleted
+func (mss *MessageStatusStore) releaseAll() error {
+	msList, err := mss.CollectAllMessages()
+	if err != nil {
+		return err
+	}
+	for _, ms := range msList {
+		if _, err := globalMessage.Get(ms.MessageID); err != nil {
+			if err := ms.Delete(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mss.release(ms); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Message states of the PeekedMessage
+const (
+	PeekStateWaiting   = "waiting"
+	PeekStateDelivered = "delivered"
+)
+
+// PeekedMessage represent the Message not yet acked and the status, it is got without leasing the Message
+type PeekedMessage struct {
+	Message *Message
+	// State is PeekStateDelivered while the ack deadline is not expired, otherwise PeekStateWaiting
+	State         string
+	DeliveryCount int
+	DeliveredAt   time.Time
+	// AckDeadline is the time the delivery expires, zero when not delivered
+	AckDeadline time.Time
+}
+
+func newPeekedMessage(ms *MessageStatus, m *Message) *PeekedMessage {
+	p := &PeekedMessage{
+		Message:       m,
+		State:         PeekStateWaiting,
+		DeliveryCount: ms.DeliveryCount,
+	}
+	if ms.AckState == stateDeliver {
+		p.DeliveredAt = ms.DeliveredAt
+		p.AckDeadline = ms.DeliveredAt.Add(ms.AckDeadline)
+	}
+	if !ms.Readable() {
+		p.State = PeekStateDelivered
+	}
+	return p
+}
+
+// ByPeekedMessageID implements sort.Interface for []*PeekedMessage based on the MessageID
+type ByPeekedMessageID []*PeekedMessage
+
+func (a ByPeekedMessageID) Len() int           { return len(a) }
+func (a ByPeekedMessageID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a ByPeekedMessageID) Less(i, j int) bool { return a[i].Message.ID < a[j].Message.ID }
+
+// Peek returns the all messages not yet acked ordered by the MessageID, the status is not changed
+func (mss *MessageStatusStore) Peek() ([]*PeekedMessage, error) {
+	msList, err := mss.CollectAllMessages()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*PeekedMessage, 0, len(msList))
+	for _, ms := range msList {
+		m, err := globalMessage.Get(ms.MessageID)
+		if err != nil {
+			log.Printf("failed to get message, id=%s, error=%v", ms.MessageID, err)
+			continue
+		}
+		res = append(res, newPeekedMessage(ms, m))
+	}
+	sort.Sort(ByPeekedMessageID(res))
+	return res, nil
+}
+
+// PeekByID returns the message not yet acked specified by the MessageID, the status is not changed
+func (mss *MessageStatusStore) PeekByID(msgID string) (*PeekedMessage, error) {
+	ms, err := getGlobalMessageStatus().FindBySubscriptionIDAndMessageID(mss.SubscriptionID, msgID)
+	if err != nil {
+		return nil, err
+	}
+	m, err := globalMessage.Get(ms.MessageID)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to get message, MessageID=%s", ms.MessageID))
+	}
+	return newPeekedMessage(ms, m), nil
+}
+
 // FindByAckID return MessageStatus depends AckID
 func (mss *MessageStatusStore) FindByAckID(ackID string) (*MessageStatus, error) {
 	return getGlobalMessageStatus().FindByAckID(ackID)
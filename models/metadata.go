@@ -0,0 +1,87 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// label limits
+const (
+	MaxLabels            = 64
+	MaxLabelLength       = 63
+	MaxDescriptionLength = 1024
+)
+
+// labelKeyPattern is allowed format of the label key.
+// begin with lowercase letter, and consist of lowercase letters, digits, "_" and "-"
+var labelKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// Metadata is free-form metadata of the Topic and the Subscription
+type Metadata struct {
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+// Metadata update mask paths
+const (
+	MaskLabels      = "labels"
+	MaskDescription = "description"
+)
+
+// Validate returns error when the labels or the description exceed the limits
+func (m Metadata) Validate() error {
+	if len(m.Labels) > MaxLabels {
+		return ErrInvalidLabel
+	}
+	for k, v := range m.Labels {
+		if utf8.RuneCountInString(k) > MaxLabelLength || !labelKeyPattern.MatchString(k) {
+			return ErrInvalidLabel
+		}
+		if utf8.RuneCountInString(v) > MaxLabelLength {
+			return ErrInvalidLabel
+		}
+	}
+	if utf8.RuneCountInString(m.Description) > MaxDescriptionLength {
+		return ErrInvalidDescription
+	}
+	return nil
+}
+
+// MatchLabels returns whether the labels satisfy all of the selectors.
+// the selector is "key" to require existence of the key, or "key:value" to require the value.
+func (m Metadata) MatchLabels(selectors []string) bool {
+	for _, sel := range selectors {
+		kv := strings.SplitN(sel, ":", 2)
+		v, ok := m.Labels[kv[0]]
+		if !ok {
+			return false
+		}
+		if len(kv) == 2 && v != kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns copied Metadata which is overwritten the fields specified by the paths
+func (m Metadata) apply(src Metadata, paths []string) (Metadata, error) {
+	if len(paths) == 0 {
+		return m, ErrEmptyUpdateMask
+	}
+	dst := m
+	for _, p := range paths {
+		switch strings.TrimSpace(p) {
+		case MaskLabels:
+			dst.Labels = src.Labels
+		case MaskDescription:
+			dst.Description = src.Description
+		default:
+			return m, ErrInvalidUpdateMask
+		}
+	}
+	if err := dst.Validate(); err != nil {
+		return m, err
+	}
+	return dst, nil
+}
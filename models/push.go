@@ -3,16 +3,112 @@ package models
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// PushFormat is the payload format of the push request
+type PushFormat string
+
+// Push payload formats
+const (
+	// PushFormatWrapped sends the JSON PushRequest wrapped the message, it is the default
+	PushFormatWrapped PushFormat = "wrapped"
+	// PushFormatNoWrapper sends the raw message data, and the attributes as the HTTP headers
+	PushFormatNoWrapper PushFormat = "no_wrapper"
+	// PushFormatCloudEventsBinary sends the CloudEvents in the binary content mode
+	PushFormatCloudEventsBinary PushFormat = "cloudevents_binary"
+	// PushFormatCloudEventsStructured sends the CloudEvents in the structured content mode
+	PushFormatCloudEventsStructured PushFormat = "cloudevents_structured"
+	// PushFormatBatch sends the JSON PushBatchRequest wrapped up to BatchSize messages
+	PushFormatBatch PushFormat = "batch"
+)
+
+// push concurrency and batch variables
+const (
+	MaxPushConcurrency   = 100
+	DefaultPushBatchSize = 100
+	MaxPushBatchSize     = 1000
+)
+
+// HTTP headers of the no wrapper push request
+const (
+	HeaderPushMessageID       = "X-Pubsub-Message-Id"
+	HeaderPushSubscription    = "X-Pubsub-Subscription"
+	HeaderPushPublishTime     = "X-Pubsub-Publish-Time"
+	HeaderPushAttributePrefix = "X-Pubsub-Attribute-"
+)
 
-	"github.com/pkg/errors"
+// CloudEvents attributes of the push request
+const (
+	CloudEventsSpecVersion = "1.0"
+	CloudEventsType        = "com.github.takashabe.go-pubsub.message.published"
 )
 
+// cloudEventsReserved is the CloudEvents attributes, the message attributes with these names are not sent as the extensions
+var cloudEventsReserved = map[string]bool{
+	"specversion":     true,
+	"id":              true,
+	"source":          true,
+	"type":            true,
+	"time":            true,
+	"subject":         true,
+	"datacontenttype": true,
+	"dataschema":      true,
+	"data":            true,
+	"data_base64":     true,
+	"subscription":    true,
+}
+
+var cloudEventsExtensionName = regexp.MustCompile(`^[a-z0-9]{1,20}$`)
+
 // Push is represent push message in Subscription
 type Push struct {
 	Endpoint   *url.URL
 	Attributes *Attributes
+	Format     PushFormat
+	Auth       PushAuth
+
+	MaxConcurrency int
+	BatchSize      int
+	Timeout        time.Duration
+}
+
+// PushOptions is optional fields of the Push
+type PushOptions struct {
+	// Format is the payload format, empty is PushFormatWrapped
+	Format PushFormat
+	// Auth is the authentication of the push request, the zero value is no authentication
+	Auth PushAuth
+	// MaxConcurrency is the number of the in-flight push requests, 0 is 1
+	MaxConcurrency int
+	// BatchSize is the maximum messages per request of PushFormatBatch, 0 is DefaultPushBatchSize
+	BatchSize int
+	// Timeout overrides the timeout of the shared push HTTP client, 0 uses it
+	Timeout time.Duration
+}
+
+// validate returns error when the options are invalid
+func (o PushOptions) validate() error {
+	switch o.Format {
+	case "", PushFormatWrapped, PushFormatNoWrapper, PushFormatCloudEventsBinary, PushFormatCloudEventsStructured, PushFormatBatch:
+	default:
+		return ErrInvalidPushFormat
+	}
+	if o.MaxConcurrency < 0 || o.MaxConcurrency > MaxPushConcurrency {
+		return ErrInvalidPushConcurrency
+	}
+	if o.BatchSize < 0 || o.BatchSize > MaxPushBatchSize {
+		return ErrInvalidPushBatchSize
+	}
+	if o.Timeout < 0 || o.Timeout > MaxPushTimeout {
+		return ErrInvalidPushTimeout
+	}
+	return o.Auth.validate()
 }
 
 // PushRequest is represent a send push http request
@@ -21,8 +117,17 @@ type PushRequest struct {
 	SubscriptionID string
 }
 
+// PushBatchRequest is represent a send push http request of PushFormatBatch
+type PushBatchRequest struct {
+	Messages       []*Message
+	SubscriptionID string
+}
+
 // NewPush return initialized Push object
-func NewPush(endpoint string, attributes map[string]string) (*Push, error) {
+func NewPush(endpoint string, attributes map[string]string, opts PushOptions) (*Push, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 	if len(endpoint) == 0 {
 		return &Push{
 			Endpoint:   nil,
@@ -40,10 +145,20 @@ func NewPush(endpoint string, attributes map[string]string) (*Push, error) {
 		Attributes: &Attributes{
 			Attr: make(map[string]string),
 		},
+		Format: opts.Format,
+		Auth:   opts.Auth,
+
+		MaxConcurrency: opts.MaxConcurrency,
+		BatchSize:      opts.BatchSize,
+		Timeout:        opts.Timeout,
 	}
 	for k, v := range attributes {
 		p.Attributes.Set(k, v)
 	}
+	// validate the push config supported by the transport of the scheme
+	if _, err := p.transport(); err != nil {
+		return nil, err
+	}
 	return p, nil
 }
 
@@ -52,31 +167,200 @@ func (p *Push) HasValidEndpoint() bool {
 	return p.Endpoint != nil
 }
 
-func (p *Push) sendMessage(msg *Message, subID string) error {
+// concurrency returns the number of the in-flight push requests
+func (p *Push) concurrency() int {
+	if p.MaxConcurrency <= 0 {
+		return 1
+	}
+	return p.MaxConcurrency
+}
+
+// batchSize returns the number of the messages per request
+func (p *Push) batchSize() int {
+	if p.Format != PushFormatBatch {
+		return 1
+	}
+	if p.BatchSize <= 0 {
+		return DefaultPushBatchSize
+	}
+	return p.BatchSize
+}
+
+// newRequest returns the authorized push request of the messages in the push format,
+// the formats except PushFormatBatch send the first message only
+func (p *Push) newRequest(msgs []*Message, sub *Subscription) (*http.Request, error) {
+	var (
+		body   []byte
+		header http.Header
+		err    error
+	)
+	switch p.Format {
+	case PushFormatNoWrapper:
+		body, header, err = noWrapperPayload(msgs[0], sub)
+	case PushFormatCloudEventsBinary:
+		body, header, err = cloudEventsBinaryPayload(msgs[0], sub)
+	case PushFormatCloudEventsStructured:
+		body, header, err = cloudEventsStructuredPayload(msgs[0], sub)
+	case PushFormatBatch:
+		body, header, err = batchPayload(msgs, sub)
+	default:
+		body, header, err = wrappedPayload(msgs[0], sub)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", p.Endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	// the attributes are sent as the extra headers, except the headers of the format
+	if p.Attributes != nil {
+		for k, v := range p.Attributes.Dump() {
+			if len(header.Get(k)) == 0 {
+				header.Set(k, v)
+			}
+		}
+	}
+	req.Header = header
+	if err := p.Auth.authorize(req, body, sub); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func wrappedPayload(msg *Message, sub *Subscription) ([]byte, http.Header, error) {
 	body, err := json.Marshal(PushRequest{
 		Message:        msg,
-		SubscriptionID: subID,
+		SubscriptionID: sub.Name,
 	})
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=UTF-8")
+	return body, header, nil
+}
 
-	req, err := http.NewRequest("GET", p.Endpoint.String(), bytes.NewBuffer(body))
+func batchPayload(msgs []*Message, sub *Subscription) ([]byte, http.Header, error) {
+	body, err := json.Marshal(PushBatchRequest{
+		Messages:       msgs,
+		SubscriptionID: sub.Name,
+	})
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=UTF-8")
+	return body, header, nil
+}
+
+func noWrapperPayload(msg *Message, sub *Subscription) ([]byte, http.Header, error) {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set(HeaderPushMessageID, msg.ID)
+	header.Set(HeaderPushSubscription, sub.Name)
+	header.Set(HeaderPushPublishTime, msg.PublishedAt.UTC().Format(time.RFC3339Nano))
+	// the attributes are sent without changing the case of the key, the key and the value are percent-encoded
+	for k, v := range msg.Attributes {
+		header[HeaderPushAttributePrefix+percentEncodeHeaderKey(k)] = []string{percentEncodeHeader(v)}
+	}
+	return msg.Data, header, nil
+}
+
+// percentEncodeHeaderKey encode the characters not allowed in the HTTP header name and the percent
+func percentEncodeHeaderKey(k string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if c == '%' || !isHeaderTokenChar(c) {
+			fmt.Fprintf(&buf, "%%%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+// isHeaderTokenChar returns whether c is the token character of RFC 7230
+func isHeaderTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+// cloudEventsAttributes returns the CloudEvents context attributes and the extensions of the message
+func cloudEventsAttributes(msg *Message, sub *Subscription) map[string]string {
+	attr := map[string]string{
+		"specversion":     CloudEventsSpecVersion,
+		"id":              msg.ID,
+		"source":          "/topics/" + sub.TopicID,
+		"type":            CloudEventsType,
+		"time":            msg.PublishedAt.UTC().Format(time.RFC3339Nano),
+		"datacontenttype": "application/octet-stream",
+		"subscription":    sub.Name,
+	}
+	// the attributes not valid as the extension name are not sent
+	for k, v := range msg.Attributes {
+		if !cloudEventsReserved[k] && cloudEventsExtensionName.MatchString(k) {
+			attr[k] = v
+		}
 	}
+	return attr
+}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
+func cloudEventsBinaryPayload(msg *Message, sub *Subscription) ([]byte, http.Header, error) {
+	header := http.Header{}
+	for k, v := range cloudEventsAttributes(msg, sub) {
+		if k == "datacontenttype" {
+			header.Set("Content-Type", v)
+			continue
+		}
+		header.Set("ce-"+k, percentEncodeHeader(v))
+	}
+	return msg.Data, header, nil
+}
+
+// percentEncodeHeader encode the space, double quote, percent and non-printable characters of the header value
+func percentEncodeHeader(v string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == '%' {
+			fmt.Fprintf(&buf, "%%%02X", c)
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String()
+}
+
+func cloudEventsStructuredPayload(msg *Message, sub *Subscription) ([]byte, http.Header, error) {
+	event := map[string]interface{}{}
+	for k, v := range cloudEventsAttributes(msg, sub) {
+		event[k] = v
+	}
+	event["data_base64"] = msg.Data
+	body, err := json.Marshal(event)
 	if err != nil {
-		return errors.Wrapf(err, "failed to send push message")
+		return nil, nil, err
 	}
-	defer res.Body.Close()
+	header := http.Header{}
+	header.Set("Content-Type", "application/cloudevents+json; charset=UTF-8")
+	return body, header, nil
+}
 
-	switch res.StatusCode {
-	case 200, 201, 204, 102:
-		return nil
-	default:
-		return errors.Errorf("error send push message, got http status code '%d'", res.StatusCode)
+func (p *Push) sendMessage(msg *Message, sub *Subscription) error {
+	return p.sendMessages([]*Message{msg}, sub)
+}
+
+// sendMessages sends the messages in a request with the transport of the endpoint
+func (p *Push) sendMessages(msgs []*Message, sub *Subscription) error {
+	t, err := p.transport()
+	if err != nil {
+		return err
 	}
+	return t.Send(msgs, sub)
 }
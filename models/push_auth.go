@@ -0,0 +1,259 @@
+package models
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PushAuthType is the authentication type of the push request
+type PushAuthType string
+
+// Push authentication types
+const (
+	// PushAuthNone sends the push request without the authentication
+	PushAuthNone PushAuthType = ""
+	// PushAuthBearer sends the static token in the Authorization header
+	PushAuthBearer PushAuthType = "bearer"
+	// PushAuthHMAC sends the HMAC-SHA256 signature of the timestamp and the body
+	PushAuthHMAC PushAuthType = "hmac"
+	// PushAuthOIDC sends the JWT signed with the server key, verifiable with the JWKS of the server
+	PushAuthOIDC PushAuthType = "oidc"
+)
+
+// HTTP headers of the HMAC signed push request
+const (
+	HeaderPushTimestamp = "X-Pubsub-Timestamp"
+	HeaderPushSignature = "X-Pubsub-Signature"
+)
+
+// PushTokenLifetime is the lifetime of the OIDC token of the push request
+const PushTokenLifetime = time.Hour
+
+// DefaultPushTokenIssuer is the issuer of the OIDC token when not configured
+const DefaultPushTokenIssuer = "go-pubsub"
+
+// PushAuth is the authentication of the push request
+type PushAuth struct {
+	Type PushAuthType
+	// Token is the static token of PushAuthBearer
+	Token string
+	// Secret is the key of the signature of PushAuthHMAC
+	Secret string
+	// Audience is the "aud" claim of PushAuthOIDC, empty is the endpoint URL
+	Audience string
+}
+
+// validate returns error when the auth is invalid
+func (a PushAuth) validate() error {
+	switch a.Type {
+	case PushAuthNone, PushAuthOIDC:
+		return nil
+	case PushAuthBearer:
+		if len(a.Token) == 0 {
+			return errors.Wrap(ErrInvalidPushAuth, "bearer requires token")
+		}
+		return nil
+	case PushAuthHMAC:
+		if len(a.Secret) == 0 {
+			return errors.Wrap(ErrInvalidPushAuth, "hmac requires secret")
+		}
+		return nil
+	default:
+		return ErrInvalidPushAuth
+	}
+}
+
+// authorize set the authentication headers to the push request
+func (a PushAuth) authorize(req *http.Request, body []byte, sub *Subscription) error {
+	switch a.Type {
+	case PushAuthBearer:
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	case PushAuthHMAC:
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HeaderPushTimestamp, ts)
+		req.Header.Set(HeaderPushSignature, "sha256="+SignPushBody(a.Secret, ts, body))
+	case PushAuthOIDC:
+		aud := a.Audience
+		if len(aud) == 0 {
+			aud = req.URL.String()
+		}
+		signer, err := getPushSigner()
+		if err != nil {
+			return err
+		}
+		token, err := signer.sign(sub.Name, aud, time.Now())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// SignPushBody returns the hex encoded HMAC-SHA256 of "{timestamp}.{body}", the receivers compare it with the signature header
+func SignPushBody(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pushSigner signs the OIDC token of the push request
+type pushSigner struct {
+	key    *rsa.PrivateKey
+	keyID  string
+	issuer string
+	// generated is the key generated in this process, not loaded from the key file
+	generated bool
+}
+
+var (
+	pushSignerMu sync.Mutex
+	globalSigner *pushSigner
+)
+
+// SetPushSigningKey replace the key and the issuer of the OIDC token, the empty issuer is DefaultPushTokenIssuer
+func SetPushSigningKey(key *rsa.PrivateKey, issuer string) {
+	pushSignerMu.Lock()
+	defer pushSignerMu.Unlock()
+	globalSigner = newPushSigner(key, issuer)
+}
+
+// GeneratePushSigningKey generate the key of the OIDC token when not yet generated, and replace the issuer.
+// the generated key is kept in this process, the empty issuer is DefaultPushTokenIssuer.
+func GeneratePushSigningKey(issuer string) error {
+	pushSignerMu.Lock()
+	defer pushSignerMu.Unlock()
+
+	var key *rsa.PrivateKey
+	if globalSigner != nil && globalSigner.generated {
+		key = globalSigner.key
+	}
+	signer, err := newGeneratedPushSigner(key, issuer)
+	if err != nil {
+		return err
+	}
+	globalSigner = signer
+	return nil
+}
+
+// newGeneratedPushSigner returns the signer of the key generated in this process, the nil key is generated
+func newGeneratedPushSigner(key *rsa.PrivateKey, issuer string) (*pushSigner, error) {
+	if key == nil {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to generate push signing key")
+		}
+	}
+	s := newPushSigner(key, issuer)
+	s.generated = true
+	return s, nil
+}
+
+func newPushSigner(key *rsa.PrivateKey, issuer string) *pushSigner {
+	if len(issuer) == 0 {
+		issuer = DefaultPushTokenIssuer
+	}
+	sum := sha256.Sum256(key.PublicKey.N.Bytes())
+	return &pushSigner{
+		key:    key,
+		keyID:  hex.EncodeToString(sum[:8]),
+		issuer: issuer,
+	}
+}
+
+// getPushSigner returns the current signer, generate the key when not yet set
+func getPushSigner() (*pushSigner, error) {
+	pushSignerMu.Lock()
+	defer pushSignerMu.Unlock()
+
+	if globalSigner == nil {
+		s, err := newGeneratedPushSigner(nil, "")
+		if err != nil {
+			return nil, err
+		}
+		globalSigner = s
+	}
+	return globalSigner, nil
+}
+
+func encodeSegment(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sign returns the RS256 JWT for the subscription
+func (s *pushSigner) sign(subject, audience string, now time.Time) (string, error) {
+	header, err := encodeSegment(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": s.keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+	claims, err := encodeSegment(map[string]interface{}{
+		"iss": s.issuer,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(PushTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	signing := header + "." + claims
+	digest := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to sign push token")
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// JSONWebKey is the public key of the OIDC token in the JWK format
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// PushJWKS returns the public keys to verify the OIDC token of the push request
+func PushJWKS() ([]JSONWebKey, error) {
+	s, err := getPushSigner()
+	if err != nil {
+		return nil, err
+	}
+	pub := s.key.PublicKey
+	return []JSONWebKey{
+		{
+			KeyType:   "RSA",
+			Algorithm: "RS256",
+			Use:       "sig",
+			KeyID:     s.keyID,
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		},
+	}, nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// push http client variables
+const (
+	DefaultPushTimeout = 30 * time.Second
+	MaxPushTimeout     = 10 * time.Minute
+)
+
+var (
+	pushClientMu sync.RWMutex
+	pushClient   = &http.Client{Timeout: DefaultPushTimeout}
+)
+
+// SetPushHTTPClient replace the HTTP client shared by the all push subscriptions
+func SetPushHTTPClient(c *http.Client) {
+	pushClientMu.Lock()
+	defer pushClientMu.Unlock()
+	pushClient = c
+}
+
+// pushHTTPClient returns the shared HTTP client, with the timeout of the subscription when specified
+func (p *Push) pushHTTPClient() *http.Client {
+	pushClientMu.RLock()
+	c := pushClient
+	pushClientMu.RUnlock()
+
+	if p.Timeout <= 0 {
+		return c
+	}
+	// share the connection pool of the Transport
+	override := *c
+	override.Timeout = p.Timeout
+	return &override
+}
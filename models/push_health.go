@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// push backoff variables
+const (
+	MinPushBackoff = time.Second
+	MaxPushBackoff = 10 * time.Minute
+
+	// PushCircuitThreshold is the consecutive failures to open the circuit, the open circuit pauses
+	// the push for PushCircuitPause, and probes the endpoint with a message
+	PushCircuitThreshold = 5
+	PushCircuitPause     = time.Minute
+)
+
+// PushError is the error response of the push endpoint
+type PushError struct {
+	StatusCode int
+	// RetryAfter is the duration of the Retry-After header, 0 when not specified
+	RetryAfter time.Duration
+}
+
+func (e *PushError) Error() string {
+	return fmt.Sprintf("error send push message, got http status code '%d'", e.StatusCode)
+}
+
+// parseRetryAfter returns the duration of the Retry-After header in the seconds or the HTTP date
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if len(v) == 0 {
+		return 0
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		if sec < 0 {
+			return 0
+		}
+		return time.Duration(sec) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// PushHealth is the delivery state of the push endpoint, shared by the subscriptions pushing to the same endpoint
+type PushHealth struct {
+	LastError           string
+	LastErrorAt         time.Time
+	LastSuccessAt       time.Time
+	ConsecutiveFailures int
+	// NextAttemptAt is the time the backoff expires
+	NextAttemptAt time.Time
+}
+
+// CircuitOpen returns whether the consecutive failures reached PushCircuitThreshold
+func (h PushHealth) CircuitOpen() bool {
+	return h.ConsecutiveFailures >= PushCircuitThreshold
+}
+
+// succeed record the succeeded push, and close the circuit
+func (h *PushHealth) succeed(now time.Time) {
+	h.LastSuccessAt = now
+	h.ConsecutiveFailures = 0
+	h.NextAttemptAt = time.Time{}
+}
+
+// fail record the failed push, and decide the next attempt by the exponential backoff from min,
+// the circuit and Retry-After
+func (h *PushHealth) fail(err error, now time.Time, min time.Duration) {
+	h.LastError = err.Error()
+	h.LastErrorAt = now
+	h.ConsecutiveFailures++
+
+	backoff := MaxPushBackoff
+	if shift := uint(h.ConsecutiveFailures - 1); shift < 32 {
+		if d := min << shift; d > 0 && d < MaxPushBackoff {
+			backoff = d
+		}
+	}
+	if h.CircuitOpen() && backoff < PushCircuitPause {
+		backoff = PushCircuitPause
+	}
+	if pe, ok := errors.Cause(err).(*PushError); ok && pe.RetryAfter > backoff {
+		backoff = pe.RetryAfter
+	}
+	h.NextAttemptAt = now.Add(backoff)
+}
+
+// pushHealthMu serialize the updates of the push health in this process
+var pushHealthMu sync.Mutex
+
+// healthKey returns the key of the delivery state of the endpoint, the HTTP endpoints are identified
+// by the scheme and the host, and the others by the path as well, e.g. the file and the unix socket
+func (p *Push) healthKey() string {
+	u := p.Endpoint
+	switch u.Scheme {
+	case "http", "https":
+		return u.Scheme + "://" + u.Host
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// Health returns the delivery state of the endpoint, the zero value without the endpoint
+func (p *Push) Health() (PushHealth, error) {
+	if p == nil || !p.HasValidEndpoint() {
+		return PushHealth{}, nil
+	}
+	return getGlobalSubscription().GetPushHealth(p.healthKey())
+}
+
+// updateHealth apply fn to the delivery state of the endpoint and save it, returns the updated state
+func (p *Push) updateHealth(fn func(h *PushHealth)) (PushHealth, error) {
+	pushHealthMu.Lock()
+	defer pushHealthMu.Unlock()
+
+	h, err := p.Health()
+	if err != nil {
+		return PushHealth{}, err
+	}
+	fn(&h)
+	return h, getGlobalSubscription().SetPushHealth(p.healthKey(), h)
+}
@@ -0,0 +1,187 @@
+package models
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPushLeaseTTL is the lifetime of the lease of the push loop when not configured
+const DefaultPushLeaseTTL = 30 * time.Second
+
+// pushLease is the owner ID of this process and the lifetime of the leases.
+// the push loop runs on every process, and pushes only while holding the lease of the subscription in the datastore.
+var pushLease = struct {
+	sync.RWMutex
+	owner string
+	ttl   time.Duration
+}{
+	owner: defaultPushLeaseOwner(),
+	ttl:   DefaultPushLeaseTTL,
+}
+
+// defaultPushLeaseOwner returns the unique ID of the process
+func defaultPushLeaseOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + "-" + makeMessageID()
+}
+
+// SetPushLease replace the owner ID of this process and the lifetime of the leases,
+// the empty owner is the generated ID and 0 ttl is DefaultPushLeaseTTL
+func SetPushLease(owner string, ttl time.Duration) {
+	if len(owner) == 0 {
+		owner = defaultPushLeaseOwner()
+	}
+	if ttl <= 0 {
+		ttl = DefaultPushLeaseTTL
+	}
+
+	pushLease.Lock()
+	defer pushLease.Unlock()
+	pushLease.owner = owner
+	pushLease.ttl = ttl
+}
+
+// getPushLease returns the owner ID and the lifetime of the leases
+func getPushLease() (string, time.Duration) {
+	pushLease.RLock()
+	defer pushLease.RUnlock()
+	return pushLease.owner, pushLease.ttl
+}
+
+// pushLeaseRenewInterval returns the maximum wait of the push loop to renew the lease before it expires
+func pushLeaseRenewInterval() time.Duration {
+	_, ttl := getPushLease()
+	return ttl / 3
+}
+
+// acquirePushLease acquire or renew the lease of the subscription, returns whether this process is the leader
+func acquirePushLease(name string) (bool, error) {
+	owner, ttl := getPushLease()
+	return getGlobalSubscription().AcquirePushLease(name, owner, ttl)
+}
+
+// releasePushLease release the lease of the subscription for the takeover by the other process
+func releasePushLease(name string) error {
+	owner, _ := getPushLease()
+	return getGlobalSubscription().ReleasePushLease(name, owner)
+}
+
+// CheckPushLease acquire and release the lease of this process to check the datastore supports the lease,
+// e.g. MySQL requires the pubsub_lease table. the push loops do not push while the lease is unavailable.
+func CheckPushLease() error {
+	owner, ttl := getPushLease()
+	name := "check_" + owner
+	ok, err := getGlobalSubscription().AcquirePushLease(name, owner, ttl)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire push lease")
+	}
+	if !ok {
+		return errors.Errorf("push lease is held by the other process with the same owner %s", owner)
+	}
+	return errors.Wrap(getGlobalSubscription().ReleasePushLease(name, owner), "failed to release push lease")
+}
+
+// localPushLoops keep the subscriptions running the push loop in this process,
+// the persisted PushRunning is shared by the processes and left after the process exited.
+// the value is whether the loop is requested to start again while running.
+var localPushLoops = struct {
+	sync.Mutex
+	m map[string]bool
+}{m: make(map[string]bool)}
+
+// markPushLoop register the push loop of the subscription, returns false when already running in this process.
+// the running loop is requested to keep running, not to drop the start while the loop is exiting.
+func markPushLoop(name string) bool {
+	localPushLoops.Lock()
+	defer localPushLoops.Unlock()
+
+	if _, ok := localPushLoops.m[name]; ok {
+		localPushLoops.m[name] = true
+		return false
+	}
+	localPushLoops.m[name] = false
+	return true
+}
+
+// finishPushLoop unregister the push loop of the subscription, returns false and keeps it registered
+// when the loop is requested to start again after the loop decided to exit
+func finishPushLoop(name string) bool {
+	localPushLoops.Lock()
+	defer localPushLoops.Unlock()
+
+	if localPushLoops.m[name] {
+		localPushLoops.m[name] = false
+		return false
+	}
+	delete(localPushLoops.m, name)
+	return true
+}
+
+// unmarkPushLoop unregister the push loop of the subscription
+func unmarkPushLoop(name string) {
+	localPushLoops.Lock()
+	defer localPushLoops.Unlock()
+	delete(localPushLoops.m, name)
+}
+
+// ResumePushLoops start the push loops of the all push subscriptions not running in this process,
+// e.g. after the restart of the process
+func ResumePushLoops() error {
+	subs, err := ListSubscription()
+	if err != nil {
+		return err
+	}
+	for _, s := range subs {
+		if s.Detached {
+			continue
+		}
+		if err := s.PushLoop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pushWatcher is whether WatchPushLoops is running
+var pushWatcher = struct {
+	sync.Mutex
+	running bool
+}{}
+
+// WatchPushLoops resume the push loops every lease lifetime, to take over the subscriptions
+// whose push config is changed by the other processes. it is stopped by StopPushLoops.
+func WatchPushLoops() {
+	pushWatcher.Lock()
+	defer pushWatcher.Unlock()
+	if pushWatcher.running {
+		return
+	}
+	pushWatcher.running = true
+
+	pushLoops.start(func(ctx context.Context) {
+		defer func() {
+			pushWatcher.Lock()
+			pushWatcher.running = false
+			pushWatcher.Unlock()
+		}()
+		for {
+			_, ttl := getPushLease()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ttl):
+			}
+			if err := ResumePushLoops(); err != nil {
+				log.Printf("failed to resume push loops, error=%v", err)
+			}
+		}
+	})
+}
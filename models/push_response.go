@@ -0,0 +1,95 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HeaderPushRedeliveryDelay is the response header of the push endpoint to nack the messages with the redelivery delay in seconds
+const HeaderPushRedeliveryDelay = "X-Pubsub-Redelivery-Delay"
+
+// MaxPushRedeliveryDelay is the maximum redelivery delay of the nacked messages
+const MaxPushRedeliveryDelay = 10 * time.Minute
+
+// maxPushResponseBytes is the size of the response body read to find the redelivery delay
+const maxPushResponseBytes = 4096
+
+// PushNack is the nack response of the push endpoint with the redelivery delay,
+// the messages are redelivered after Delay, and it is not counted as the push failure
+type PushNack struct {
+	StatusCode int
+	Delay      time.Duration
+}
+
+func (e *PushNack) Error() string {
+	return fmt.Sprintf("push message nacked, got http status code '%d' with redelivery delay %s", e.StatusCode, e.Delay)
+}
+
+// pushResponseBody is the optional JSON body of the non-2xx push response
+type pushResponseBody struct {
+	RedeliveryDelaySeconds *int64 `json:"redelivery_delay_seconds"`
+}
+
+// ackedStatus returns whether the status code of the push response acks the messages
+func ackedStatus(code int) bool {
+	return code == http.StatusProcessing || (code >= 200 && code < 300)
+}
+
+// parsePushResponse returns nil when the response acks the messages, *PushNack when the response has
+// the redelivery delay, otherwise *PushError and the messages are redelivered after the ack deadline
+func parsePushResponse(res *http.Response) error {
+	if ackedStatus(res.StatusCode) {
+		return nil
+	}
+	if delay, ok := redeliveryDelay(res); ok {
+		return &PushNack{
+			StatusCode: res.StatusCode,
+			Delay:      delay,
+		}
+	}
+	return &PushError{
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// redeliveryDelay returns the redelivery delay of the header, or the JSON body when the header is not specified
+func redeliveryDelay(res *http.Response) (time.Duration, bool) {
+	if v := res.Header.Get(HeaderPushRedeliveryDelay); len(v) > 0 {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return clampRedeliveryDelay(sec), true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return 0, false
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(res.Body, maxPushResponseBytes))
+	if err != nil {
+		return 0, false
+	}
+	var body pushResponseBody
+	if err := json.Unmarshal(b, &body); err != nil || body.RedeliveryDelaySeconds == nil {
+		return 0, false
+	}
+	return clampRedeliveryDelay(*body.RedeliveryDelaySeconds), true
+}
+
+func clampRedeliveryDelay(sec int64) time.Duration {
+	if sec <= 0 {
+		return 0
+	}
+	if max := int64(MaxPushRedeliveryDelay / time.Second); sec > max {
+		return MaxPushRedeliveryDelay
+	}
+	return time.Duration(sec) * time.Second
+}
@@ -0,0 +1,788 @@
+package models
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewPushFormat(t *testing.T) {
+	cases := []struct {
+		format PushFormat
+		expect error
+	}{
+		{"", nil},
+		{PushFormatWrapped, nil},
+		{PushFormatNoWrapper, nil},
+		{PushFormatCloudEventsBinary, nil},
+		{PushFormatCloudEventsStructured, nil},
+		{"xml", ErrInvalidPushFormat},
+	}
+	for i, c := range cases {
+		_, err := NewPush("http://localhost:8080", nil, PushOptions{Format: c.format})
+		if err != c.expect {
+			t.Errorf("#%d: want error %v, got %v", i, c.expect, err)
+		}
+	}
+}
+
+func TestSendMessageFormat(t *testing.T) {
+	type received struct {
+		method string
+		header http.Header
+		body   []byte
+	}
+	ch := make(chan received, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ch <- received{method: r.Method, header: r.Header, body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	msg := &Message{
+		ID:          "m1",
+		Data:        []byte("test"),
+		Attributes:  map[string]string{"env": "prod dev", "Key-Upper": "v", "id": "dup", "bad key": "a\r\nb"},
+		PublishedAt: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	sub := &Subscription{Name: "sub", TopicID: "topic"}
+
+	cases := []struct {
+		format       PushFormat
+		expectHeader map[string]string
+		expectBody   func(t *testing.T, i int, body []byte)
+	}{
+		{
+			PushFormatWrapped,
+			map[string]string{"Content-Type": "application/json; charset=UTF-8"},
+			func(t *testing.T, i int, body []byte) {
+				var req PushRequest
+				if err := json.Unmarshal(body, &req); err != nil {
+					t.Fatalf("#%d: failed to unmarshal body, got err %v", i, err)
+				}
+				if req.SubscriptionID != "sub" || req.Message.ID != "m1" || string(req.Message.Data) != "test" {
+					t.Errorf("#%d: want wrapped message, got %s", i, body)
+				}
+			},
+		},
+		{
+			PushFormatNoWrapper,
+			map[string]string{
+				"Content-Type":                 "application/octet-stream",
+				"X-Pubsub-Message-Id":          "m1",
+				"X-Pubsub-Subscription":        "sub",
+				"X-Pubsub-Publish-Time":        "2017-01-02T03:04:05Z",
+				"X-Pubsub-Attribute-Env":       "prod%20dev",
+				"X-Pubsub-Attribute-Key-Upper": "v",
+				"X-Pubsub-Attribute-Id":        "dup",
+				"X-Pubsub-Attribute-Bad%20key": "a%0D%0Ab",
+			},
+			func(t *testing.T, i int, body []byte) {
+				if string(body) != "test" {
+					t.Errorf("#%d: want body test, got %s", i, body)
+				}
+			},
+		},
+		{
+			PushFormatCloudEventsBinary,
+			map[string]string{
+				"Content-Type":    "application/octet-stream",
+				"Ce-Specversion":  "1.0",
+				"Ce-Id":           "m1",
+				"Ce-Source":       "/topics/topic",
+				"Ce-Type":         CloudEventsType,
+				"Ce-Time":         "2017-01-02T03:04:05Z",
+				"Ce-Subscription": "sub",
+				"Ce-Env":          "prod%20dev",
+				"Ce-Key-Upper":    "",
+			},
+			func(t *testing.T, i int, body []byte) {
+				if string(body) != "test" {
+					t.Errorf("#%d: want body test, got %s", i, body)
+				}
+			},
+		},
+		{
+			PushFormatCloudEventsStructured,
+			map[string]string{"Content-Type": "application/cloudevents+json; charset=UTF-8"},
+			func(t *testing.T, i int, body []byte) {
+				var event map[string]string
+				if err := json.Unmarshal(body, &event); err != nil {
+					t.Fatalf("#%d: failed to unmarshal body, got err %v", i, err)
+				}
+				expect := map[string]string{
+					"specversion":     "1.0",
+					"id":              "m1",
+					"source":          "/topics/topic",
+					"type":            CloudEventsType,
+					"time":            "2017-01-02T03:04:05Z",
+					"datacontenttype": "application/octet-stream",
+					"subscription":    "sub",
+					"env":             "prod dev",
+					"data_base64":     "dGVzdA==",
+				}
+				if !reflect.DeepEqual(expect, event) {
+					t.Errorf("#%d: want event %v, got %v", i, expect, event)
+				}
+			},
+		},
+	}
+	for i, c := range cases {
+		p, err := NewPush(ts.URL, nil, PushOptions{Format: c.format})
+		if err != nil {
+			t.Fatalf("#%d: failed to NewPush, got err %v", i, err)
+		}
+		if err := p.sendMessage(msg, sub); err != nil {
+			t.Fatalf("#%d: failed to sendMessage, got err %v", i, err)
+		}
+		got := <-ch
+		if got.method != "POST" {
+			t.Errorf("#%d: want method POST, got %s", i, got.method)
+		}
+		for k, v := range c.expectHeader {
+			if h := got.header.Get(k); h != v {
+				t.Errorf("#%d: want header %s = %q, got %q", i, k, v, h)
+			}
+		}
+		c.expectBody(t, i, got.body)
+	}
+}
+
+func TestNoWrapperPayload(t *testing.T) {
+	sub := &Subscription{Name: "sub", TopicID: "topic"}
+	cases := []struct {
+		attr         map[string]string
+		expectHeader map[string]string
+	}{
+		{map[string]string{"camelCase": "v"}, map[string]string{"X-Pubsub-Attribute-camelCase": "v"}},
+		{map[string]string{"key": "a\r\nb"}, map[string]string{"X-Pubsub-Attribute-key": "a%0D%0Ab"}},
+		{map[string]string{"key": "100% \"ok\""}, map[string]string{"X-Pubsub-Attribute-key": "100%25%20%22ok%22"}},
+		{map[string]string{"a b:c\n": "v"}, map[string]string{"X-Pubsub-Attribute-a%20b%3Ac%0A": "v"}},
+		{map[string]string{"50%": "v"}, map[string]string{"X-Pubsub-Attribute-50%25": "v"}},
+	}
+	for i, c := range cases {
+		_, header, err := noWrapperPayload(&Message{ID: "m1", Attributes: c.attr}, sub)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		for k, v := range c.expectHeader {
+			if got := header[k]; len(got) != 1 || got[0] != v {
+				t.Errorf("#%d: want header %s = %q, got %q", i, k, v, got)
+			}
+		}
+	}
+}
+
+func TestPushAuth(t *testing.T) {
+	cases := []struct {
+		auth   PushAuth
+		expect error
+	}{
+		{PushAuth{}, nil},
+		{PushAuth{Type: PushAuthBearer, Token: "t"}, nil},
+		{PushAuth{Type: PushAuthBearer}, ErrInvalidPushAuth},
+		{PushAuth{Type: PushAuthHMAC, Secret: "s"}, nil},
+		{PushAuth{Type: PushAuthHMAC}, ErrInvalidPushAuth},
+		{PushAuth{Type: PushAuthOIDC}, nil},
+		{PushAuth{Type: "basic"}, ErrInvalidPushAuth},
+	}
+	for i, c := range cases {
+		_, err := NewPush("http://localhost:8080", nil, PushOptions{Auth: c.auth})
+		if errors.Cause(err) != c.expect {
+			t.Errorf("#%d: want error %v, got %v", i, c.expect, err)
+		}
+	}
+}
+
+func TestSendMessageAuth(t *testing.T) {
+	ch := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ch <- r
+		bodies <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	msg := &Message{ID: "m1", Data: []byte("test")}
+	sub := &Subscription{Name: "sub", TopicID: "topic"}
+	send := func(auth PushAuth) (*http.Request, []byte) {
+		p, err := NewPush(ts.URL, nil, PushOptions{Auth: auth})
+		if err != nil {
+			t.Fatalf("failed to NewPush, got err %v", err)
+		}
+		if err := p.sendMessage(msg, sub); err != nil {
+			t.Fatalf("failed to sendMessage, got err %v", err)
+		}
+		return <-ch, <-bodies
+	}
+
+	// bearer
+	req, _ := send(PushAuth{Type: PushAuthBearer, Token: "secret-token"})
+	if got := req.Header.Get("Authorization"); got != "Bearer secret-token" {
+		t.Errorf("want bearer token, got %q", got)
+	}
+
+	// hmac
+	req, body := send(PushAuth{Type: PushAuthHMAC, Secret: "key"})
+	ts1 := req.Header.Get(HeaderPushTimestamp)
+	if got, want := req.Header.Get(HeaderPushSignature), "sha256="+SignPushBody("key", ts1, body); got != want {
+		t.Errorf("want signature %q, got %q", want, got)
+	}
+
+	// oidc
+	req, _ = send(PushAuth{Type: PushAuthOIDC, Audience: "receiver"})
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	claims := verifyTestToken(t, token)
+	if claims["iss"] != DefaultPushTokenIssuer || claims["sub"] != "sub" || claims["aud"] != "receiver" {
+		t.Errorf("want claims of the subscription, got %v", claims)
+	}
+}
+
+func TestGeneratePushSigningKey(t *testing.T) {
+	defer GeneratePushSigningKey("")
+
+	// the generated key is kept with the new issuer
+	if err := GeneratePushSigningKey("https://a.example.com"); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	first, err := getPushSigner()
+	if err != nil || first.issuer != "https://a.example.com" {
+		t.Fatalf("want signer of the issuer, got %v and err %v", first, err)
+	}
+	if err := GeneratePushSigningKey(""); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	second, err := getPushSigner()
+	if err != nil || second.key != first.key || second.issuer != DefaultPushTokenIssuer {
+		t.Errorf("want same key of the default issuer, got %v and err %v", second, err)
+	}
+
+	// the key of the key file is replaced by the generated key
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key, got err %v", err)
+	}
+	SetPushSigningKey(key, "file")
+	if err := GeneratePushSigningKey(""); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if third, err := getPushSigner(); err != nil || third.key == key || !third.generated {
+		t.Errorf("want generated key, got %v and err %v", third, err)
+	}
+}
+
+// verifyTestToken verify the RS256 JWT with PushJWKS, and returns the claims
+func verifyTestToken(t *testing.T, token string) map[string]interface{} {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("want JWT, got %q", token)
+	}
+	var header map[string]string
+	decodeTestSegment(t, parts[0], &header)
+	keys, err := PushJWKS()
+	if err != nil {
+		t.Fatalf("failed to PushJWKS, got err %v", err)
+	}
+	if len(keys) != 1 || keys[0].KeyID != header["kid"] {
+		t.Fatalf("want key %s in JWKS, got %v", header["kid"], keys)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(keys[0].N)
+	e, _ := base64.RawURLEncoding.DecodeString(keys[0].E)
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		t.Fatalf("failed to verify token, got err %v", err)
+	}
+	var claims map[string]interface{}
+	decodeTestSegment(t, parts[1], &claims)
+	return claims
+}
+
+func decodeTestSegment(t *testing.T, seg string, v interface{}) {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		t.Fatalf("failed to decode segment, got err %v", err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		t.Fatalf("failed to unmarshal segment, got err %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		input  string
+		expect time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{"-1", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-30 * time.Second).Format(http.TimeFormat), 0},
+		{"invalid", 0},
+	}
+	for i, c := range cases {
+		if got := parseRetryAfter(c.input, now); got != c.expect {
+			t.Errorf("#%d: want %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestPushHealth(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	failure := errors.New("failure")
+	cases := []struct {
+		failures      int
+		err           error
+		expectBackoff time.Duration
+		expectOpen    bool
+	}{
+		{1, failure, time.Second, false},
+		{3, failure, 4 * time.Second, false},
+		{PushCircuitThreshold, failure, PushCircuitPause, true},
+		{20, failure, MaxPushBackoff, true},
+		{1, &PushError{StatusCode: 429, RetryAfter: time.Hour}, time.Hour, false},
+		{1, &PushError{StatusCode: 503}, time.Second, false},
+	}
+	for i, c := range cases {
+		var h PushHealth
+		for n := 0; n < c.failures; n++ {
+			h.fail(c.err, now, MinPushBackoff)
+		}
+		if got := h.NextAttemptAt.Sub(now); got != c.expectBackoff {
+			t.Errorf("#%d: want backoff %v, got %v", i, c.expectBackoff, got)
+		}
+		if got := h.CircuitOpen(); got != c.expectOpen {
+			t.Errorf("#%d: want circuit open %t, got %t", i, c.expectOpen, got)
+		}
+		if h.LastError != c.err.Error() || !h.LastErrorAt.Equal(now) {
+			t.Errorf("#%d: want last error %v at %v, got %v at %v", i, c.err, now, h.LastError, h.LastErrorAt)
+		}
+
+		h.succeed(now)
+		if h.ConsecutiveFailures != 0 || !h.NextAttemptAt.IsZero() || !h.LastSuccessAt.Equal(now) {
+			t.Errorf("#%d: want reset health, got %+v", i, h)
+		}
+	}
+}
+
+func TestPushRecordHealth(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "health", "A")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	publishMessage(t, "A", "test", nil)
+	p, err := NewPush(ts.URL, nil, PushOptions{})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	sub := mustGetSubscription(t, "health")
+	sub.PushConfig = p
+	if state, _ := sub.Push(1); state != sentFailed {
+		t.Fatalf("want state %s, got %s", sentFailed, state)
+	}
+
+	h, err := p.Health()
+	if err != nil {
+		t.Fatalf("failed to get push health, got err %v", err)
+	}
+	if h.ConsecutiveFailures != 1 || !strings.Contains(h.LastError, "429") {
+		t.Errorf("want a failure of 429, got %+v", h)
+	}
+	if wait := time.Until(h.NextAttemptAt); wait < time.Minute || wait > 2*time.Minute {
+		t.Errorf("want next attempt after Retry-After, got %v", wait)
+	}
+
+	// the subscriptions pushing to the same host share the health, the other hosts do not
+	cases := []struct {
+		endpoint       string
+		expectFailures int
+	}{
+		{ts.URL + "/other?token=t", 1},
+		{strings.Replace(ts.URL, "http://", "https://", 1), 0},
+		{"http://other.example.com", 0},
+	}
+	for i, c := range cases {
+		other, err := NewPush(c.endpoint, nil, PushOptions{})
+		if err != nil {
+			t.Fatalf("#%d: failed to NewPush, got err %v", i, err)
+		}
+		if h, err := other.Health(); err != nil || h.ConsecutiveFailures != c.expectFailures {
+			t.Errorf("#%d: want %d failures, got %+v and err %v", i, c.expectFailures, h, err)
+		}
+	}
+}
+
+func TestSendMessageClientOptions(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+		if r.Header.Get("X-Delay") == "true" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	msg := &Message{ID: "m1", Data: []byte("test")}
+	sub := &Subscription{Name: "sub", TopicID: "topic"}
+	cases := []struct {
+		attr      map[string]string
+		timeout   time.Duration
+		expectErr bool
+	}{
+		{map[string]string{"X-Version": "v1", "Content-Type": "text/plain"}, 0, false},
+		{map[string]string{"X-Delay": "true"}, 50 * time.Millisecond, true},
+		{map[string]string{"X-Delay": "true"}, time.Second, false},
+	}
+	for i, c := range cases {
+		p, err := NewPush(ts.URL, c.attr, PushOptions{Timeout: c.timeout})
+		if err != nil {
+			t.Fatalf("#%d: failed to NewPush, got err %v", i, err)
+		}
+		err = p.sendMessage(msg, sub)
+		if (err != nil) != c.expectErr {
+			t.Errorf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		h := <-headers
+		for k, v := range c.attr {
+			if k == "Content-Type" {
+				// the headers of the format are not overwritten
+				v = "application/json; charset=UTF-8"
+			}
+			if got := h.Get(k); got != v {
+				t.Errorf("#%d: want header %s = %q, got %q", i, k, v, got)
+			}
+		}
+	}
+
+	if _, err := NewPush(ts.URL, nil, PushOptions{Timeout: MaxPushTimeout + time.Second}); err != ErrInvalidPushTimeout {
+		t.Errorf("want error %v, got %v", ErrInvalidPushTimeout, err)
+	}
+}
+
+func TestParsePushResponse(t *testing.T) {
+	cases := []struct {
+		code        int
+		header      map[string]string
+		body        string
+		expectNack  *PushNack
+		expectError bool
+	}{
+		{200, nil, "", nil, false},
+		{202, nil, "", nil, false},
+		{299, nil, "", nil, false},
+		{500, nil, "", nil, true},
+		{429, map[string]string{HeaderPushRedeliveryDelay: "30"}, "", &PushNack{StatusCode: 429, Delay: 30 * time.Second}, false},
+		{503, map[string]string{HeaderPushRedeliveryDelay: "0"}, "", &PushNack{StatusCode: 503, Delay: 0}, false},
+		{503, map[string]string{HeaderPushRedeliveryDelay: "3600"}, "", &PushNack{StatusCode: 503, Delay: MaxPushRedeliveryDelay}, false},
+		{503, map[string]string{HeaderPushRedeliveryDelay: "soon"}, "", nil, true},
+		{409, map[string]string{"Content-Type": "application/json"}, `{"redelivery_delay_seconds": 5}`, &PushNack{StatusCode: 409, Delay: 5 * time.Second}, false},
+		{409, map[string]string{"Content-Type": "application/json"}, `{"message": "busy"}`, nil, true},
+		{409, map[string]string{"Content-Type": "text/plain"}, `{"redelivery_delay_seconds": 5}`, nil, true},
+		// the delay of the ack response is ignored
+		{200, map[string]string{HeaderPushRedeliveryDelay: "30"}, "", nil, false},
+	}
+	for i, c := range cases {
+		res := &http.Response{
+			StatusCode: c.code,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(c.body)),
+		}
+		for k, v := range c.header {
+			res.Header.Set(k, v)
+		}
+		err := parsePushResponse(res)
+		if c.expectNack != nil {
+			if !reflect.DeepEqual(err, c.expectNack) {
+				t.Errorf("#%d: want nack %v, got %v", i, c.expectNack, err)
+			}
+			continue
+		}
+		if (err != nil) != c.expectError {
+			t.Errorf("#%d: want error %t, got %v", i, c.expectError, err)
+		}
+		if _, ok := err.(*PushNack); ok {
+			t.Errorf("#%d: want not nack, got %v", i, err)
+		}
+	}
+}
+
+func TestPushNack(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "nack", "A")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(HeaderPushRedeliveryDelay, "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	publishMessage(t, "A", "test", nil)
+	p, err := NewPush(ts.URL, nil, PushOptions{})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	sub := mustGetSubscription(t, "nack")
+	sub.PushConfig = p
+	state, err := sub.Push(1)
+	if state != sentNacked || err != nil {
+		t.Fatalf("want state %s, got %s and err %v", sentNacked, state, err)
+	}
+
+	// the nack is not the push failure
+	h, err := p.Health()
+	if err != nil {
+		t.Fatalf("failed to get push health, got err %v", err)
+	}
+	if h.ConsecutiveFailures != 0 || !h.NextAttemptAt.IsZero() {
+		t.Errorf("want no failure, got %+v", h)
+	}
+	peeked, err := sub.Message.Peek()
+	if err != nil || len(peeked) != 1 {
+		t.Fatalf("want a message, got %v and err %v", peeked, err)
+	}
+	if wait := time.Until(peeked[0].AckDeadline); wait < 50*time.Second || wait > time.Minute {
+		t.Errorf("want redelivery after the delay, got %v", wait)
+	}
+}
+
+func TestNewPushTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-push-sinks")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+	SetPushSinks(PushSinks{
+		FileRoot:    dir,
+		UnixSockets: []string{"/tmp/pubsub.sock"},
+		Stdout:      true,
+	})
+	defer SetPushSinks(PushSinks{})
+
+	cases := []struct {
+		endpoint string
+		opts     PushOptions
+		expect   error
+	}{
+		{"http://localhost:8080", PushOptions{}, nil},
+		{"unix:///tmp/pubsub.sock?path=/push", PushOptions{}, nil},
+		{"unix:///tmp/../tmp/pubsub.sock", PushOptions{}, nil},
+		{"unix:///var/run/docker.sock", PushOptions{}, ErrInvalidPushEndpoint},
+		{"unix://", PushOptions{}, ErrInvalidEndpoint},
+		{"file:///tmp/pubsub.jsonl", PushOptions{Format: PushFormatCloudEventsStructured}, nil},
+		{"file://", PushOptions{}, ErrInvalidEndpoint},
+		{"file:///tmp/pubsub.jsonl", PushOptions{Format: PushFormatNoWrapper}, ErrInvalidPushFormat},
+		{"stdout:", PushOptions{}, nil},
+		{"stdout:", PushOptions{Auth: PushAuth{Type: PushAuthBearer, Token: "t"}}, ErrInvalidPushAuth},
+	}
+	for i, c := range cases {
+		_, err := NewPush(c.endpoint, nil, c.opts)
+		if errors.Cause(err) != c.expect {
+			t.Errorf("#%d: want error %v, got %v", i, c.expect, err)
+		}
+	}
+
+	// the file is kept under the root
+	if path, err := pushFilePath("/../../etc/passwd"); err != nil || path != filepath.Join(dir, "etc/passwd") {
+		t.Errorf("want file under the root, got %s and err %v", path, err)
+	}
+
+	// disabled by default
+	SetPushSinks(PushSinks{})
+	for i, endpoint := range []string{"file:///tmp/pubsub.jsonl", "unix:///tmp/pubsub.sock", "stdout:"} {
+		if _, err := NewPush(endpoint, nil, PushOptions{}); errors.Cause(err) != ErrInvalidPushEndpoint {
+			t.Errorf("#%d: want error %v, got %v", i, ErrInvalidPushEndpoint, err)
+		}
+	}
+}
+
+func TestSendMessageTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-push-transport")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// unix domain socket
+	socket := filepath.Join(dir, "push.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("failed to listen unix socket, got err %v", err)
+	}
+	paths := make(chan string, 1)
+	ts := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go ts.Serve(l)
+	defer ts.Close()
+
+	msgs := []*Message{{ID: "m1", Data: []byte("a")}, {ID: "m2", Data: []byte("b")}}
+	sub := &Subscription{Name: "sub", TopicID: "topic"}
+	SetPushSinks(PushSinks{FileRoot: filepath.Join(dir, "sink"), UnixSockets: []string{socket}})
+	defer SetPushSinks(PushSinks{})
+
+	p, err := NewPush("unix://"+socket+"?path=/push", nil, PushOptions{})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	if err := p.sendMessages(msgs[:1], sub); err != nil {
+		t.Fatalf("failed to send to unix socket, got err %v", err)
+	}
+	if got := <-paths; got != "/push" {
+		t.Errorf("want request path /push, got %s", got)
+	}
+
+	// JSON lines file under the root
+	file := filepath.Join(dir, "sink", "app", "push.jsonl")
+	p, err = NewPush("file:///app/push.jsonl", nil, PushOptions{Format: PushFormatBatch})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := p.sendMessages(msgs, sub); err != nil {
+			t.Fatalf("#%d: failed to send to file, got err %v", i, err)
+		}
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("failed to read file, got err %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("want 4 lines, got %q", lines)
+	}
+	for i, line := range lines {
+		var req PushRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			t.Fatalf("#%d: failed to unmarshal line, got err %v", i, err)
+		}
+		if want := msgs[i%2].ID; req.Message.ID != want || req.SubscriptionID != "sub" {
+			t.Errorf("#%d: want message %s, got %s", i, want, line)
+		}
+	}
+}
+
+func TestPushFileSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-push-symlink")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "sink")
+	outside := filepath.Join(dir, "outside")
+	if err := os.MkdirAll(filepath.Join(root, "real"), 0755); err != nil {
+		t.Fatalf("failed to create dir, got err %v", err)
+	}
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatalf("failed to create dir, got err %v", err)
+	}
+	links := map[string]string{
+		"out":     outside,
+		"in":      filepath.Join(root, "real"),
+		"out.log": filepath.Join(outside, "push.jsonl"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatalf("failed to create link, got err %v", err)
+		}
+	}
+	SetPushSinks(PushSinks{FileRoot: root})
+	defer SetPushSinks(PushSinks{})
+
+	cases := []struct {
+		endpoint string
+		expect   error
+	}{
+		{"file:///in/push.jsonl", nil},
+		{"file:///in/new/push.jsonl", nil},
+		{"file:///out/push.jsonl", ErrInvalidPushEndpoint},
+		{"file:///out/new/push.jsonl", ErrInvalidPushEndpoint},
+		// the broken link creates the file at the target
+		{"file:///out.log", ErrInvalidPushEndpoint},
+	}
+	for i, c := range cases {
+		if _, err := NewPush(c.endpoint, nil, PushOptions{}); errors.Cause(err) != c.expect {
+			t.Errorf("#%d: want error %v, got %v", i, c.expect, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new")); !os.IsNotExist(err) {
+		t.Errorf("want no directory out of the root, got err %v", err)
+	}
+
+	// the link replaced after the transport is created
+	p, err := NewPush("file:///link/push.jsonl", nil, PushOptions{})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	if err := os.Remove(filepath.Join(root, "link")); err != nil {
+		t.Fatalf("failed to remove dir, got err %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatalf("failed to create link, got err %v", err)
+	}
+	msg := &Message{ID: "m1", Data: []byte("a")}
+	if err := p.sendMessage(msg, &Subscription{Name: "sub"}); errors.Cause(err) != ErrInvalidPushEndpoint {
+		t.Errorf("want error %v, got %v", ErrInvalidPushEndpoint, err)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "push.jsonl")); !os.IsNotExist(err) {
+		t.Errorf("want no file out of the root, got err %v", err)
+	}
+}
+
+type recordTransport struct {
+	sent chan []*Message
+}
+
+func (t *recordTransport) Send(msgs []*Message, sub *Subscription) error {
+	t.sent <- msgs
+	return nil
+}
+
+func TestRegisterPushTransport(t *testing.T) {
+	rt := &recordTransport{sent: make(chan []*Message, 1)}
+	RegisterPushTransport("record", func(p *Push) (PushTransport, error) {
+		return rt, nil
+	})
+
+	p, err := NewPush("record://sink", nil, PushOptions{})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	msg := &Message{ID: "m1"}
+	if err := p.sendMessage(msg, &Subscription{Name: "sub"}); err != nil {
+		t.Fatalf("failed to send message, got err %v", err)
+	}
+	if got := <-rt.sent; len(got) != 1 || got[0] != msg {
+		t.Errorf("want sent %v, got %v", msg, got)
+	}
+}
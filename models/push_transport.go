@@ -0,0 +1,341 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// PushTransport delivers the push request of the messages to the endpoint
+type PushTransport interface {
+	// Send delivers the messages, returns nil to ack them, *PushNack or the other error to nack them
+	Send(msgs []*Message, sub *Subscription) error
+}
+
+// PushTransportFactory returns the transport of the push, or error when the push config is not supported by the transport
+type PushTransportFactory func(p *Push) (PushTransport, error)
+
+// push transport schemes
+const (
+	PushSchemeUnix   = "unix"
+	PushSchemeFile   = "file"
+	PushSchemeStdout = "stdout"
+)
+
+// pushTransports keep the transport factories by the endpoint URL scheme,
+// the schemes not registered are sent over HTTP
+var pushTransports = struct {
+	sync.RWMutex
+	m map[string]PushTransportFactory
+}{
+	m: map[string]PushTransportFactory{
+		PushSchemeUnix:   newUnixPushTransport,
+		PushSchemeFile:   newFilePushTransport,
+		PushSchemeStdout: newFilePushTransport,
+	},
+}
+
+// RegisterPushTransport register the transport factory of the endpoint URL scheme, replace it when already registered
+func RegisterPushTransport(scheme string, f PushTransportFactory) {
+	pushTransports.Lock()
+	defer pushTransports.Unlock()
+	pushTransports.m[scheme] = f
+}
+
+// PushSinks is the local sinks allowed as the push endpoint, the zero value disables all of them.
+// the API clients can not write to the files or connect to the sockets of the server without them.
+type PushSinks struct {
+	// FileRoot is the directory of the files of the "file" endpoints, the path of the endpoint is relative to it
+	FileRoot string
+	// UnixSockets is the socket paths allowed as the "unix" endpoints
+	UnixSockets []string
+	// Stdout allows the "stdout" endpoint
+	Stdout bool
+}
+
+var (
+	pushSinks   PushSinks
+	pushSinksMu sync.RWMutex
+)
+
+// SetPushSinks replace the local sinks allowed as the push endpoint
+func SetPushSinks(sinks PushSinks) {
+	pushSinksMu.Lock()
+	defer pushSinksMu.Unlock()
+	pushSinks = sinks
+}
+
+func getPushSinks() PushSinks {
+	pushSinksMu.RLock()
+	defer pushSinksMu.RUnlock()
+	return pushSinks
+}
+
+// pushFilePath returns the file under the file root, the file can not escape from the root
+func pushFilePath(path string) (string, error) {
+	root := getPushSinks().FileRoot
+	if len(root) == 0 {
+		return "", errors.Wrap(ErrInvalidPushEndpoint, "file endpoint is disabled")
+	}
+	return filepath.Join(root, filepath.Clean("/"+path)), nil
+}
+
+// resolvePushFile returns the path resolved the symbolic links, the resolved path can not escape from the file root.
+// the missing rest of the path is joined to the resolved existing parent.
+func resolvePushFile(path string) (string, error) {
+	root, err := filepath.EvalSymlinks(getPushSinks().FileRoot)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve file root")
+	}
+	resolved, err := evalExistingSymlinks(path)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve push file")
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Wrapf(ErrInvalidPushEndpoint, "file %s is linked out of the file root", path)
+	}
+	return resolved, nil
+}
+
+// evalExistingSymlinks resolve the symbolic links of the nearest existing parent of the path,
+// returns error when the existing path is a broken link, that creates the file at the link target
+func evalExistingSymlinks(path string) (string, error) {
+	rest := ""
+	for {
+		_, err := os.Lstat(path)
+		if err == nil {
+			resolved, err := filepath.EvalSymlinks(path)
+			if os.IsNotExist(err) {
+				return "", errors.Wrapf(ErrInvalidPushEndpoint, "%s is the broken link", path)
+			}
+			if err != nil {
+				return "", err
+			}
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", err
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// pushSocketPath returns the socket path when allowed
+func pushSocketPath(path string) (string, error) {
+	path = filepath.Clean(path)
+	for _, allowed := range getPushSinks().UnixSockets {
+		if filepath.Clean(allowed) == path {
+			return path, nil
+		}
+	}
+	return "", errors.Wrapf(ErrInvalidPushEndpoint, "unix socket %s is not allowed", path)
+}
+
+// transport returns the transport selected by the scheme of the endpoint
+func (p *Push) transport() (PushTransport, error) {
+	pushTransports.RLock()
+	f, ok := pushTransports.m[p.Endpoint.Scheme]
+	pushTransports.RUnlock()
+	if !ok {
+		return &httpPushTransport{push: p}, nil
+	}
+	return f(p)
+}
+
+// httpPushTransport sends the push request to the HTTP endpoint with the shared HTTP client
+type httpPushTransport struct {
+	push *Push
+}
+
+func (t *httpPushTransport) Send(msgs []*Message, sub *Subscription) error {
+	req, err := t.push.newRequest(msgs, sub)
+	if err != nil {
+		return err
+	}
+	return doPushRequest(t.push.pushHTTPClient(), req)
+}
+
+// doPushRequest sends the request, and parse the response in the push response contract
+func doPushRequest(c *http.Client, req *http.Request) error {
+	res, err := c.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send push message")
+	}
+	defer res.Body.Close()
+	return parsePushResponse(res)
+}
+
+// unixPushTransport sends the HTTP push request over the Unix domain socket of the endpoint "unix:///path/to.sock"
+// allowed by PushSinks.UnixSockets, the "path" query is the path of the HTTP request, default "/"
+type unixPushTransport struct {
+	push   *Push
+	socket string
+	path   string
+}
+
+func newUnixPushTransport(p *Push) (PushTransport, error) {
+	if len(p.Endpoint.Path) == 0 {
+		return nil, errors.Wrap(ErrInvalidEndpoint, "unix endpoint requires the socket path")
+	}
+	socket, err := pushSocketPath(p.Endpoint.Path)
+	if err != nil {
+		return nil, err
+	}
+	path := p.Endpoint.Query().Get("path")
+	if len(path) == 0 {
+		path = "/"
+	}
+	return &unixPushTransport{
+		push:   p,
+		socket: socket,
+		path:   path,
+	}, nil
+}
+
+// unixTransports keep the HTTP transports by the socket path to reuse the connections
+var unixTransports = struct {
+	sync.Mutex
+	m map[string]*http.Transport
+}{m: make(map[string]*http.Transport)}
+
+func unixTransport(socket string) *http.Transport {
+	unixTransports.Lock()
+	defer unixTransports.Unlock()
+
+	t, ok := unixTransports.m[socket]
+	if !ok {
+		t = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		unixTransports.m[socket] = t
+	}
+	return t
+}
+
+func (t *unixPushTransport) Send(msgs []*Message, sub *Subscription) error {
+	req, err := t.push.newRequest(msgs, sub)
+	if err != nil {
+		return err
+	}
+	req.URL = &url.URL{Scheme: "http", Host: "unix", Path: t.path}
+	req.Host = "unix"
+
+	c := &http.Client{
+		Timeout:   t.push.pushHTTPClient().Timeout,
+		Transport: unixTransport(t.socket),
+	}
+	return doPushRequest(c, req)
+}
+
+// filePushTransport appends the messages in JSON lines to the file of the endpoint "file:///path/to.jsonl"
+// under PushSinks.FileRoot, or the stdout of the endpoint "stdout:". a line is a message in the wrapped or the CloudEvents structured format.
+type filePushTransport struct {
+	push *Push
+	// path is the file to append, empty is the stdout
+	path string
+}
+
+func newFilePushTransport(p *Push) (PushTransport, error) {
+	switch p.Format {
+	case "", PushFormatWrapped, PushFormatBatch, PushFormatCloudEventsStructured:
+	default:
+		return nil, errors.Wrapf(ErrInvalidPushFormat, "%s endpoint requires JSON format", p.Endpoint.Scheme)
+	}
+	if p.Auth.Type != PushAuthNone {
+		return nil, errors.Wrapf(ErrInvalidPushAuth, "%s endpoint does not support auth", p.Endpoint.Scheme)
+	}
+
+	t := &filePushTransport{push: p}
+	if p.Endpoint.Scheme == PushSchemeStdout {
+		if !getPushSinks().Stdout {
+			return nil, errors.Wrap(ErrInvalidPushEndpoint, "stdout endpoint is disabled")
+		}
+		return t, nil
+	}
+	if len(p.Endpoint.Path) == 0 {
+		return nil, errors.Wrap(ErrInvalidEndpoint, "file endpoint requires the file path")
+	}
+	path, err := pushFilePath(p.Endpoint.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(getPushSinks().FileRoot, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create file root")
+	}
+	// create the directory after the existing parent is checked, not to create it out of the root through a link
+	dir, err := resolvePushFile(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "failed to create push file directory")
+	}
+	if _, err := resolvePushFile(path); err != nil {
+		return nil, err
+	}
+	t.path = path
+	return t, nil
+}
+
+// pushFileMu serialize the writes of the lines to the files and the stdout
+var pushFileMu sync.Mutex
+
+func (t *filePushTransport) Send(msgs []*Message, sub *Subscription) error {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		var (
+			line []byte
+			err  error
+		)
+		if t.push.Format == PushFormatCloudEventsStructured {
+			line, _, err = cloudEventsStructuredPayload(msg, sub)
+		} else {
+			line, _, err = wrappedPayload(msg, sub)
+		}
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	pushFileMu.Lock()
+	defer pushFileMu.Unlock()
+
+	if len(t.path) == 0 {
+		_, err := io.Copy(os.Stdout, &buf)
+		return errors.Wrap(err, "failed to write push messages to stdout")
+	}
+	// the link may be replaced after the transport is created
+	path, err := resolvePushFile(t.path)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "failed to open push file")
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to write push messages to file")
+	}
+	return errors.Wrap(f.Close(), "failed to close push file")
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SchemaType is the definition language of the Schema
+type SchemaType string
+
+// supported schema types
+const (
+	SchemaTypeJSON SchemaType = "json_schema"
+	SchemaTypeAvro SchemaType = "avro"
+)
+
+// SchemaEncoding is the encoding of the messages published to the topic
+type SchemaEncoding string
+
+// supported encodings, the binary encoding is only supported by the Avro schema
+const (
+	EncodingJSON   SchemaEncoding = "json"
+	EncodingBinary SchemaEncoding = "binary"
+)
+
+// Schema is the revision of the message schema
+type Schema struct {
+	Name              string     `json:"name"`
+	Type              SchemaType `json:"type"`
+	Definition        string     `json:"definition"`
+	RevisionID        string     `json:"revision_id"`
+	RevisionCreatedAt time.Time  `json:"revision_create_time"`
+}
+
+// SchemaRevisions is the all revisions of the schema, the last revision is the latest
+type SchemaRevisions struct {
+	Name      string
+	Revisions []*Schema
+}
+
+// latest returns the latest revision
+func (sr *SchemaRevisions) latest() *Schema {
+	return sr.Revisions[len(sr.Revisions)-1]
+}
+
+// SchemaSettings is the schema and the encoding attached to the topic
+type SchemaSettings struct {
+	Schema   string         `json:"schema"`
+	Encoding SchemaEncoding `json:"encoding"`
+}
+
+// validate check the schema exists and supports the encoding
+func (ss *SchemaSettings) validate() error {
+	if ss == nil {
+		return nil
+	}
+	s, err := GetSchema(ss.Schema)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidSchemaSettings, "not found schema %q", ss.Schema)
+	}
+	switch ss.Encoding {
+	case EncodingJSON:
+	case EncodingBinary:
+		if s.Type != SchemaTypeAvro {
+			return errors.Wrap(ErrInvalidSchemaSettings, "binary encoding requires avro schema")
+		}
+	default:
+		return errors.Wrapf(ErrInvalidSchemaSettings, "unknown encoding %q", ss.Encoding)
+	}
+	return nil
+}
+
+// compiledSchemas is cache of the compiled schema, the key is pair of the type and the definition
+var compiledSchemas = struct {
+	sync.Mutex
+	m map[string]interface{}
+}{m: make(map[string]interface{})}
+
+// compile returns compiled schema, *jsonSchema or *avroSchema
+func (s *Schema) compile() (interface{}, error) {
+	key := string(s.Type) + ":" + s.Definition
+	compiledSchemas.Lock()
+	defer compiledSchemas.Unlock()
+	if c, ok := compiledSchemas.m[key]; ok {
+		return c, nil
+	}
+
+	var (
+		c   interface{}
+		err error
+	)
+	switch s.Type {
+	case SchemaTypeJSON:
+		c, err = compileJSONSchema(s.Definition)
+	case SchemaTypeAvro:
+		c, err = compileAvroSchema(s.Definition)
+	default:
+		return nil, ErrInvalidSchemaType
+	}
+	if err != nil {
+		return nil, err
+	}
+	compiledSchemas.m[key] = c
+	return c, nil
+}
+
+// ValidateMessage returns ErrSchemaViolation when the data does not conform to the schema
+func (s *Schema) ValidateMessage(data []byte, encoding SchemaEncoding) error {
+	c, err := s.compile()
+	if err != nil {
+		return err
+	}
+	switch a := c.(type) {
+	case *jsonSchema:
+		return a.validate(data)
+	case *avroSchema:
+		if encoding == EncodingBinary {
+			return a.validateBinary(data)
+		}
+		return a.validateJSON(data)
+	default:
+		return ErrInvalidSchemaType
+	}
+}
+
+func newSchemaRevision(name string, typ SchemaType, definition string, revision int) (*Schema, error) {
+	s := &Schema{
+		Name:              name,
+		Type:              typ,
+		Definition:        definition,
+		RevisionID:        strconv.Itoa(revision),
+		RevisionCreatedAt: time.Now(),
+	}
+	if _, err := s.compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewSchema create the first revision of the schema
+func NewSchema(name string, typ SchemaType, definition string) (*Schema, error) {
+	if typ != SchemaTypeJSON && typ != SchemaTypeAvro {
+		return nil, ErrInvalidSchemaType
+	}
+	if _, err := globalSchemas.Get(name); err == nil {
+		return nil, ErrAlreadyExistSchema
+	}
+	s, err := newSchemaRevision(name, typ, definition, 1)
+	if err != nil {
+		return nil, err
+	}
+	sr := &SchemaRevisions{Name: name, Revisions: []*Schema{s}}
+	if err := globalSchemas.Set(sr); err != nil {
+		return nil, errors.Wrapf(err, "failed to save schema, name=%s", name)
+	}
+	return s, nil
+}
+
+// CommitSchema add the new revision to the schema, the type is not changeable
+func CommitSchema(name, definition string) (*Schema, error) {
+	sr, err := globalSchemas.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSchemaRevision(name, sr.latest().Type, definition, len(sr.Revisions)+1)
+	if err != nil {
+		return nil, err
+	}
+	sr.Revisions = append(sr.Revisions, s)
+	if err := globalSchemas.Set(sr); err != nil {
+		return nil, errors.Wrapf(err, "failed to save schema, name=%s", name)
+	}
+	return s, nil
+}
+
+// GetSchema returns the latest revision of the schema
+func GetSchema(name string) (*Schema, error) {
+	sr, err := globalSchemas.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return sr.latest(), nil
+}
+
+// GetSchemaRevision returns the specified revision of the schema
+func GetSchemaRevision(name, revisionID string) (*Schema, error) {
+	sr, err := globalSchemas.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sr.Revisions {
+		if s.RevisionID == revisionID {
+			return s, nil
+		}
+	}
+	return nil, ErrNotFoundEntry
+}
+
+// ListSchemas returns the latest revision of the all schemas
+func ListSchemas() ([]*Schema, error) {
+	list, err := globalSchemas.List()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Schema, 0, len(list))
+	for _, sr := range list {
+		res = append(res, sr.latest())
+	}
+	return res, nil
+}
+
+// ListSchemaRevisions returns the all revisions of the schema, ordered by oldest first
+func ListSchemaRevisions(name string) ([]*Schema, error) {
+	sr, err := globalSchemas.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return sr.Revisions, nil
+}
+
+// DeleteSchema delete the schema and the all revisions, the schema used by the topic is not deletable
+func DeleteSchema(name string) error {
+	if _, err := globalSchemas.Get(name); err != nil {
+		return err
+	}
+	topics, err := ListTopic()
+	if err != nil {
+		return err
+	}
+	for _, t := range topics {
+		if t.SchemaSettings != nil && t.SchemaSettings.Schema == name {
+			return errors.Wrapf(ErrSchemaInUse, "topic=%s", t.Name)
+		}
+	}
+	return globalSchemas.Delete(name)
+}
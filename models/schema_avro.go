@@ -0,0 +1,484 @@
+package models
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// avroSchema is compiled Avro schema
+type avroSchema struct {
+	// kind is primitive type name, "record", "enum", "array", "map", "fixed" or "union"
+	kind string
+	name string
+
+	fields   []avroField
+	symbols  []string
+	items    *avroSchema
+	values   *avroSchema
+	size     int
+	branches []*avroSchema
+}
+
+type avroField struct {
+	name       string
+	typ        *avroSchema
+	hasDefault bool
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// avroCompiler holds the named types for the references
+type avroCompiler struct {
+	named map[string]*avroSchema
+}
+
+// compileAvroSchema returns compiled Avro schema from the definition
+func compileAvroSchema(definition string) (*avroSchema, error) {
+	var raw interface{}
+	if err := json.Unmarshal([]byte(definition), &raw); err != nil {
+		return nil, errors.Wrapf(ErrInvalidSchema, "failed to parse json: %v", err)
+	}
+	c := &avroCompiler{named: make(map[string]*avroSchema)}
+	return c.compile(raw, "")
+}
+
+func (c *avroCompiler) compile(raw interface{}, namespace string) (*avroSchema, error) {
+	switch a := raw.(type) {
+	case string:
+		if avroPrimitives[a] {
+			return &avroSchema{kind: a}, nil
+		}
+		if s, ok := c.lookup(a, namespace); ok {
+			return s, nil
+		}
+		return nil, errors.Wrapf(ErrInvalidSchema, "unknown type %q", a)
+	case []interface{}:
+		u := &avroSchema{kind: "union"}
+		for _, e := range a {
+			b, err := c.compile(e, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if b.kind == "union" {
+				return nil, errors.Wrap(ErrInvalidSchema, "union must not contain union")
+			}
+			u.branches = append(u.branches, b)
+		}
+		return u, nil
+	case map[string]interface{}:
+		return c.compileComplex(a, namespace)
+	default:
+		return nil, errors.Wrap(ErrInvalidSchema, "schema must be string, array or object")
+	}
+}
+
+func (c *avroCompiler) lookup(name, namespace string) (*avroSchema, bool) {
+	if s, ok := c.named[name]; ok {
+		return s, true
+	}
+	if len(namespace) != 0 && !strings.Contains(name, ".") {
+		s, ok := c.named[namespace+"."+name]
+		return s, ok
+	}
+	return nil, false
+}
+
+// define register the named type, returns the full name and the namespace for the children
+func (c *avroCompiler) define(m map[string]interface{}, namespace string, s *avroSchema) (string, error) {
+	name, ok := m["name"].(string)
+	if !ok || len(name) == 0 {
+		return "", errors.Wrapf(ErrInvalidSchema, "%s requires name", s.kind)
+	}
+	if ns, ok := m["namespace"].(string); ok {
+		namespace = ns
+	}
+	full := name
+	if !strings.Contains(name, ".") && len(namespace) != 0 {
+		full = namespace + "." + name
+	}
+	if _, ok := c.named[full]; ok {
+		return "", errors.Wrapf(ErrInvalidSchema, "duplicated type name %q", full)
+	}
+	s.name = full
+	c.named[full] = s
+	if i := strings.LastIndex(full, "."); i >= 0 {
+		return full[:i], nil
+	}
+	return "", nil
+}
+
+func (c *avroCompiler) compileComplex(m map[string]interface{}, namespace string) (*avroSchema, error) {
+	kind, ok := m["type"].(string)
+	if !ok {
+		// e.g. {"type": {"type": "array", ...}}
+		if t, ok := m["type"]; ok {
+			return c.compile(t, namespace)
+		}
+		return nil, errors.Wrap(ErrInvalidSchema, "type is required")
+	}
+	s := &avroSchema{kind: kind}
+	switch kind {
+	case "record", "error":
+		s.kind = "record"
+		ns, err := c.define(m, namespace, s)
+		if err != nil {
+			return nil, err
+		}
+		fields, ok := m["fields"].([]interface{})
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidSchema, "record %s requires fields", s.name)
+		}
+		seen := map[string]bool{}
+		for _, f := range fields {
+			fm, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidSchema, "invalid field in record %s", s.name)
+			}
+			name, ok := fm["name"].(string)
+			if !ok || len(name) == 0 || seen[name] {
+				return nil, errors.Wrapf(ErrInvalidSchema, "invalid field name in record %s", s.name)
+			}
+			seen[name] = true
+			typ, err := c.compile(fm["type"], ns)
+			if err != nil {
+				return nil, err
+			}
+			_, hasDefault := fm["default"]
+			s.fields = append(s.fields, avroField{name: name, typ: typ, hasDefault: hasDefault})
+		}
+	case "enum":
+		if _, err := c.define(m, namespace, s); err != nil {
+			return nil, err
+		}
+		symbols, ok := m["symbols"].([]interface{})
+		if !ok || len(symbols) == 0 {
+			return nil, errors.Wrapf(ErrInvalidSchema, "enum %s requires symbols", s.name)
+		}
+		for _, sym := range symbols {
+			str, ok := sym.(string)
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidSchema, "invalid symbol in enum %s", s.name)
+			}
+			s.symbols = append(s.symbols, str)
+		}
+	case "array":
+		items, err := c.compile(m["items"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.items = items
+	case "map":
+		values, err := c.compile(m["values"], namespace)
+		if err != nil {
+			return nil, err
+		}
+		s.values = values
+	case "fixed":
+		if _, err := c.define(m, namespace, s); err != nil {
+			return nil, err
+		}
+		size, ok := m["size"].(float64)
+		if !ok || size < 0 || size != math.Trunc(size) {
+			return nil, errors.Wrapf(ErrInvalidSchema, "fixed %s requires size", s.name)
+		}
+		s.size = int(size)
+	default:
+		// primitive with attributes, e.g. {"type": "string", "logicalType": "uuid"}
+		if avroPrimitives[kind] {
+			return s, nil
+		}
+		if named, ok := c.lookup(kind, namespace); ok {
+			return named, nil
+		}
+		return nil, errors.Wrapf(ErrInvalidSchema, "unknown type %q", kind)
+	}
+	return s, nil
+}
+
+// typeName returns the name used in the union of JSON encoding
+func (s *avroSchema) typeName() string {
+	if len(s.name) != 0 {
+		return s.name
+	}
+	return s.kind
+}
+
+// validateJSON returns error when the JSON encoded data does not conform to the schema
+func (s *avroSchema) validateJSON(data []byte) error {
+	var v interface{}
+	if err := decodeJSONNumber(data, &v); err != nil {
+		return errors.Wrapf(ErrSchemaViolation, "invalid json: %v", err)
+	}
+	if err := s.validateJSONValue(v, "$"); err != nil {
+		return errors.Wrap(ErrSchemaViolation, err.Error())
+	}
+	return nil
+}
+
+func (s *avroSchema) validateJSONValue(v interface{}, path string) error {
+	mismatch := func() error {
+		return errors.Errorf("%s: want %s, got %s", path, s.typeName(), jsonTypeName(v))
+	}
+	switch s.kind {
+	case "null":
+		if v != nil {
+			return mismatch()
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+	case "int", "long":
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return mismatch()
+		}
+		if s.kind == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return errors.Errorf("%s: out of range of int", path)
+		}
+	case "float", "double":
+		if _, ok := v.(json.Number); !ok {
+			return mismatch()
+		}
+	case "bytes", "string":
+		if _, ok := v.(string); !ok {
+			return mismatch()
+		}
+	case "fixed":
+		str, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		// bytes are encoded to the code points 0-255
+		if n := len([]rune(str)); n != s.size {
+			return errors.Errorf("%s: want %d bytes, got %d", path, s.size, n)
+		}
+	case "enum":
+		str, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		for _, sym := range s.symbols {
+			if sym == str {
+				return nil
+			}
+		}
+		return errors.Errorf("%s: unknown symbol %q", path, str)
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for i, e := range list {
+			if err := s.items.validateJSONValue(e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for k, e := range m {
+			if err := s.values.validateJSONValue(e, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case "record":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for _, f := range s.fields {
+			e, ok := m[f.name]
+			if !ok {
+				if f.hasDefault {
+					continue
+				}
+				return errors.Errorf("%s: missing field %q", path, f.name)
+			}
+			if err := f.typ.validateJSONValue(e, path+"."+f.name); err != nil {
+				return err
+			}
+		}
+		for k := range m {
+			if !s.hasField(k) {
+				return errors.Errorf("%s: unknown field %q", path, k)
+			}
+		}
+	case "union":
+		// null is encoded as is, the others are wrapped by {"type name": value}
+		if v == nil {
+			for _, b := range s.branches {
+				if b.kind == "null" {
+					return nil
+				}
+			}
+			return errors.Errorf("%s: null is not allowed", path)
+		}
+		m, ok := v.(map[string]interface{})
+		if !ok || len(m) != 1 {
+			return errors.Errorf("%s: union value must be wrapped by the type name", path)
+		}
+		for name, e := range m {
+			for _, b := range s.branches {
+				if b.typeName() == name {
+					return b.validateJSONValue(e, path+"."+name)
+				}
+			}
+			return errors.Errorf("%s: unknown union branch %q", path, name)
+		}
+	}
+	return nil
+}
+
+func (s *avroSchema) hasField(name string) bool {
+	for _, f := range s.fields {
+		if f.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBinary returns error when the binary encoded data does not conform to the schema
+func (s *avroSchema) validateBinary(data []byte) error {
+	r := &avroReader{buf: data}
+	if err := s.readBinary(r, "$"); err != nil {
+		return errors.Wrap(ErrSchemaViolation, err.Error())
+	}
+	if len(r.buf) != 0 {
+		return errors.Wrapf(ErrSchemaViolation, "%d bytes remain after the value", len(r.buf))
+	}
+	return nil
+}
+
+// avroReader consume the Avro binary encoding
+type avroReader struct {
+	buf []byte
+}
+
+func (r *avroReader) read(n int, path string) ([]byte, error) {
+	if n < 0 || len(r.buf) < n {
+		return nil, errors.Errorf("%s: unexpected end of data", path)
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b, nil
+}
+
+// readLong read zigzag encoded variable-length integer
+func (r *avroReader) readLong(path string) (int64, error) {
+	u, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		return 0, errors.Errorf("%s: invalid variable-length integer", path)
+	}
+	r.buf = r.buf[n:]
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (s *avroSchema) readBinary(r *avroReader, path string) error {
+	switch s.kind {
+	case "null":
+	case "boolean":
+		b, err := r.read(1, path)
+		if err != nil {
+			return err
+		}
+		if b[0] > 1 {
+			return errors.Errorf("%s: invalid boolean", path)
+		}
+	case "int", "long":
+		i, err := r.readLong(path)
+		if err != nil {
+			return err
+		}
+		if s.kind == "int" && (i < math.MinInt32 || i > math.MaxInt32) {
+			return errors.Errorf("%s: out of range of int", path)
+		}
+	case "float":
+		_, err := r.read(4, path)
+		return err
+	case "double":
+		_, err := r.read(8, path)
+		return err
+	case "bytes", "string":
+		n, err := r.readLong(path)
+		if err != nil {
+			return err
+		}
+		_, err = r.read(int(n), path)
+		return err
+	case "fixed":
+		_, err := r.read(s.size, path)
+		return err
+	case "enum":
+		i, err := r.readLong(path)
+		if err != nil {
+			return err
+		}
+		if i < 0 || int(i) >= len(s.symbols) {
+			return errors.Errorf("%s: invalid enum index %d", path, i)
+		}
+	case "array", "map":
+		for i := 0; ; {
+			count, err := r.readLong(path)
+			if err != nil {
+				return err
+			}
+			if count == 0 {
+				break
+			}
+			if count < 0 {
+				// negative count is followed by the block size
+				count = -count
+				if _, err := r.readLong(path); err != nil {
+					return err
+				}
+			}
+			for ; count > 0; count-- {
+				elemPath := fmt.Sprintf("%s[%d]", path, i)
+				if s.kind == "map" {
+					key := &avroSchema{kind: "string"}
+					if err := key.readBinary(r, elemPath); err != nil {
+						return err
+					}
+					if err := s.values.readBinary(r, elemPath); err != nil {
+						return err
+					}
+				} else if err := s.items.readBinary(r, elemPath); err != nil {
+					return err
+				}
+				i++
+			}
+		}
+	case "record":
+		for _, f := range s.fields {
+			if err := f.typ.readBinary(r, path+"."+f.name); err != nil {
+				return err
+			}
+		}
+	case "union":
+		i, err := r.readLong(path)
+		if err != nil {
+			return err
+		}
+		if i < 0 || int(i) >= len(s.branches) {
+			return errors.Errorf("%s: invalid union index %d", path, i)
+		}
+		return s.branches[i].readBinary(r, path)
+	}
+	return nil
+}
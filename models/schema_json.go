@@ -0,0 +1,443 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// jsonSchema is compiled JSON Schema.
+// supported keywords are type, enum, const, properties, required, additionalProperties,
+// items, minItems, maxItems, minLength, maxLength, pattern, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, allOf, anyOf, oneOf and not,
+// the other keywords are rejected to not accept the data violating the schema.
+type jsonSchema struct {
+	// always is set when the schema is boolean
+	always *bool
+
+	types                []string
+	enum                 []interface{}
+	constValue           interface{}
+	hasConst             bool
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	items                *jsonSchema
+	minItems, maxItems   *int
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+	minimum, maximum     *float64
+	exclusiveMin         *float64
+	exclusiveMax         *float64
+	allOf, anyOf, oneOf  []*jsonSchema
+	not                  *jsonSchema
+}
+
+// jsonSchemaKeywords is the supported validation keywords and the annotations not affecting the validation
+var jsonSchemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "properties": true, "required": true,
+	"additionalProperties": true, "items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "pattern": true, "minimum": true, "maximum": true,
+	"exclusiveMinimum": true, "exclusiveMaximum": true, "allOf": true, "anyOf": true,
+	"oneOf": true, "not": true,
+
+	// annotations
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// compileJSONSchema returns compiled JSON Schema from the definition
+func compileJSONSchema(definition string) (*jsonSchema, error) {
+	var raw interface{}
+	if err := decodeJSONNumber([]byte(definition), &raw); err != nil {
+		return nil, errors.Wrapf(ErrInvalidSchema, "failed to parse json: %v", err)
+	}
+	return compileJSONSchemaValue(raw, "#")
+}
+
+// decodeJSONNumber decode json with keeping the numbers as json.Number
+func decodeJSONNumber(data []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return err
+	}
+	if d.More() {
+		return errors.New("unexpected data after the top-level value")
+	}
+	return nil
+}
+
+func compileJSONSchemaValue(raw interface{}, path string) (*jsonSchema, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return errors.Wrapf(ErrInvalidSchema, "%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	if b, ok := raw.(bool); ok {
+		return &jsonSchema{always: &b}, nil
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, invalid("schema must be object or boolean")
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !jsonSchemaKeywords[k] {
+			return nil, invalid("%s is not supported", k)
+		}
+	}
+
+	s := &jsonSchema{}
+	var err error
+	if v, ok := m["type"]; ok {
+		switch t := v.(type) {
+		case string:
+			s.types = []string{t}
+		case []interface{}:
+			for _, e := range t {
+				name, ok := e.(string)
+				if !ok {
+					return nil, invalid("type must be string or array of string")
+				}
+				s.types = append(s.types, name)
+			}
+		default:
+			return nil, invalid("type must be string or array of string")
+		}
+		for _, t := range s.types {
+			if !jsonSchemaTypes[t] {
+				return nil, invalid("unknown type %q", t)
+			}
+		}
+	}
+	if v, ok := m["enum"]; ok {
+		if s.enum, ok = v.([]interface{}); !ok {
+			return nil, invalid("enum must be array")
+		}
+	}
+	if v, ok := m["const"]; ok {
+		s.constValue, s.hasConst = v, true
+	}
+	if v, ok := m["properties"]; ok {
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, invalid("properties must be object")
+		}
+		s.properties = make(map[string]*jsonSchema, len(props))
+		for k, p := range props {
+			if s.properties[k], err = compileJSONSchemaValue(p, path+"/properties/"+k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if v, ok := m["required"]; ok {
+		req, ok := v.([]interface{})
+		if !ok {
+			return nil, invalid("required must be array of string")
+		}
+		for _, e := range req {
+			name, ok := e.(string)
+			if !ok {
+				return nil, invalid("required must be array of string")
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if v, ok := m["additionalProperties"]; ok {
+		if s.additionalProperties, err = compileJSONSchemaValue(v, path+"/additionalProperties"); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := m["items"]; ok {
+		if s.items, err = compileJSONSchemaValue(v, path+"/items"); err != nil {
+			return nil, err
+		}
+	}
+	if v, ok := m["not"]; ok {
+		if s.not, err = compileJSONSchemaValue(v, path+"/not"); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+		list, ok := v.([]interface{})
+		if !ok || len(list) == 0 {
+			return nil, invalid("%s must be non-empty array", key)
+		}
+		compiled := make([]*jsonSchema, 0, len(list))
+		for i, e := range list {
+			c, err := compileJSONSchemaValue(e, fmt.Sprintf("%s/%s/%d", path, key, i))
+			if err != nil {
+				return nil, err
+			}
+			compiled = append(compiled, c)
+		}
+		switch key {
+		case "allOf":
+			s.allOf = compiled
+		case "anyOf":
+			s.anyOf = compiled
+		case "oneOf":
+			s.oneOf = compiled
+		}
+	}
+	for key, dst := range map[string]**int{
+		"minItems": &s.minItems, "maxItems": &s.maxItems,
+		"minLength": &s.minLength, "maxLength": &s.maxLength,
+	} {
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, invalid("%s must be integer", key)
+		}
+		i, err := n.Int64()
+		if err != nil || i < 0 {
+			return nil, invalid("%s must be non-negative integer", key)
+		}
+		size := int(i)
+		*dst = &size
+	}
+	for key, dst := range map[string]**float64{
+		"minimum": &s.minimum, "maximum": &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMin, "exclusiveMaximum": &s.exclusiveMax,
+	} {
+		v, ok := m[key]
+		if !ok {
+			continue
+		}
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, invalid("%s must be number", key)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, invalid("%s must be number", key)
+		}
+		*dst = &f
+	}
+	if v, ok := m["pattern"]; ok {
+		p, ok := v.(string)
+		if !ok {
+			return nil, invalid("pattern must be string")
+		}
+		if s.pattern, err = regexp.Compile(p); err != nil {
+			return nil, invalid("invalid pattern: %v", err)
+		}
+	}
+	return s, nil
+}
+
+// validate returns error when the data does not conform to the schema
+func (s *jsonSchema) validate(data []byte) error {
+	var v interface{}
+	if err := decodeJSONNumber(data, &v); err != nil {
+		return errors.Wrapf(ErrSchemaViolation, "invalid json: %v", err)
+	}
+	if err := s.validateValue(v, "$"); err != nil {
+		return errors.Wrap(ErrSchemaViolation, err.Error())
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateValue(v interface{}, path string) error {
+	if s.always != nil {
+		if !*s.always {
+			return errors.Errorf("%s: not allowed", path)
+		}
+		return nil
+	}
+
+	if len(s.types) != 0 {
+		matched := false
+		for _, t := range s.types {
+			if jsonTypeMatch(t, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.Errorf("%s: want type %v, got %s", path, s.types, jsonTypeName(v))
+		}
+	}
+	if s.enum != nil {
+		matched := false
+		for _, e := range s.enum {
+			if jsonEqual(e, v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.Errorf("%s: not in enum", path)
+		}
+	}
+	if s.hasConst && !jsonEqual(s.constValue, v) {
+		return errors.Errorf("%s: not equal to const", path)
+	}
+
+	switch a := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.required {
+			if _, ok := a[name]; !ok {
+				return errors.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		keys := make([]string, 0, len(a))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if p, ok := s.properties[k]; ok {
+				if err := p.validateValue(a[k], path+"."+k); err != nil {
+					return err
+				}
+			} else if s.additionalProperties != nil {
+				if err := s.additionalProperties.validateValue(a[k], path+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if s.minItems != nil && len(a) < *s.minItems {
+			return errors.Errorf("%s: want at least %d items", path, *s.minItems)
+		}
+		if s.maxItems != nil && len(a) > *s.maxItems {
+			return errors.Errorf("%s: want at most %d items", path, *s.maxItems)
+		}
+		if s.items != nil {
+			for i, e := range a {
+				if err := s.items.validateValue(e, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(a)
+		if s.minLength != nil && n < *s.minLength {
+			return errors.Errorf("%s: want length at least %d", path, *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			return errors.Errorf("%s: want length at most %d", path, *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(a) {
+			return errors.Errorf("%s: not match pattern %s", path, s.pattern)
+		}
+	case json.Number:
+		f, _ := a.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			return errors.Errorf("%s: want minimum %v", path, *s.minimum)
+		}
+		if s.maximum != nil && f > *s.maximum {
+			return errors.Errorf("%s: want maximum %v", path, *s.maximum)
+		}
+		if s.exclusiveMin != nil && f <= *s.exclusiveMin {
+			return errors.Errorf("%s: want greater than %v", path, *s.exclusiveMin)
+		}
+		if s.exclusiveMax != nil && f >= *s.exclusiveMax {
+			return errors.Errorf("%s: want less than %v", path, *s.exclusiveMax)
+		}
+	}
+
+	for _, sub := range s.allOf {
+		if err := sub.validateValue(v, path); err != nil {
+			return err
+		}
+	}
+	if s.anyOf != nil {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.validateValue(v, path) == nil {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.Errorf("%s: not match any of anyOf", path)
+		}
+	}
+	if s.oneOf != nil {
+		count := 0
+		for _, sub := range s.oneOf {
+			if sub.validateValue(v, path) == nil {
+				count++
+			}
+		}
+		if count != 1 {
+			return errors.Errorf("%s: want to match exactly one of oneOf, matched %d", path, count)
+		}
+	}
+	if s.not != nil && s.not.validateValue(v, path) == nil {
+		return errors.Errorf("%s: must not match the schema of not", path)
+	}
+	return nil
+}
+
+func jsonTypeName(v interface{}) string {
+	switch a := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if isJSONInteger(a) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
+
+func jsonTypeMatch(t string, v interface{}) bool {
+	name := jsonTypeName(v)
+	return t == name || (t == "number" && name == "integer")
+}
+
+func isJSONInteger(n json.Number) bool {
+	if _, err := n.Int64(); err == nil {
+		return true
+	}
+	f, err := n.Float64()
+	return err == nil && f == math.Trunc(f) && !math.IsInf(f, 0)
+}
+
+// jsonEqual compare the json values, the numbers are compared by the value
+func jsonEqual(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		return aerr == nil && berr == nil && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
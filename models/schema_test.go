@@ -0,0 +1,210 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	testJSONSchema = `{
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "minLength": 1},
+			"age": {"type": "integer", "minimum": 0},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2},
+			"kind": {"enum": ["a", "b"]}
+		},
+		"required": ["name"],
+		"additionalProperties": false
+	}`
+
+	testAvroSchema = `{
+		"type": "record",
+		"name": "User",
+		"namespace": "example",
+		"fields": [
+			{"name": "name", "type": "string"},
+			{"name": "age", "type": "int"},
+			{"name": "email", "type": ["null", "string"], "default": null},
+			{"name": "kind", "type": {"type": "enum", "name": "Kind", "symbols": ["A", "B"]}, "default": "A"}
+		]
+	}`
+)
+
+func TestCompileSchema(t *testing.T) {
+	cases := []struct {
+		typ        SchemaType
+		definition string
+		expectErr  error
+	}{
+		{SchemaTypeJSON, testJSONSchema, nil},
+		{SchemaTypeJSON, `true`, nil},
+		{SchemaTypeJSON, `{"type": "unknown"}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"$ref": "#/definitions/a"}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"pattern": "("}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"$schema": "https://json-schema.org/draft/2020-12/schema", "title": "a", "type": "object"}`, nil},
+		{SchemaTypeJSON, `{"type": "array", "uniqueItems": true}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"multipleOf": 5}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"minProperties": 2}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"properties": {"a": {"patternProperties": {"^x": true}}}}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{"if": {"type": "string"}, "then": {"minLength": 1}}`, ErrInvalidSchema},
+		{SchemaTypeJSON, `{`, ErrInvalidSchema},
+		{SchemaTypeAvro, testAvroSchema, nil},
+		{SchemaTypeAvro, `"long"`, nil},
+		{SchemaTypeAvro, `{"type": "array", "items": {"type": "map", "values": "bytes"}}`, nil},
+		{SchemaTypeAvro, `{"type": "record", "name": "A", "fields": [{"name": "next", "type": ["null", "A"]}]}`, nil},
+		{SchemaTypeAvro, `{"type": "record", "fields": []}`, ErrInvalidSchema},
+		{SchemaTypeAvro, `"unknown"`, ErrInvalidSchema},
+		{SchemaTypeAvro, `["null", ["int"]]`, ErrInvalidSchema},
+		{"xml", `{}`, ErrInvalidSchemaType},
+	}
+	for i, c := range cases {
+		s := &Schema{Type: c.typ, Definition: c.definition}
+		_, err := s.compile()
+		if errors.Cause(err) != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+	}
+}
+
+func TestValidateMessage(t *testing.T) {
+	jsonSchema := &Schema{Type: SchemaTypeJSON, Definition: testJSONSchema}
+	avroSchema := &Schema{Type: SchemaTypeAvro, Definition: testAvroSchema}
+
+	cases := []struct {
+		schema    *Schema
+		encoding  SchemaEncoding
+		data      []byte
+		expectErr error
+	}{
+		// json schema
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "age": 1, "tags": ["x"], "kind": "a"}`), nil},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "age": 1.0}`), nil},
+		{jsonSchema, EncodingJSON, []byte(`{"age": 1}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": ""}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "age": -1}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "age": 1.5}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "tags": ["x", "y", "z"]}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "kind": "c"}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a", "other": 1}`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`not json`), ErrSchemaViolation},
+		{jsonSchema, EncodingJSON, []byte(`{"name": "a"} {}`), ErrSchemaViolation},
+
+		// avro json encoding
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 1, "email": {"string": "a@example.com"}, "kind": "B"}`), nil},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 1, "email": null}`), nil},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 1}`), nil},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a"}`), ErrSchemaViolation},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 2147483648}`), ErrSchemaViolation},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 1, "email": "a@example.com"}`), ErrSchemaViolation},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 1, "kind": "C"}`), ErrSchemaViolation},
+		{avroSchema, EncodingJSON, []byte(`{"name": "a", "age": 1, "other": 1}`), ErrSchemaViolation},
+
+		// avro binary encoding: name="a", age=1, email=null, kind=B
+		{avroSchema, EncodingBinary, []byte{0x02, 'a', 0x02, 0x00, 0x02}, nil},
+		// email="b"
+		{avroSchema, EncodingBinary, []byte{0x02, 'a', 0x02, 0x02, 0x02, 'b', 0x00}, nil},
+		// truncated
+		{avroSchema, EncodingBinary, []byte{0x02, 'a', 0x02}, ErrSchemaViolation},
+		// invalid union index
+		{avroSchema, EncodingBinary, []byte{0x02, 'a', 0x02, 0x04, 0x00}, ErrSchemaViolation},
+		// invalid enum index
+		{avroSchema, EncodingBinary, []byte{0x02, 'a', 0x02, 0x00, 0x04}, ErrSchemaViolation},
+		// trailing bytes
+		{avroSchema, EncodingBinary, []byte{0x02, 'a', 0x02, 0x00, 0x02, 0x00}, ErrSchemaViolation},
+	}
+	for i, c := range cases {
+		err := c.schema.ValidateMessage(c.data, c.encoding)
+		if errors.Cause(err) != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+	}
+}
+
+func TestSchemaRevisions(t *testing.T) {
+	setupDatastore(t)
+
+	if _, err := NewSchema("s", SchemaTypeJSON, `{"type": "object"}`); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if _, err := NewSchema("s", SchemaTypeJSON, `{"type": "object"}`); err != ErrAlreadyExistSchema {
+		t.Fatalf("want %v, got %v", ErrAlreadyExistSchema, err)
+	}
+	if _, err := CommitSchema("s", `{"type": "unknown"}`); errors.Cause(err) != ErrInvalidSchema {
+		t.Fatalf("want %v, got %v", ErrInvalidSchema, err)
+	}
+	s, err := CommitSchema("s", `{"type": "object", "required": ["id"]}`)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if s.RevisionID != "2" {
+		t.Errorf("want revision 2, got %s", s.RevisionID)
+	}
+	latest, err := GetSchema("s")
+	if err != nil || latest.RevisionID != "2" {
+		t.Errorf("want latest revision 2, got %v, %v", latest, err)
+	}
+	first, err := GetSchemaRevision("s", "1")
+	if err != nil || first.Definition != `{"type": "object"}` {
+		t.Errorf("want first revision, got %v, %v", first, err)
+	}
+	revisions, err := ListSchemaRevisions("s")
+	if err != nil || len(revisions) != 2 {
+		t.Errorf("want 2 revisions, got %v, %v", revisions, err)
+	}
+
+	// the topic validates with the latest revision
+	topic, err := NewTopic("t", TopicOptions{SchemaSettings: &SchemaSettings{Schema: "s", Encoding: EncodingJSON}})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := topic.ValidateMessage([]byte(`{}`)); errors.Cause(err) != ErrSchemaViolation {
+		t.Errorf("want %v, got %v", ErrSchemaViolation, err)
+	}
+	if err := topic.ValidateMessage([]byte(`{"id": 1}`)); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+
+	// in use by the topic
+	if err := DeleteSchema("s"); errors.Cause(err) != ErrSchemaInUse {
+		t.Errorf("want %v, got %v", ErrSchemaInUse, err)
+	}
+	if err := topic.Update(TopicOptions{}, []string{MaskSchemaSettings}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := DeleteSchema("s"); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+	if _, err := GetSchema("s"); err == nil {
+		t.Errorf("want error, got nil")
+	}
+}
+
+func TestSchemaSettings(t *testing.T) {
+	setupDatastore(t)
+	if _, err := NewSchema("json", SchemaTypeJSON, `true`); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if _, err := NewSchema("avro", SchemaTypeAvro, `"string"`); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	cases := []struct {
+		input     *SchemaSettings
+		expectErr error
+	}{
+		{nil, nil},
+		{&SchemaSettings{Schema: "json", Encoding: EncodingJSON}, nil},
+		{&SchemaSettings{Schema: "avro", Encoding: EncodingBinary}, nil},
+		{&SchemaSettings{Schema: "json", Encoding: EncodingBinary}, ErrInvalidSchemaSettings},
+		{&SchemaSettings{Schema: "json", Encoding: "xml"}, ErrInvalidSchemaSettings},
+		{&SchemaSettings{Schema: "none", Encoding: EncodingJSON}, ErrInvalidSchemaSettings},
+	}
+	for i, c := range cases {
+		err := c.input.validate()
+		if errors.Cause(err) != c.expectErr {
+			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"context"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,12 +19,18 @@ type Subscription struct {
 	Message            *MessageStatusStore `json:"-"`
 	DefaultAckDeadline time.Duration       `json:"ack_deadline_seconds"`
 	PushConfig         *Push               `json:"push_config"`
+	MessageRetention   time.Duration       `json:"message_retention_duration"`
+	Filter             string              `json:"filter"`
+	Detached           bool                `json:"detached"`
+	ExportConfig       *Export             `json:"export_config"`
+	Metadata
 
 	// push params
 	PushTick    time.Duration `json:"-"`
 	AbortPush   bool          `json:"-"`
 	PushRunning bool          `json:"-"`
 	PushSize    int           `json:"-"`
+	PushBackoff time.Duration `json:"-"`
 	abortMu     sync.RWMutex
 	runningMu   sync.RWMutex
 	sizeMu      sync.RWMutex
@@ -34,8 +43,218 @@ const (
 	MinPushSize  = 1
 )
 
+// MaxMessageRetention is upper limit of the MessageRetention, 0 is unlimited
+const MaxMessageRetention = 7 * 24 * time.Hour
+
+// Subscription update mask paths
+const (
+	MaskAckDeadline = "ack_deadline_seconds"
+	MaskPushConfig  = "push_config"
+	MaskRetention   = "message_retention_seconds"
+	MaskFilter      = "filter"
+)
+
+// SubscriptionOptions is optional fields of the Subscription
+type SubscriptionOptions struct {
+	MessageRetention time.Duration
+	Filter           string
+	Push             PushOptions
+	// Export makes the export subscription, it is set only at the creation
+	Export *Export
+	Metadata
+}
+
+// validate returns error when the options are invalid
+func (o SubscriptionOptions) validate() error {
+	if err := validateRetention(o.MessageRetention); err != nil {
+		return err
+	}
+	if _, err := ParseFilter(o.Filter); err != nil {
+		return err
+	}
+	if err := o.Push.validate(); err != nil {
+		return err
+	}
+	if err := o.Export.validate(); err != nil {
+		return err
+	}
+	return o.Metadata.Validate()
+}
+
+func validateRetention(d time.Duration) error {
+	if d < 0 || d > MaxMessageRetention {
+		return ErrInvalidRetention
+	}
+	return nil
+}
+
+// SubscriptionUpdate is updatable fields of the Subscription, the fields to update are specified by the update mask
+type SubscriptionUpdate struct {
+	AckDeadlineSeconds int64
+	PushEndpoint       string
+	PushAttributes     map[string]string
+	SubscriptionOptions
+}
+
+// pushLoopGroup keep the context and the running push loops
+type pushLoopGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// wg is renewed with ctx, the loops not finished by stop keep the previous one
+	wg *sync.WaitGroup
+	mu sync.Mutex
+}
+
+var pushLoops = newPushLoopGroup()
+
+func newPushLoopGroup() *pushLoopGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &pushLoopGroup{
+		ctx:    ctx,
+		cancel: cancel,
+		wg:     &sync.WaitGroup{},
+	}
+}
+
+// start run fn with the group context
+func (g *pushLoopGroup) start(fn func(ctx context.Context)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	wg := g.wg
+	wg.Add(1)
+	go func(ctx context.Context) {
+		defer wg.Done()
+		fn(ctx)
+	}(g.ctx)
+}
+
+// stop cancel all push loops and wait for them to finish until ctx is done.
+// after stopped, the group is available for the new push loops.
+func (g *pushLoopGroup) stop(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.cancel()
+	wg := g.wg
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "failed to wait for push loops")
+	}
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	g.wg = &sync.WaitGroup{}
+	return err
+}
+
+// StopPushLoops stop all push loops, and wait for the in-flight push until ctx is done
+func StopPushLoops(ctx context.Context) error {
+	return pushLoops.stop(ctx)
+}
+
+// subscriptionMu serializes the updates of the subscription read from the datastore in this process.
+// the MessageStatus are not saved with the subscription, the updates by the other processes do not drop them.
+var subscriptionMu sync.Mutex
+
+// updateSubscription apply fn to the latest subscription read from the datastore and save it,
+// the fields not changed by fn keep the concurrent updates. nothing is saved when fn returns error.
+func updateSubscription(name string, fn func(latest *Subscription) error) (*Subscription, error) {
+	subscriptionMu.Lock()
+	defer subscriptionMu.Unlock()
+
+	latest, err := GetSubscription(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(latest); err != nil {
+		return nil, err
+	}
+	if err := latest.Save(); err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// setLatest copy the fields of the latest subscription saved to the datastore
+func (s *Subscription) setLatest(latest *Subscription) {
+	s.TopicID = latest.TopicID
+	s.Message = latest.Message
+	s.DefaultAckDeadline = latest.DefaultAckDeadline
+	s.PushConfig = latest.PushConfig
+	s.MessageRetention = latest.MessageRetention
+	s.Filter = latest.Filter
+	s.Detached = latest.Detached
+	s.ExportConfig = latest.ExportConfig
+	s.Metadata = latest.Metadata
+	s.PushTick = latest.PushTick
+	s.PushBackoff = latest.PushBackoff
+
+	s.abortMu.Lock()
+	s.AbortPush = latest.AbortPush
+	s.abortMu.Unlock()
+	s.runningMu.Lock()
+	s.PushRunning = latest.PushRunning
+	s.runningMu.Unlock()
+	s.sizeMu.Lock()
+	s.PushSize = latest.PushSize
+	s.sizeMu.Unlock()
+}
+
+// pushWakeups keep the channels to notify the push loops of the new messages
+var pushWakeups = struct {
+	sync.Mutex
+	m map[string]chan struct{}
+}{m: make(map[string]chan struct{})}
+
+// pushWakeup returns the wakeup channel of the subscription, creates it when missing.
+// only the push loop calls it at the start, the notifications do not create the channel.
+func pushWakeup(name string) chan struct{} {
+	pushWakeups.Lock()
+	defer pushWakeups.Unlock()
+
+	ch, ok := pushWakeups.m[name]
+	if !ok {
+		ch = make(chan struct{}, 1)
+		pushWakeups.m[name] = ch
+	}
+	return ch
+}
+
+// removePushWakeup remove the wakeup channel of the deleted subscription,
+// the running push loop keeps the channel until finished
+func removePushWakeup(name string) {
+	pushWakeups.Lock()
+	defer pushWakeups.Unlock()
+	delete(pushWakeups.m, name)
+}
+
+// wakePushLoop notify the push loop of the subscription without blocking,
+// do nothing when the loop has never started or the subscription is deleted
+func wakePushLoop(name string) {
+	pushWakeups.Lock()
+	ch, ok := pushWakeups.m[name]
+	pushWakeups.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
 // NewSubscription return initialized subscription, if not exist already same name Subscription
-func NewSubscription(name, topicName string, timeout int64, endpoint string, attr map[string]string) (*Subscription, error) {
+func NewSubscription(name, topicName string, timeout int64, endpoint string, attr map[string]string, opts SubscriptionOptions) (*Subscription, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
 	if _, err := GetSubscription(name); err == nil {
 		return nil, ErrAlreadyExistSubscription
 	}
@@ -50,13 +269,24 @@ func NewSubscription(name, topicName string, timeout int64, endpoint string, att
 		DefaultAckDeadline: convertAckDeadlineSeconds(timeout),
 		PushTick:           PushInterval,
 		PushSize:           MinPushSize,
+		MessageRetention:   opts.MessageRetention,
+		Filter:             opts.Filter,
+		Metadata:           opts.Metadata,
+		ExportConfig:       opts.Export,
 	}
-	if err := s.SetPushConfig(endpoint, attr); err != nil {
+	p, err := NewPush(endpoint, attr, opts.Push)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyPushConfig(p); err != nil {
 		return nil, err
 	}
 	if err := s.Save(); err != nil {
 		return nil, err
 	}
+	if err := s.switchPushLoop(); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
@@ -66,9 +296,143 @@ func GetSubscription(name string) (*Subscription, error) {
 	return getGlobalSubscription().Get(name)
 }
 
-// Delete is delete subscription at globalSubscription
+// Delete is delete subscription at globalSubscription.
+// the MessageStatus of the subscription are deleted, and the messages not referenced by any subscription are deleted.
 func (s *Subscription) Delete() error {
-	return getGlobalSubscription().Delete(s.Name)
+	if err := NewMessageStatusStore(s.Name).releaseAll(); err != nil {
+		return errors.Wrapf(err, "failed to release messages, name=%s", s.Name)
+	}
+	if err := getGlobalSubscription().Delete(s.Name); err != nil {
+		return err
+	}
+	// stop the push loop
+	wakePushLoop(s.Name)
+	removePushWakeup(s.Name)
+	return nil
+}
+
+// Detach stops the delivery from the topic, and drops the messages not yet acked.
+// the detached subscription keeps the config, and Pull and Push return ErrSubscriptionDetached.
+func (s *Subscription) Detach() error {
+	subscriptionMu.Lock()
+	defer subscriptionMu.Unlock()
+
+	// goroutine safe
+	latest, err := GetSubscription(s.Name)
+	if err != nil {
+		return err
+	}
+	if latest.Detached {
+		s.Detached = true
+		return nil
+	}
+	if err := NewMessageStatusStore(s.Name).releaseAll(); err != nil {
+		return errors.Wrapf(err, "failed to release messages, name=%s", s.Name)
+	}
+	latest.Detached = true
+	if err := latest.Save(); err != nil {
+		return err
+	}
+	// release the messages registered by the other processes while detaching,
+	// RegisterMessage releases the message registered after saved
+	if err := latest.Message.releaseAll(); err != nil {
+		return errors.Wrapf(err, "failed to release messages, name=%s", s.Name)
+	}
+	s.setLatest(latest)
+	s.sendCurrentMessages()
+	// stop the push loop
+	wakePushLoop(s.Name)
+	return nil
+}
+
+// Update overwrite the fields specified by the paths of the latest subscription, the other fields keep the concurrent updates.
+// all of the fields are validated before applying, nothing is changed when any field is invalid.
+func (s *Subscription) Update(u SubscriptionUpdate, paths []string) error {
+	if len(paths) == 0 {
+		return ErrEmptyUpdateMask
+	}
+	var updatePush bool
+	latest, err := updateSubscription(s.Name, func(latest *Subscription) error {
+		var metaPaths []string
+		for _, p := range paths {
+			switch strings.TrimSpace(p) {
+			case MaskAckDeadline:
+				latest.DefaultAckDeadline = convertAckDeadlineSeconds(u.AckDeadlineSeconds)
+			case MaskPushConfig:
+				push, err := NewPush(u.PushEndpoint, u.PushAttributes, u.Push)
+				if err != nil {
+					return err
+				}
+				if err := latest.applyPushConfig(push); err != nil {
+					return err
+				}
+				updatePush = true
+			case MaskRetention:
+				if err := validateRetention(u.MessageRetention); err != nil {
+					return err
+				}
+				latest.MessageRetention = u.MessageRetention
+			case MaskFilter:
+				if _, err := ParseFilter(u.Filter); err != nil {
+					return err
+				}
+				latest.Filter = u.Filter
+			case MaskLabels, MaskDescription:
+				metaPaths = append(metaPaths, p)
+			default:
+				return ErrInvalidUpdateMask
+			}
+		}
+		if len(metaPaths) != 0 {
+			m, err := latest.Metadata.apply(u.Metadata, metaPaths)
+			if err != nil {
+				return err
+			}
+			latest.Metadata = m
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.setLatest(latest)
+	if updatePush {
+		return s.switchPushLoop()
+	}
+	return nil
+}
+
+// MatchFilter returns whether the message attributes satisfy the filter
+func (s *Subscription) MatchFilter(attr map[string]string) bool {
+	f, err := ParseFilter(s.Filter)
+	if err != nil {
+		// filter is validated at saved, deliver the message rather than drop it
+		log.Printf("failed to parse filter, subscription=%s, error=%v", s.Name, err)
+		return true
+	}
+	return f.Match(attr)
+}
+
+// expireMessages release the messages exceeded the retention
+func (s *Subscription) expireMessages() error {
+	if s.MessageRetention <= 0 {
+		return nil
+	}
+	n, err := s.Message.ExpireMessages(s.MessageRetention)
+	if n > 0 {
+		s.sendCurrentMessages()
+	}
+	return err
+}
+
+// Purge acks the messages published before t regardless of the delivery, the zero t purges the all messages.
+// returns number of purged messages.
+func (s *Subscription) Purge(t time.Time) (int, error) {
+	n, err := s.Message.ReleaseBefore(t)
+	if n > 0 {
+		s.sendCurrentMessages()
+	}
+	return n, err
 }
 
 // ListSubscription returns subscription list from globalSubscription
@@ -76,20 +440,38 @@ func ListSubscription() ([]*Subscription, error) {
 	return getGlobalSubscription().List()
 }
 
-// RegisterMessage associate Message to Subscription
+// RegisterMessage associate Message to Subscription, the subscription itself is not saved.
+// the message is released when the subscription is detached or deleted after the subscriptions of the message are collected.
 func (s *Subscription) RegisterMessage(msg *Message) error {
-	if _, err := s.Message.NewMessageStatus(s.Name, msg.ID, s.DefaultAckDeadline); err != nil {
+	subscriptionMu.Lock()
+	defer subscriptionMu.Unlock()
+
+	// goroutine safe
+	latest, err := GetSubscription(s.Name)
+	if err != nil {
+		if errors.Cause(err) == ErrNotFoundEntry {
+			return msg.AckSubscription(s.Name)
+		}
 		return err
 	}
-	if err := s.Save(); err != nil {
+	ms, err := latest.Message.NewMessageStatus(s.Name, msg.ID, latest.DefaultAckDeadline)
+	if err != nil {
+		return err
+	}
+
+	// detached or deleted while registering
+	latest, err = GetSubscription(s.Name)
+	if err != nil && errors.Cause(err) != ErrNotFoundEntry {
 		return err
 	}
+	if err != nil || latest.Detached {
+		return NewMessageStatusStore(s.Name).release(ms)
+	}
 	s.sendCurrentMessages()
 
 	// push
-	if !s.isPullMode() {
-		_, err := s.Push(1)
-		return err
+	if !latest.isPullMode() {
+		wakePushLoop(s.Name)
 	}
 
 	return nil
@@ -101,8 +483,22 @@ type PullMessage struct {
 	Message *Message `json:"message"`
 }
 
+// pullMu serializes Pull, the concurrent pulls must not deliver the same message
+var pullMu sync.Mutex
+
 // Pull returns readable messages, and change message state
 func (s *Subscription) Pull(size int) ([]*PullMessage, error) {
+	if s.Detached {
+		return nil, ErrSubscriptionDetached
+	}
+	if s.ExportConfig != nil {
+		return nil, ErrExportSubscription
+	}
+	pullMu.Lock()
+	defer pullMu.Unlock()
+	if err := s.expireMessages(); err != nil {
+		return nil, err
+	}
 	msgs, err := s.Message.CollectReadableMessage(size)
 	if err != nil {
 		return nil, err
@@ -111,7 +507,7 @@ func (s *Subscription) Pull(size int) ([]*PullMessage, error) {
 	pullMsgs := make([]*PullMessage, 0, len(msgs))
 	for _, m := range msgs {
 		ackID := makeAckID()
-		if err := s.Message.Deliver(m.ID, ackID); err != nil {
+		if err := s.Message.Deliver(m.ID, ackID, s.DefaultAckDeadline); err != nil {
 			return nil, err
 		}
 		pullMsgs = append(pullMsgs, &PullMessage{AckID: ackID, Message: m})
@@ -119,6 +515,30 @@ func (s *Subscription) Pull(size int) ([]*PullMessage, error) {
 	return pullMsgs, nil
 }
 
+// deliverMessages lease the messages with the new AckIDs, and returns the delivered messages and the AckIDs.
+// the messages failed to deliver are skipped, the error is returned when no message is delivered.
+func (s *Subscription) deliverMessages(msgs []*Message) ([]*Message, []string, error) {
+	delivered := make([]*Message, 0, len(msgs))
+	ackIDs := make([]string, 0, len(msgs))
+	var firstErr error
+	for _, msg := range msgs {
+		ackID := makeAckID()
+		if err := s.Message.Deliver(msg.ID, ackID, s.DefaultAckDeadline); err != nil {
+			log.Printf("failed to deliver message, subscription=%s, message=%s, error=%v", s.Name, msg.ID, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delivered = append(delivered, msg)
+		ackIDs = append(ackIDs, ackID)
+	}
+	if len(delivered) == 0 && firstErr != nil {
+		return nil, nil, firstErr
+	}
+	return delivered, ackIDs, nil
+}
+
 // SentState is state of send push message
 type SentState int
 
@@ -126,6 +546,7 @@ const (
 	_ SentState = iota
 	sentSucceed
 	sentFailed
+	sentNacked
 	notSent
 )
 
@@ -135,6 +556,8 @@ func (s SentState) String() string {
 		return "Succeed"
 	case sentFailed:
 		return "Failed"
+	case sentNacked:
+		return "Nacked"
 	case notSent:
 		return "Not send"
 	default:
@@ -144,6 +567,12 @@ func (s SentState) String() string {
 
 // Push send message to push endpoint, returns send flag and error
 func (s *Subscription) Push(size int) (SentState, error) {
+	if s.Detached {
+		return notSent, ErrSubscriptionDetached
+	}
+	if err := s.expireMessages(); err != nil {
+		return notSent, err
+	}
 	msgs, err := s.Message.CollectReadableMessage(size)
 	if err != nil {
 		// empty message is non error
@@ -152,119 +581,337 @@ func (s *Subscription) Push(size int) (SentState, error) {
 		}
 		return notSent, err
 	}
-	for _, msg := range msgs {
-		ackID := makeAckID()
-		s.Message.Deliver(msg.ID, ackID)
-		err := s.PushConfig.sendMessage(msg, s.Name)
+	msgs, ackIDs, err := s.deliverMessages(msgs)
+	if err != nil {
+		return notSent, err
+	}
+
+	// send the requests up to the concurrency at once, the failed messages are redelivered after the ack deadline,
+	// and the nacked messages after the redelivery delay of the response
+	batch := s.PushConfig.batchSize()
+	errs := make([]error, (len(msgs)+batch-1)/batch)
+	sem := make(chan struct{}, s.PushConfig.concurrency())
+	var wg sync.WaitGroup
+	for i := range errs {
+		end := (i + 1) * batch
+		if end > len(msgs) {
+			end = len(msgs)
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, msgs []*Message) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = s.PushConfig.sendMessages(msgs, s)
+		}(i, msgs[i*batch:end])
+	}
+	wg.Wait()
+
+	state := sentSucceed
+	var (
+		firstErr  error
+		succeeded bool
+		nacked    bool
+	)
+	for i, err := range errs {
+		end := (i + 1) * batch
+		if end > len(ackIDs) {
+			end = len(ackIDs)
+		}
+		if nack, ok := errors.Cause(err).(*PushNack); ok {
+			nacked = true
+			if err := s.nack(nack.Delay, ackIDs[i*batch:end]...); err != nil {
+				log.Printf("failed to nack push messages, subscription=%s, error=%v", s.Name, err)
+			}
+			continue
+		}
 		if err != nil {
-			return sentFailed, err
+			if firstErr == nil {
+				state, firstErr = sentFailed, err
+			}
+			continue
 		}
-		s.Ack(ackID)
+		succeeded = true
+		s.Ack(ackIDs[i*batch : end]...)
+	}
+	if nacked && !succeeded && firstErr == nil {
+		state = sentNacked
 	}
+	if err := s.recordPushResult(succeeded, firstErr); err != nil {
+		log.Printf("failed to save push health, subscription=%s, error=%v", s.Name, err)
+	}
+	return state, firstErr
+}
 
-	return sentSucceed, nil
+// recordPushResult update the PushHealth of the endpoint by the result of the push, and send the stats
+func (s *Subscription) recordPushResult(succeeded bool, pushErr error) error {
+	now := time.Now()
+	backoff := s.PushBackoff
+	if backoff <= 0 {
+		backoff = MinPushBackoff
+	}
+	h, err := s.PushConfig.updateHealth(func(h *PushHealth) {
+		if succeeded {
+			h.succeed(now)
+		}
+		if pushErr != nil {
+			h.fail(pushErr, now, backoff)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	stats.GetSubscriptionAdapter().PushHealth(s.Name, h.ConsecutiveFailures, h.LastSuccessAt, h.LastErrorAt)
+	return nil
 }
 
 // Ack succeed Message delivery. remove sent Message.
 func (s *Subscription) Ack(ids ...string) error {
-	// collect MessageID list dependent to AckID
-	for _, id := range ids {
-		if err := s.Message.Ack(id); err != nil {
+	for _, err := range s.AckEach(ids...) {
+		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+// AckEach acks the all ids regardless of the failed ids,
+// returns the errors in the same order as ids, or nil when the all ids succeeded
+func (s *Subscription) AckEach(ids ...string) []error {
+	var errs []error
+	for i, id := range ids {
+		if err := s.Message.Ack(id); err != nil {
+			if errs == nil {
+				errs = make([]error, len(ids))
+			}
+			errs[i] = err
+		}
+	}
 
 	s.sendCurrentMessages()
+	return errs
+}
+
+// nack set the ack deadline of the messages to the delay from now, the messages are redelivered after the delay
+func (s *Subscription) nack(delay time.Duration, ids ...string) error {
+	for _, id := range ids {
+		ms, err := s.Message.FindByAckID(id)
+		if err != nil {
+			return err
+		}
+		ms.ModifyDeadline(delay)
+		if err := ms.Save(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// ModifyAckDeadline modify message ack deadline seconds
+// ModifyAckDeadline modify message ack deadline to the seconds from now
 func (s *Subscription) ModifyAckDeadline(id string, timeout int64) error {
 	ms, err := s.Message.FindByAckID(id)
 	if err != nil {
 		return err
 	}
-	ms.AckDeadline = convertAckDeadlineSeconds(timeout)
+	ms.ModifyDeadline(convertAckDeadlineSeconds(timeout))
 	return ms.Save()
 }
 
-// SetPushConfig setting push endpoint with attributes
-func (s *Subscription) SetPushConfig(endpoint string, attribute map[string]string) error {
-	p, err := NewPush(endpoint, attribute)
+// SetPushConfig setting push endpoint with attributes and options to the latest subscription, and switch the push loop
+func (s *Subscription) SetPushConfig(endpoint string, attribute map[string]string, opts PushOptions) error {
+	p, err := NewPush(endpoint, attribute, opts)
+	if err != nil {
+		return err
+	}
+	latest, err := updateSubscription(s.Name, func(latest *Subscription) error {
+		return latest.applyPushConfig(p)
+	})
 	if err != nil {
 		return err
 	}
+	s.setLatest(latest)
+	return s.switchPushLoop()
+}
 
+// applyPushConfig set the push config and the abort flag of the push loop, it does not save the subscription
+func (s *Subscription) applyPushConfig(p *Push) error {
+	if s.ExportConfig != nil && p.HasValidEndpoint() {
+		return ErrExportSubscription
+	}
 	s.PushConfig = p
-	if p.HasValidEndpoint() {
-		// set push
+	if !s.isPullMode() {
+		// set push or export, the running loop aborted by the previous change to pull keeps running
+		s.AbortPush = false
+	} else if s.PushRunning {
+		// set pull
+		s.AbortPush = true
+	}
+	return nil
+}
+
+// switchPushLoop start or stop the push loop by the saved push config
+func (s *Subscription) switchPushLoop() error {
+	if !s.isPullMode() {
 		if err := s.PushLoop(); err != nil {
 			return err
 		}
-	} else {
-		// set pull
-		if s.getRunning() {
-			if err := s.setAbortPush(true); err != nil {
-				return err
-			}
-		}
+		wakePushLoop(s.Name)
+	} else if s.getAbortPush() {
+		wakePushLoop(s.Name)
 	}
-	return s.Save()
+	return nil
 }
 
 func (s *Subscription) isPullMode() bool {
-	return !s.PushConfig.HasValidEndpoint()
+	return !s.PushConfig.HasValidEndpoint() && s.ExportConfig == nil
 }
 
-// PushLoop goroutine that keeps looking for pushable messages
+// PushLoop goroutine that keeps looking for pushable messages, wakes up at the published messages or every PushTick.
+// the loop runs on every process, and pushes only while holding the lease of the subscription.
+// the export subscription writes the messages to the files in the same loop.
 func (s *Subscription) PushLoop() error {
-	// already running loop, or pull mode
-	if s.getRunning() || s.isPullMode() {
+	// pull mode, or already running loop in this process
+	if s.isPullMode() || !markPushLoop(s.Name) {
 		return nil
 	}
 
-	if err := s.setRunning(true); err != nil {
-		return err
+	if !s.getRunning() {
+		if err := s.setRunning(true); err != nil {
+			unmarkPushLoop(s.Name)
+			return err
+		}
 	}
-	go func() {
+	name := s.Name
+	wakeup := pushWakeup(name)
+	pushLoops.start(func(ctx context.Context) {
 		for {
-			// refresh Subscription
-			s, err := GetSubscription(s.Name)
-			if err != nil {
-				log.Println(err.Error())
+			runPushLoop(ctx, name, wakeup)
+			if ctx.Err() != nil {
+				unmarkPushLoop(name)
 				break
 			}
-
-			// check abort
-			if s.getAbortPush() {
+			// keep running when the push config is changed back to push while exiting
+			if finishPushLoop(name) {
 				break
 			}
+		}
 
-			state, err := s.Push(s.getSize())
-			// improve push size, it is determined like TCP slow start
-			if err != nil {
-				log.Println(err.Error())
-			}
-			switch state {
-			case sentSucceed:
-				s.incrementPushSize()
-			case sentFailed:
-				s.decrementPushSize()
+		if err := teardownPushLoop(name); err != nil {
+			log.Println(err.Error())
+		}
+	})
+	return nil
+}
+
+// runPushLoop push the messages of the subscription until the subscription is changed to pull or ctx is done
+func runPushLoop(ctx context.Context, name string, wakeup chan struct{}) {
+	for ctx.Err() == nil {
+		// refresh Subscription
+		s, err := GetSubscription(name)
+		if err != nil {
+			log.Println(err.Error())
+			return
+		}
+
+		// check abort, the push config is changed to pull by the other process as well
+		if s.getAbortPush() || s.Detached || s.isPullMode() {
+			return
+		}
+
+		// wait for the expiration of the lease held by the other process
+		leader, err := acquirePushLease(name)
+		if err != nil {
+			log.Printf("failed to acquire push lease, subscription=%s, error=%v", name, err)
+		}
+		if !leader {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wakeup:
+			case <-time.After(pushLeaseRenewInterval()):
 			}
+			continue
+		}
 
-			time.Sleep(s.PushTick)
+		// wait for the backoff of the failed push to the endpoint, by this or the other subscriptions
+		health, err := s.PushConfig.Health()
+		if err != nil {
+			log.Printf("failed to get push health, subscription=%s, error=%v", name, err)
+		}
+		if wait := time.Until(health.NextAttemptAt); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-wakeup:
+			case <-time.After(minDuration(wait, pushLeaseRenewInterval())):
+			}
+			continue
+		}
+		size := s.getSize()
+		if health.CircuitOpen() {
+			// probe the endpoint with a message
+			size = 1
 		}
 
-		if err := s.teardownPushLoop(); err != nil {
+		var state SentState
+		if s.ExportConfig != nil {
+			state, err = s.Export(size)
+		} else {
+			state, err = s.Push(size)
+		}
+		// improve push size, it is determined like TCP slow start
+		if err != nil {
 			log.Println(err.Error())
 		}
-	}()
-	return nil
+		switch state {
+		case sentSucceed:
+			s.incrementPushSize()
+			// push the remaining messages without waiting
+			continue
+		case sentFailed:
+			s.decrementPushSize()
+		}
+
+		// wait for the new messages, or the redelivery of the messages exceeded the ack deadline
+		select {
+		case <-ctx.Done():
+			return
+		case <-wakeup:
+		case <-time.After(minDuration(s.PushTick, pushLeaseRenewInterval())):
+		}
+	}
 }
 
-func (s *Subscription) teardownPushLoop() error {
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// teardownPushLoop clear the shared state of the push loop and release the lease, only when this process holds the lease.
+// the loop of the other process holding the lease keeps running, e.g. this process is shutting down.
+func teardownPushLoop(name string) error {
+	if err := closeExportWriter(name); err != nil {
+		log.Printf("failed to close export file, subscription=%s, error=%v", name, err)
+	}
+	leader, err := acquirePushLease(name)
+	if err != nil {
+		return errors.Wrapf(err, "failed to acquire push lease, subscription=%s", name)
+	}
+	if !leader {
+		return nil
+	}
+	defer func() {
+		if err := releasePushLease(name); err != nil {
+			log.Printf("failed to release push lease, subscription=%s, error=%v", name, err)
+		}
+	}()
+
 	// goroutine safe
-	s, err := GetSubscription(s.Name)
+	s, err := GetSubscription(name)
 	if err != nil {
 		return err
 	}
@@ -286,13 +933,17 @@ func (s *Subscription) getAbortPush() bool {
 	return s.AbortPush
 }
 
-// setAbortPush setting AbortPush at mutex
+// setAbortPush setting AbortPush at mutex, and save it to the latest subscription
 func (s *Subscription) setAbortPush(b bool) error {
 	s.abortMu.Lock()
-	defer s.abortMu.Unlock()
-
 	s.AbortPush = b
-	return s.Save()
+	s.abortMu.Unlock()
+
+	_, err := updateSubscription(s.Name, func(latest *Subscription) error {
+		latest.AbortPush = b
+		return nil
+	})
+	return err
 }
 
 // getRunning return pushRunning at mutex
@@ -303,13 +954,17 @@ func (s *Subscription) getRunning() bool {
 	return s.PushRunning
 }
 
-// setRunning setting pushRunning at mutex
+// setRunning setting pushRunning at mutex, and save it to the latest subscription
 func (s *Subscription) setRunning(b bool) error {
 	s.runningMu.Lock()
-	defer s.runningMu.Unlock()
-
 	s.PushRunning = b
-	return s.Save()
+	s.runningMu.Unlock()
+
+	_, err := updateSubscription(s.Name, func(latest *Subscription) error {
+		latest.PushRunning = b
+		return nil
+	})
+	return err
 }
 
 // getSize return pushSize at mutex
@@ -320,18 +975,17 @@ func (s *Subscription) getSize() int {
 	return s.PushSize
 }
 
-// setSize setting pushSize at mutex
+// setSize setting pushSize at mutex, and save it to the latest subscription
 func (s *Subscription) setSize(i int) error {
 	s.sizeMu.Lock()
-	defer s.sizeMu.Unlock()
-
-	// goroutine safe
-	s, err := GetSubscription(s.Name)
-	if err != nil {
-		return err
-	}
 	s.PushSize = i
-	return s.Save()
+	s.sizeMu.Unlock()
+
+	_, err := updateSubscription(s.Name, func(latest *Subscription) error {
+		latest.PushSize = i
+		return nil
+	})
+	return err
 }
 
 func (s *Subscription) incrementPushSize() error {
@@ -372,6 +1026,7 @@ func (s *Subscription) sendCurrentMessages() error {
 	for _, msg := range msgs {
 		msgIDs = append(msgIDs, msg.MessageID)
 	}
+	sort.Strings(msgIDs)
 	stats.GetSubscriptionAdapter().CurrentMessages(s.Name, msgIDs)
 	return nil
 }
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 	"time"
@@ -72,7 +75,7 @@ func TestNewSubscription(t *testing.T) {
 		},
 	}
 	for i, c := range cases {
-		got, err := NewSubscription(c.name, c.topicName, c.timeout, c.endpoint, c.attr)
+		got, err := NewSubscription(c.name, c.topicName, c.timeout, c.endpoint, c.attr, SubscriptionOptions{})
 		if errors.Cause(err) != c.expectErr {
 			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
 		}
@@ -116,6 +119,329 @@ func TestDeleteSubscription(t *testing.T) {
 	}
 }
 
+func TestDeleteSubscriptionReleaseMessages(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	subA, err := NewSubscription("release-a", "A", 0, "", nil, SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	subB, err := NewSubscription("release-b", "A", 0, "", nil, SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	msgID := publishMessage(t, "A", "test", nil)
+
+	cases := []struct {
+		input         *Subscription
+		expectMessage bool
+	}{
+		{subA, true}, // still referenced by B
+		{subB, false},
+	}
+	for i, c := range cases {
+		if err := c.input.Delete(); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		statuses, err := getGlobalMessageStatus().ListBySubscriptionID(c.input.Name)
+		if err != nil || len(statuses) != 0 {
+			t.Errorf("#%d: want no message status, got %v, %v", i, statuses, err)
+		}
+		if _, err := globalMessage.Get(msgID); (err == nil) != c.expectMessage {
+			t.Errorf("#%d: want message exists %t, got error %v", i, c.expectMessage, err)
+		}
+	}
+}
+
+func TestDetachSubscription(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	subA, err := NewSubscription("detach-a", "A", 0, "", nil, SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if _, err := NewSubscription("detach-b", "A", 0, "", nil, SubscriptionOptions{}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	msgID := publishMessage(t, "A", "before", nil)
+
+	if err := subA.Detach(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	publishMessage(t, "A", "after", nil)
+
+	subA, err = GetSubscription("detach-a")
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if !subA.Detached {
+		t.Errorf("want detached subscription, got %#v", subA)
+	}
+	if _, err := subA.Pull(10); err != ErrSubscriptionDetached {
+		t.Errorf("want %v, got %v", ErrSubscriptionDetached, err)
+	}
+	if _, err := subA.Push(10); err != ErrSubscriptionDetached {
+		t.Errorf("want %v, got %v", ErrSubscriptionDetached, err)
+	}
+	if statuses, err := getGlobalMessageStatus().ListBySubscriptionID("detach-a"); err != nil || len(statuses) != 0 {
+		t.Errorf("want no message status, got %v, %v", statuses, err)
+	}
+
+	// the other subscription is not affected
+	if _, err := globalMessage.Get(msgID); err != nil {
+		t.Errorf("want message referenced by B, got %v", err)
+	}
+	subB, err := GetSubscription("detach-b")
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if msgs, err := subB.Pull(10); err != nil || len(msgs) != 2 {
+		t.Errorf("want 2 messages, got %v, %v", msgs, err)
+	}
+}
+
+func TestUpdateLatest(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "update-latest", "A")
+
+	// the messages published after the subscription is got are not dropped by the update
+	stale := mustGetSubscription(t, "update-latest")
+	publishMessage(t, "A", "a", nil)
+	u := SubscriptionUpdate{SubscriptionOptions: SubscriptionOptions{Metadata: Metadata{Description: "desc"}}}
+	if err := stale.Update(u, []string{MaskDescription}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if stale.Description != "desc" {
+		t.Errorf("want updated description, got %q", stale.Description)
+	}
+	publishMessage(t, "A", "b", nil)
+	if err := stale.SetPushConfig("", nil, PushOptions{}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	latest := mustGetSubscription(t, "update-latest")
+	if latest.Description != "desc" {
+		t.Errorf("want updated description, got %q", latest.Description)
+	}
+	if msgs, err := latest.Pull(10); err != nil || len(msgs) != 2 {
+		t.Errorf("want 2 messages, got %v, %v", msgs, err)
+	}
+}
+
+func TestRegisterMessageLatest(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	sub, err := NewSubscription("register-latest", "A", 0, "", nil, SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	// the update and the detach are not overwritten by the registration of the stale subscription
+	stale := mustGetSubscription(t, "register-latest")
+	u := SubscriptionUpdate{SubscriptionOptions: SubscriptionOptions{Metadata: Metadata{Labels: map[string]string{"env": "prod"}}}}
+	if err := sub.Update(u, []string{MaskLabels}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	msg := NewMessage(makeMessageID(), []byte("test"), nil, []*Subscription{stale})
+	if err := stale.RegisterMessage(msg); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	latest := mustGetSubscription(t, "register-latest")
+	if latest.Metadata.Labels["env"] != "prod" {
+		t.Errorf("want updated labels, got %#v", latest)
+	}
+	if statuses, err := getGlobalMessageStatus().ListBySubscriptionID("register-latest"); err != nil || len(statuses) != 1 {
+		t.Errorf("want registered message, got %v, %v", statuses, err)
+	}
+
+	// the registration is not dropped by the save of the stale subscription, e.g. by the other process
+	if err := stale.Save(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if msgs, err := mustGetSubscription(t, "register-latest").Message.Peek(); err != nil || len(msgs) != 1 {
+		t.Errorf("want registered message, got %v, %v", msgs, err)
+	}
+
+	if err := sub.Detach(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	msg = NewMessage(makeMessageID(), []byte("test"), nil, []*Subscription{stale})
+	if err := stale.RegisterMessage(msg); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if !mustGetSubscription(t, "register-latest").Detached {
+		t.Errorf("want detached subscription")
+	}
+	if statuses, err := getGlobalMessageStatus().ListBySubscriptionID("register-latest"); err != nil || len(statuses) != 0 {
+		t.Errorf("want no message status, got %v, %v", statuses, err)
+	}
+	if _, err := globalMessage.Get(msg.ID); err == nil {
+		t.Errorf("want message deleted, got referenced")
+	}
+}
+
+func TestDeliverMessages(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "deliver-skip", "A")
+	publishMessage(t, "A", "a", nil)
+	skipID := publishMessage(t, "A", "b", nil)
+	sub := mustGetSubscription(t, "deliver-skip")
+
+	// the message status deleted after collected is skipped
+	msgs, err := sub.Message.CollectReadableMessage(10)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("want 2 messages, got %v, %v", msgs, err)
+	}
+	ms, err := getGlobalMessageStatus().FindBySubscriptionIDAndMessageID(sub.Name, skipID)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if err := ms.Delete(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	delivered, ackIDs, err := sub.deliverMessages(msgs)
+	if err != nil || len(delivered) != 1 || len(ackIDs) != 1 || delivered[0].ID == skipID {
+		t.Errorf("want 1 delivered message, got %v, %v, %v", delivered, ackIDs, err)
+	}
+	if _, _, err := sub.deliverMessages(msgs[:0]); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+	for _, msg := range msgs {
+		if msg.ID == skipID {
+			if _, _, err := sub.deliverMessages([]*Message{msg}); err == nil {
+				t.Errorf("want error, got nil")
+			}
+		}
+	}
+
+	// the wakeup channel is created only by the push loop, and removed with the subscription
+	hasWakeup := func() bool {
+		pushWakeups.Lock()
+		defer pushWakeups.Unlock()
+		_, ok := pushWakeups.m[sub.Name]
+		return ok
+	}
+	wakePushLoop(sub.Name)
+	if hasWakeup() {
+		t.Errorf("want no wakeup channel of the pull subscription")
+	}
+	pushWakeup(sub.Name)
+	if err := sub.Delete(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	wakePushLoop(sub.Name)
+	if hasWakeup() {
+		t.Errorf("want wakeup channel removed")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	sub, err := NewSubscription("purge", "A", 0, "", nil, SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	oldID := publishMessage(t, "A", "old", nil)
+	time.Sleep(10 * time.Millisecond)
+	boundary := time.Now()
+	newID := publishMessage(t, "A", "new", nil)
+	sub, err = GetSubscription("purge")
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	// the delivered message is also purged
+	if _, err := sub.Pull(1); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	cases := []struct {
+		input       time.Time
+		expectCount int
+		expectMsgs  []string
+	}{
+		{boundary, 1, []string{newID}},
+		{boundary, 0, []string{newID}},
+		{time.Time{}, 1, []string{}},
+	}
+	for i, c := range cases {
+		n, err := sub.Purge(c.input)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if n != c.expectCount {
+			t.Errorf("#%d: want %d purged, got %d", i, c.expectCount, n)
+		}
+		statuses, err := sub.Message.CollectAllMessages()
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		msgs := []string{}
+		for _, ms := range statuses {
+			msgs = append(msgs, ms.MessageID)
+		}
+		if !reflect.DeepEqual(msgs, c.expectMsgs) {
+			t.Errorf("#%d: want %v, got %v", i, c.expectMsgs, msgs)
+		}
+	}
+	if _, err := globalMessage.Get(oldID); err == nil {
+		t.Errorf("want the purged message deleted")
+	}
+}
+
+func TestPeek(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	if _, err := NewSubscription("peek", "A", 10, "", nil, SubscriptionOptions{}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	publishMessage(t, "A", "a", nil)
+	publishMessage(t, "A", "b", nil)
+	sub, err := GetSubscription("peek")
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	pulled, err := sub.Pull(1)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	deliveredID := pulled[0].Message.ID
+
+	for i := 0; i < 2; i++ {
+		list, err := sub.Message.Peek()
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if len(list) != 2 {
+			t.Fatalf("#%d: want 2 messages, got %d", i, len(list))
+		}
+		for _, p := range list {
+			delivered := p.Message.ID == deliveredID
+			if want := map[bool]string{true: PeekStateDelivered, false: PeekStateWaiting}[delivered]; p.State != want {
+				t.Errorf("#%d: want state %s, got %s", i, want, p.State)
+			}
+			if want := map[bool]int{true: 1, false: 0}[delivered]; p.DeliveryCount != want {
+				t.Errorf("#%d: want delivery count %d, got %d", i, want, p.DeliveryCount)
+			}
+		}
+	}
+
+	// peek does not lease the message
+	if _, err := sub.Pull(10); err != nil {
+		t.Errorf("want the waiting message, got %v", err)
+	}
+	p, err := sub.Message.PeekByID(deliveredID)
+	if err != nil || p.DeliveryCount != 1 {
+		t.Errorf("want delivery count 1, got %v, %v", p, err)
+	}
+	if _, err := sub.Message.PeekByID("unknown"); errors.Cause(err) != ErrNotFoundEntry {
+		t.Errorf("want %v, got %v", ErrNotFoundEntry, err)
+	}
+}
+
 func TestPullAndAck(t *testing.T) {
 	setupDatastore(t)
 	setupDummyTopics(t)
@@ -213,7 +539,7 @@ func TestPushImmediately(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	err := mustGetSubscription(t, "a").SetPushConfig(ts.URL, nil)
+	err := mustGetSubscription(t, "a").SetPushConfig(ts.URL, nil, PushOptions{})
 	if err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
@@ -223,11 +549,95 @@ func TestPushImmediately(t *testing.T) {
 		t.Fatalf("failed to Publish, got err %v", err)
 	}
 
-	// not exist message when push and ack message
-	_, err = getGlobalMessageStatus().FindBySubscriptionIDAndMessageID("a", msgID)
+	// not exist message when push and ack message, the push loop wakes up before the PushTick
+	deadline := time.Now().Add(time.Second)
+	for {
+		_, err = getGlobalMessageStatus().FindBySubscriptionIDAndMessageID("a", msgID)
+		if err == ErrNotFoundEntry || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 	if err != ErrNotFoundEntry {
 		t.Errorf("error want %s , got %s", ErrNotFoundEntry, err)
 	}
+
+	if err := mustGetSubscription(t, "a").SetPushConfig("", nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+	waitPushRunningDisable(t, "a")
+}
+
+func TestPushConcurrentBatch(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	sub := setupSubscription(t, "concurrent", "A")
+
+	var (
+		mu          sync.Mutex
+		inFlight    int
+		maxInFlight int
+		received    []int
+	)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PushBatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		received = append(received, len(req.Messages))
+		mu.Unlock()
+
+		<-release
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	for i := 0; i < 7; i++ {
+		publishMessage(t, "A", "test", nil)
+	}
+	p, err := NewPush(ts.URL, nil, PushOptions{Format: PushFormatBatch, BatchSize: 2, MaxConcurrency: 2})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	sub = mustGetSubscription(t, "concurrent")
+	sub.PushConfig = p
+
+	done := make(chan SentState)
+	go func() {
+		state, err := sub.Push(10)
+		if err != nil {
+			t.Errorf("failed to Push, got err %v", err)
+		}
+		done <- state
+	}()
+	// 4 requests, the requests over the concurrency wait for the in-flight requests
+	for i := 0; i < 4; i++ {
+		release <- struct{}{}
+	}
+	if state := <-done; state != sentSucceed {
+		t.Errorf("want state %s, got %s", sentSucceed, state)
+	}
+
+	sort.Ints(received)
+	if want := []int{1, 2, 2, 2}; !reflect.DeepEqual(want, received) {
+		t.Errorf("want batch sizes %v, got %v", want, received)
+	}
+	if maxInFlight > 2 {
+		t.Errorf("want max in-flight requests up to 2, got %d", maxInFlight)
+	}
+	if list, err := mustGetSubscription(t, "concurrent").Message.CollectAllMessages(); err != nil || len(list) != 0 {
+		t.Errorf("want acked all messages, got %d messages and err %v", len(list), err)
+	}
 }
 
 func TestPushLoop(t *testing.T) {
@@ -251,13 +661,16 @@ func TestPushLoop(t *testing.T) {
 	// set to push mode
 	sub := mustGetSubscription(t, "a")
 	sub.PushTick = 10 * time.Millisecond // faster testing
-	if err := sub.SetPushConfig(ts.URL, nil); err != nil {
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
 
 	// wait push messaging
 	wg.Wait()
-	if err := mustGetSubscription(t, "a").SetPushConfig("", nil); err != nil {
+	if err := mustGetSubscription(t, "a").SetPushConfig("", nil, PushOptions{}); err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
 	waitPushRunningDisable(t, "a")
@@ -296,13 +709,16 @@ func TestPushLoopIncrement(t *testing.T) {
 	sub := mustGetSubscription(t, "a")
 	sub.PushTick = 10 * time.Millisecond  // faster testing
 	sub.PushSize = int(MaxPushSize/2) + 1 // want max size at next loop
-	if err := sub.SetPushConfig(ts.URL, nil); err != nil {
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
 
 	// wait push messaging
 	wg.Wait()
-	if err := mustGetSubscription(t, "a").SetPushConfig("", nil); err != nil {
+	if err := mustGetSubscription(t, "a").SetPushConfig("", nil, PushOptions{}); err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
 	waitPushRunningDisable(t, "a")
@@ -345,9 +761,13 @@ func TestPushLoopDecrement(t *testing.T) {
 
 	// set to push mode
 	sub := mustGetSubscription(t, "a")
-	sub.PushTick = 10 * time.Millisecond // faster testing
+	sub.PushTick = 10 * time.Millisecond    // faster testing
+	sub.PushBackoff = 10 * time.Millisecond // faster testing
 	sub.PushSize = MinPushSize
-	if err := sub.SetPushConfig(ts.URL, nil); err != nil {
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
 
@@ -356,7 +776,7 @@ func TestPushLoopDecrement(t *testing.T) {
 	// wait push response finished
 	// TODO: exit time.Sleep()
 	time.Sleep(100 * time.Millisecond)
-	if err := mustGetSubscription(t, "a").SetPushConfig("", nil); err != nil {
+	if err := mustGetSubscription(t, "a").SetPushConfig("", nil, PushOptions{}); err != nil {
 		t.Fatalf("failed to SetPushConfig, got err %v", err)
 	}
 	waitPushRunningDisable(t, "a")
@@ -377,3 +797,418 @@ func TestPushLoopDecrement(t *testing.T) {
 		t.Errorf("want push size = %d, got %d", MinPushSize, got)
 	}
 }
+
+func TestStopPushLoops(t *testing.T) {
+	cases := []struct {
+		pushDelay time.Duration
+		timeout   time.Duration
+		expectErr bool
+	}{
+		{0, time.Second, false},
+		{500 * time.Millisecond, 50 * time.Millisecond, true},
+	}
+	for i, c := range cases {
+		setupDatastore(t)
+		setupDummyTopics(t)
+		setupDummySubscription(t)
+
+		received := make(chan struct{}, 1)
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+			time.Sleep(c.pushDelay)
+			w.WriteHeader(200)
+		}))
+		defer ts.Close()
+
+		publishMessage(t, "A", "test", nil)
+		sub := mustGetSubscription(t, "a")
+		sub.PushTick = 10 * time.Millisecond // faster testing
+		if err := sub.Save(); err != nil {
+			t.Fatalf("failed to save subscription, got err %v", err)
+		}
+		if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
+			t.Fatalf("#%d: failed to SetPushConfig, got err %v", i, err)
+		}
+		<-received
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		err := StopPushLoops(ctx)
+		cancel()
+		if (err != nil) != c.expectErr {
+			t.Fatalf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		if c.expectErr {
+			// wait in-flight push for the next case
+			StopPushLoops(context.Background())
+		}
+		waitPushRunningDisable(t, "a")
+	}
+}
+
+func TestUpdateSubscription(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	sub := setupSubscription(t, "a", "A")
+
+	type fields struct {
+		deadline  time.Duration
+		retention time.Duration
+		filter    string
+		meta      Metadata
+	}
+	cases := []struct {
+		input     SubscriptionUpdate
+		paths     []string
+		expect    fields
+		expectErr error
+	}{
+		{
+			SubscriptionUpdate{
+				AckDeadlineSeconds: 30,
+				SubscriptionOptions: SubscriptionOptions{
+					MessageRetention: time.Hour,
+					Filter:           `attributes:env`,
+				},
+			},
+			[]string{"ack_deadline_seconds", "message_retention_seconds", "filter"},
+			fields{30 * time.Second, time.Hour, `attributes:env`, Metadata{}},
+			nil,
+		},
+		{
+			SubscriptionUpdate{
+				SubscriptionOptions: SubscriptionOptions{
+					Metadata: Metadata{Description: "desc"},
+				},
+			},
+			[]string{"description"},
+			fields{30 * time.Second, time.Hour, `attributes:env`, Metadata{Description: "desc"}},
+			nil,
+		},
+		{
+			// invalid filter, nothing is changed
+			SubscriptionUpdate{
+				AckDeadlineSeconds: 60,
+				SubscriptionOptions: SubscriptionOptions{
+					Filter: `attributes:`,
+				},
+			},
+			[]string{"ack_deadline_seconds", "filter"},
+			fields{30 * time.Second, time.Hour, `attributes:env`, Metadata{Description: "desc"}},
+			ErrInvalidFilter,
+		},
+		{
+			SubscriptionUpdate{
+				SubscriptionOptions: SubscriptionOptions{
+					MessageRetention: MaxMessageRetention + time.Second,
+				},
+			},
+			[]string{"message_retention_seconds"},
+			fields{30 * time.Second, time.Hour, `attributes:env`, Metadata{Description: "desc"}},
+			ErrInvalidRetention,
+		},
+		{
+			SubscriptionUpdate{PushEndpoint: ":"},
+			[]string{"push_config", "description"},
+			fields{30 * time.Second, time.Hour, `attributes:env`, Metadata{Description: "desc"}},
+			ErrInvalidEndpoint,
+		},
+		{
+			SubscriptionUpdate{},
+			[]string{"topic"},
+			fields{30 * time.Second, time.Hour, `attributes:env`, Metadata{Description: "desc"}},
+			ErrInvalidUpdateMask,
+		},
+	}
+	for i, c := range cases {
+		err := sub.Update(c.input, c.paths)
+		if errors.Cause(err) != c.expectErr {
+			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		got := mustGetSubscription(t, "a")
+		gotFields := fields{got.DefaultAckDeadline, got.MessageRetention, got.Filter, got.Metadata}
+		if !reflect.DeepEqual(gotFields, c.expect) {
+			t.Errorf("#%d: want %#v, got %#v", i, c.expect, gotFields)
+		}
+	}
+}
+
+func TestFilterAndRetention(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	if _, err := NewSubscription("a", "A", 10, "", nil, SubscriptionOptions{Filter: `attributes.env = "prod"`}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if _, err := NewSubscription("b", "A", 10, "", nil, SubscriptionOptions{MessageRetention: time.Hour}); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	prodID := publishMessage(t, "A", "prod", map[string]string{"env": "prod"})
+	devID := publishMessage(t, "A", "dev", map[string]string{"env": "dev"})
+
+	// filtered message is not registered
+	msgs, err := mustGetSubscription(t, "a").Pull(10)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Message.ID != prodID {
+		t.Errorf("want only message %s, got %v", prodID, msgs)
+	}
+
+	// expired messages are released from the subscription
+	for _, id := range []string{prodID, devID} {
+		m, err := globalMessage.Get(id)
+		if err != nil {
+			t.Fatalf("want no error, got %v", err)
+		}
+		m.PublishedAt = time.Now().Add(-2 * time.Hour)
+		if err := m.Save(); err != nil {
+			t.Fatalf("want no error, got %v", err)
+		}
+	}
+	if _, err := mustGetSubscription(t, "b").Pull(10); errors.Cause(err) != ErrEmptyMessage {
+		t.Errorf("want error %v, got %v", ErrEmptyMessage, err)
+	}
+	statuses, err := mustGetSubscription(t, "b").Message.CollectAllMessages()
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if len(statuses) != 0 {
+		t.Errorf("want no message status, got %v", statuses)
+	}
+}
+
+func TestPushLeaseTakeover(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "lease", "A")
+
+	ttl := 200 * time.Millisecond
+	SetPushLease("self", ttl)
+	defer SetPushLease("", 0)
+	// the other process is the leader
+	if ok, err := getGlobalSubscription().AcquirePushLease("lease", "other", ttl); !ok || err != nil {
+		t.Fatalf("failed to acquire lease, got %t and err %v", ok, err)
+	}
+
+	received := make(chan time.Time, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- time.Now():
+		default:
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	publishMessage(t, "A", "test", nil)
+	start := time.Now()
+	sub := mustGetSubscription(t, "lease")
+	sub.PushTick = 10 * time.Millisecond // faster testing
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+
+	select {
+	case at := <-received:
+		if at.Sub(start) < ttl/2 {
+			t.Errorf("want push after the lease expired, got %v", at.Sub(start))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("want push after the takeover, timeout error")
+	}
+	if ok, _ := getGlobalSubscription().AcquirePushLease("lease", "other", ttl); ok {
+		t.Errorf("want lease held by the new leader")
+	}
+
+	if err := mustGetSubscription(t, "lease").SetPushConfig("", nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+	waitPushRunningDisable(t, "lease")
+}
+
+func TestTeardownPushLoopLease(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "teardown", "A")
+
+	ttl := time.Minute
+	SetPushLease("self", ttl)
+	defer SetPushLease("", 0)
+	sub := mustGetSubscription(t, "teardown")
+	sub.PushRunning = true
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+
+	// the other process is the leader, e.g. this process is shutting down
+	if ok, err := getGlobalSubscription().AcquirePushLease("teardown", "other", ttl); !ok || err != nil {
+		t.Fatalf("failed to acquire lease, got %t and err %v", ok, err)
+	}
+	if err := teardownPushLoop("teardown"); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if !mustGetSubscription(t, "teardown").PushRunning {
+		t.Errorf("want PushRunning kept by the other leader")
+	}
+	if ok, _ := getGlobalSubscription().AcquirePushLease("teardown", "other", ttl); !ok {
+		t.Errorf("want lease kept by the other leader")
+	}
+
+	// this process is the leader
+	if err := getGlobalSubscription().ReleasePushLease("teardown", "other"); err != nil {
+		t.Fatalf("failed to release lease, got err %v", err)
+	}
+	if err := teardownPushLoop("teardown"); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	if mustGetSubscription(t, "teardown").PushRunning {
+		t.Errorf("want PushRunning cleared by the leader")
+	}
+	if ok, _ := getGlobalSubscription().AcquirePushLease("teardown", "other", ttl); !ok {
+		t.Errorf("want lease released by the leader")
+	}
+}
+
+func TestPushLoopRestart(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "restart", "A")
+
+	received := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	sub := mustGetSubscription(t, "restart")
+	sub.PushTick = 10 * time.Millisecond // faster testing
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+
+	// changed back to push before the aborted loop exits
+	if err := sub.SetPushConfig("", nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+	if err := sub.SetPushConfig(ts.URL, nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+	publishMessage(t, "A", "test", nil)
+	select {
+	case <-received:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("want push after changed back to push, timeout error")
+	}
+
+	if err := mustGetSubscription(t, "restart").SetPushConfig("", nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+	waitPushRunningDisable(t, "restart")
+}
+
+func TestPushLoopRegistry(t *testing.T) {
+	name := "registry"
+	defer unmarkPushLoop(name)
+
+	cases := []struct {
+		fn     func(string) bool
+		expect bool
+	}{
+		{markPushLoop, true},
+		{markPushLoop, false},
+		// requested to keep running by the second mark
+		{finishPushLoop, false},
+		{finishPushLoop, true},
+		{markPushLoop, true},
+	}
+	for i, c := range cases {
+		if got := c.fn(name); got != c.expect {
+			t.Errorf("#%d: want %t, got %t", i, c.expect, got)
+		}
+	}
+}
+
+type errorLeaseStore struct {
+	*datastore.Memory
+}
+
+func (s errorLeaseStore) AcquireLease(key, owner string, ttl time.Duration) (bool, error) {
+	return false, errors.New("table 'pubsub_lease' doesn't exist")
+}
+
+func (s errorLeaseStore) ReleaseLease(key, owner string) error {
+	return nil
+}
+
+func TestCheckPushLease(t *testing.T) {
+	setupDatastore(t)
+	if err := CheckPushLease(); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+
+	setGlobalSubscription(&DatastoreSubscription{store: errorLeaseStore{datastore.NewMemory(nil)}})
+	defer setupDatastore(t)
+	if err := CheckPushLease(); err == nil {
+		t.Errorf("want error of the lease, got nil")
+	}
+}
+
+func TestResumePushLoops(t *testing.T) {
+	setupDatastore(t)
+	setupDummyTopics(t)
+	setupSubscription(t, "resume", "A")
+
+	received := make(chan struct{}, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+		w.WriteHeader(200)
+	}))
+	defer ts.Close()
+
+	// the push subscription saved by the exited process
+	p, err := NewPush(ts.URL, nil, PushOptions{})
+	if err != nil {
+		t.Fatalf("failed to NewPush, got err %v", err)
+	}
+	sub := mustGetSubscription(t, "resume")
+	sub.PushConfig = p
+	sub.PushRunning = true
+	sub.PushTick = 10 * time.Millisecond // faster testing
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	if err := sub.Save(); err != nil {
+		t.Fatalf("failed to save subscription, got err %v", err)
+	}
+	publishMessage(t, "A", "test", nil)
+
+	if err := ResumePushLoops(); err != nil {
+		t.Fatalf("failed to ResumePushLoops, got err %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatalf("want push after resumed, timeout error")
+	}
+
+	if err := mustGetSubscription(t, "resume").SetPushConfig("", nil, PushOptions{}); err != nil {
+		t.Fatalf("failed to SetPushConfig, got err %v", err)
+	}
+	waitPushRunningDisable(t, "resume")
+}
@@ -61,6 +61,9 @@ func setupDatastore(t *testing.T) {
 	if err := InitDatastoreMessageStatus(); err != nil {
 		t.Fatal(err)
 	}
+	if err := InitDatastoreSchema(); err != nil {
+		t.Fatal(err)
+	}
 
 	// flush datastore
 	d, err := datastore.LoadDatastore(datastore.GlobalConfig)
@@ -90,14 +93,14 @@ func setupDatastore(t *testing.T) {
 func setupDatastoreAndSetTopics(t *testing.T, names ...string) {
 	setupDatastore(t)
 	for _, v := range names {
-		if _, err := NewTopic(v); err != nil {
+		if _, err := NewTopic(v, TopicOptions{}); err != nil {
 			t.Fatalf("failed to new topic, got err %v", err)
 		}
 	}
 }
 
 func setupTopic(t *testing.T, name string) *Topic {
-	topic, err := NewTopic(name)
+	topic, err := NewTopic(name, TopicOptions{})
 	if err != nil {
 		t.Fatalf("failed to create topic, key=%s", name)
 	}
@@ -126,7 +129,7 @@ func publishMessage(t *testing.T, topicID, message string, attr map[string]strin
 
 // setupSubscription requires Topic
 func setupSubscription(t *testing.T, name, topicName string) *Subscription {
-	s, err := NewSubscription(name, topicName, 10, "", nil)
+	s, err := NewSubscription(name, topicName, 10, "", nil, SubscriptionOptions{})
 	if err != nil {
 		t.Fatalf("failed to cretae Subscription, got error %v", err)
 	}
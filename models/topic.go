@@ -1,22 +1,53 @@
 package models
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/stats"
 )
 
 // Topic is topic object
 type Topic struct {
-	Name string `json:"name"`
+	Name           string          `json:"name"`
+	SchemaSettings *SchemaSettings `json:"schema_settings,omitempty"`
+	Metadata
+}
+
+// MaskSchemaSettings is the update mask path of the schema settings
+const MaskSchemaSettings = "schema_settings"
+
+// DeletedTopic is the topic name of the subscriptions detached by the topic deletion
+const DeletedTopic = "_deleted-topic_"
+
+// TopicOptions is optional fields of the Topic
+type TopicOptions struct {
+	SchemaSettings *SchemaSettings
+	Metadata
+}
+
+func (o TopicOptions) validate() error {
+	if err := o.SchemaSettings.validate(); err != nil {
+		return err
+	}
+	return o.Metadata.Validate()
 }
 
 // NewTopic return initialized topic, if not exist already topic name in GlobalTopics
-func NewTopic(name string) (*Topic, error) {
+func NewTopic(name string, opts TopicOptions) (*Topic, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if name == DeletedTopic {
+		return nil, ErrInvalidTopicName
+	}
 	if _, err := GetTopic(name); err == nil {
 		return nil, ErrAlreadyExistTopic
 	}
 	t := &Topic{
-		Name: name,
+		Name:           name,
+		SchemaSettings: opts.SchemaSettings,
+		Metadata:       opts.Metadata,
 	}
 	if err := t.Save(); err != nil {
 		return nil, errors.Wrapf(err, "failed to save topic, name=%s", name)
@@ -34,17 +65,85 @@ func ListTopic() ([]*Topic, error) {
 	return globalTopics.List()
 }
 
-// Delete topic object at GlobalTopics
+// Delete topic object at GlobalTopics.
+// the dependent subscriptions are detached by setting DeletedTopic, they keep the messages not yet acked
+// and never receive the messages of the topic created later with the same name.
 func (t *Topic) Delete() error {
+	subs, err := t.GetSubscriptions()
+	if err != nil {
+		return errors.Wrap(err, "failed GetSubscriptions")
+	}
+	for _, s := range subs {
+		_, err := updateSubscription(s.Name, func(latest *Subscription) error {
+			latest.TopicID = DeletedTopic
+			return nil
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to detach subscription, name=%s", s.Name)
+		}
+	}
 	return globalTopics.Delete(t.Name)
 }
 
-// Publish create message and deliver to subscription, and return created message id
+// Update overwrite the fields specified by the paths, a nil schema settings detach the schema
+func (t *Topic) Update(opts TopicOptions, paths []string) error {
+	if len(paths) == 0 {
+		return ErrEmptyUpdateMask
+	}
+	settings := t.SchemaSettings
+	var metaPaths []string
+	for _, p := range paths {
+		switch strings.TrimSpace(p) {
+		case MaskSchemaSettings:
+			if err := opts.SchemaSettings.validate(); err != nil {
+				return err
+			}
+			settings = opts.SchemaSettings
+		case MaskLabels, MaskDescription:
+			metaPaths = append(metaPaths, p)
+		default:
+			return ErrInvalidUpdateMask
+		}
+	}
+	meta := t.Metadata
+	if len(metaPaths) != 0 {
+		m, err := t.Metadata.apply(opts.Metadata, metaPaths)
+		if err != nil {
+			return err
+		}
+		meta = m
+	}
+
+	t.SchemaSettings = settings
+	t.Metadata = meta
+	return t.Save()
+}
+
+// ValidateMessage returns ErrSchemaViolation when the data does not conform to the schema of the topic
+func (t *Topic) ValidateMessage(data []byte) error {
+	if t.SchemaSettings == nil {
+		return nil
+	}
+	s, err := GetSchema(t.SchemaSettings.Schema)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get schema, name=%s", t.SchemaSettings.Schema)
+	}
+	return s.ValidateMessage(data, t.SchemaSettings.Encoding)
+}
+
+// Publish create message and deliver to subscription, and return created message id.
+// the data is validated by ValidateMessage beforehand to reject all messages of the request
 func (t *Topic) Publish(data []byte, attr map[string]string) (string, error) {
-	subList, err := t.GetSubscriptions()
+	subs, err := t.GetSubscriptions()
 	if err != nil {
 		return "", errors.Wrap(err, "failed GetSubscriptions")
 	}
+	subList := make([]*Subscription, 0, len(subs))
+	for _, s := range subs {
+		if !s.Detached && s.MatchFilter(attr) {
+			subList = append(subList, s)
+		}
+	}
 
 	// TODO: need transaction
 	m := NewMessage(makeMessageID(), data, attr, subList)
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/pkg/errors"
@@ -23,13 +24,18 @@ func TestNewTopic(t *testing.T) {
 			ErrAlreadyExistTopic,
 			[]string{"a"},
 		},
+		{
+			[]string{DeletedTopic},
+			ErrInvalidTopicName,
+			[]string{},
+		},
 	}
 	for i, c := range cases {
 		setupDatastore(t)
 		var err error
 		for _, s := range c.inputs {
 			// expect last input return value equal expectErr
-			_, err = NewTopic(s)
+			_, err = NewTopic(s, TopicOptions{})
 		}
 		if err != c.expectErr {
 			t.Errorf("#%d: want %v, got %v", i, c.expectErr, err)
@@ -72,3 +78,100 @@ func TestGetTopic(t *testing.T) {
 		}
 	}
 }
+
+func TestDeleteTopic(t *testing.T) {
+	setupDatastore(t)
+	topic := setupTopic(t, "A")
+	sub, err := NewSubscription("delete-topic", "A", 0, "", nil, SubscriptionOptions{})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	publishMessage(t, "A", "before", nil)
+
+	if err := topic.Delete(); err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	sub, err = GetSubscription("delete-topic")
+	if err != nil {
+		t.Fatalf("want the detached subscription, got %v", err)
+	}
+	if sub.TopicID != DeletedTopic {
+		t.Errorf("want topic %s, got %s", DeletedTopic, sub.TopicID)
+	}
+
+	// the topic created with the same name does not deliver to the detached subscription
+	setupTopic(t, "A")
+	publishMessage(t, "A", "after", nil)
+	msgs, err := sub.Pull(10)
+	if err != nil {
+		t.Fatalf("want the message published before the deletion, got %v", err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Message.Data) != "before" {
+		t.Errorf("want only the message published before the deletion, got %v", msgs)
+	}
+}
+
+func TestUpdateTopic(t *testing.T) {
+	setupDatastore(t)
+	topic, err := NewTopic("a", TopicOptions{Metadata: Metadata{Labels: map[string]string{"env": "dev"}, Description: "first"}})
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	cases := []struct {
+		input      Metadata
+		paths      []string
+		expectMeta Metadata
+		expectErr  error
+	}{
+		{
+			Metadata{Description: "second"},
+			[]string{"description"},
+			Metadata{Labels: map[string]string{"env": "dev"}, Description: "second"},
+			nil,
+		},
+		{
+			Metadata{Labels: map[string]string{"env": "prod", "team": "a"}},
+			[]string{"labels"},
+			Metadata{Labels: map[string]string{"env": "prod", "team": "a"}, Description: "second"},
+			nil,
+		},
+		{
+			Metadata{},
+			[]string{"labels", "description"},
+			Metadata{},
+			nil,
+		},
+		{
+			Metadata{Description: "ignored"},
+			nil,
+			Metadata{},
+			ErrEmptyUpdateMask,
+		},
+		{
+			Metadata{Description: "ignored"},
+			[]string{"name"},
+			Metadata{},
+			ErrInvalidUpdateMask,
+		},
+		{
+			Metadata{Labels: map[string]string{"Invalid Key": "v"}},
+			[]string{"labels"},
+			Metadata{},
+			ErrInvalidLabel,
+		},
+	}
+	for i, c := range cases {
+		err := topic.Update(TopicOptions{Metadata: c.input}, c.paths)
+		if errors.Cause(err) != c.expectErr {
+			t.Fatalf("#%d: want %v, got %v", i, c.expectErr, err)
+		}
+		got, err := GetTopic("a")
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !reflect.DeepEqual(got.Metadata, c.expectMeta) {
+			t.Errorf("#%d: want %#v, got %#v", i, c.expectMeta, got.Metadata)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package server
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -12,6 +17,8 @@ import (
 const (
 	defaultFile = "config/app.yaml"
 	defaultPort = 8080
+
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 // Exit codes. used only in Run()
@@ -23,6 +30,7 @@ const (
 	ExitCodeParseError
 	ExitCodeInvalidArgsError
 	ExitCodeSetupServerError
+	ExitCodeShutdownError
 )
 
 var (
@@ -61,11 +69,47 @@ func (c *CLI) Run(args []string) int {
 		return ExitCodeSetupServerError
 	}
 
-	if err := server.Run(param.port); err != nil {
-		fmt.Fprintf(c.ErrStream, "failed from server: %v", err)
-		return ExitCodeError
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.Run(param.port)
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			fmt.Fprintf(c.ErrStream, "failed from server: %v", err)
+			return ExitCodeError
+		}
+		return ExitCodeOK
+	case sig := <-sigCh:
+		fmt.Fprintf(c.OutStream, "received %s, shutting down the server\n", sig)
+	}
+	return c.shutdown(server, sigCh)
+}
+
+// shutdown wait for the graceful shutdown, give up when received a signal again
+func (c *CLI) shutdown(server *Server, sigCh <-chan os.Signal) int {
+	ctx, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Shutdown(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Fprintf(c.ErrStream, "failed to shutdown the server: %v", err)
+			return ExitCodeShutdownError
+		}
+		return ExitCodeOK
+	case sig := <-sigCh:
+		fmt.Fprintf(c.ErrStream, "received %s again, force to shutdown the server", sig)
+		return ExitCodeShutdownError
 	}
-	return ExitCodeOK
 }
 
 func (c *CLI) parseArgs(args []string, p *param) error {
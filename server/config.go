@@ -2,6 +2,7 @@ package server
 
 import (
 	"io/ioutil"
+	"time"
 
 	"github.com/takashabe/go-pubsub/datastore"
 	yaml "gopkg.in/yaml.v2"
@@ -10,6 +11,28 @@ import (
 // Config represent yaml config
 type Config struct {
 	Datastore *datastore.Config `yaml:"datastore"`
+	TLS       *TLSConfig        `yaml:"tls"`
+
+	// ShutdownTimeout is deadline to the graceful shutdown. e.g. "30s"
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// Limits is the size limits of the requests, nil uses DefaultLimits
+	Limits *LimitsConfig `yaml:"limits"`
+
+	// PushAuth is the key and the issuer of the OIDC token of the push request
+	PushAuth *PushAuthConfig `yaml:"push_auth"`
+
+	// PushClient is the HTTP client of the push shared by the all subscriptions
+	PushClient *PushClientConfig `yaml:"push_client"`
+
+	// PushLease is the leadership of the push loops among the servers sharing the datastore
+	PushLease *PushLeaseConfig `yaml:"push_lease"`
+
+	// Export is the files of the export subscriptions
+	Export *ExportConfig `yaml:"export"`
+
+	// PushSinks is the local files and sockets allowed as the push endpoint
+	PushSinks *PushSinksConfig `yaml:"push_sinks"`
 }
 
 // LoadConfigFromFile read config file and create config object
@@ -23,10 +46,11 @@ func LoadConfigFromFile(path string) (*Config, error) {
 		return nil, err
 	}
 
-	if config == nil || config.Datastore == nil {
-		config = &Config{
-			Datastore: &datastore.Config{},
-		}
+	if config == nil {
+		config = &Config{}
+	}
+	if config.Datastore == nil {
+		config.Datastore = &datastore.Config{}
 	}
 	return config, nil
 }
@@ -3,6 +3,7 @@ package server
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/takashabe/go-pubsub/datastore"
 )
@@ -16,7 +17,7 @@ func TestLoadConfig(t *testing.T) {
 		{
 			"testdata/valid_redis.yaml",
 			&Config{
-				&datastore.Config{
+				Datastore: &datastore.Config{
 					Redis: &datastore.RedisConfig{
 						Addr: "localhost:6379",
 						DB:   0,
@@ -29,7 +30,7 @@ func TestLoadConfig(t *testing.T) {
 		{
 			"testdata/unknown_param.yaml",
 			&Config{
-				&datastore.Config{
+				Datastore: &datastore.Config{
 					Redis: nil,
 					MySQL: &datastore.MySQLConfig{
 						Addr: "localhost:3306",
@@ -40,7 +41,100 @@ func TestLoadConfig(t *testing.T) {
 		},
 		{
 			"testdata/empty_param.yaml",
-			&Config{&datastore.Config{}},
+			&Config{Datastore: &datastore.Config{}},
+			nil,
+		},
+		{
+			"testdata/tls.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				TLS: &TLSConfig{
+					CertFile:     "server.crt",
+					KeyFile:      "server.key",
+					ClientCAFile: "ca.crt",
+					ClientAuth:   "require",
+					Identities:   map[string]string{"publisher": "app-publisher"},
+				},
+			},
+			nil,
+		},
+		{
+			"testdata/shutdown.yaml",
+			&Config{
+				Datastore:       &datastore.Config{},
+				ShutdownTimeout: 5 * time.Second,
+			},
+			nil,
+		},
+		{
+			"testdata/limits.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				Limits: &LimitsConfig{
+					MaxRequestBytes:    1048576,
+					MaxMessageBytes:    65536,
+					MaxPublishMessages: 100,
+				},
+			},
+			nil,
+		},
+		{
+			"testdata/push_auth.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				PushAuth: &PushAuthConfig{
+					Issuer:  "https://pubsub.example.com",
+					KeyFile: "push.key",
+				},
+			},
+			nil,
+		},
+		{
+			"testdata/push_client.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				PushClient: &PushClientConfig{
+					Timeout:             10 * time.Second,
+					MaxIdleConnsPerHost: 10,
+					CAFile:              "ca.crt",
+					CertFile:            "client.crt",
+					KeyFile:             "client.key",
+					Proxy:               "http://proxy.example.com:3128",
+				},
+			},
+			nil,
+		},
+		{
+			"testdata/push_lease.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				PushLease: &PushLeaseConfig{
+					Owner: "pubsub-1",
+					TTL:   15 * time.Second,
+				},
+			},
+			nil,
+		},
+		{
+			"testdata/export.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				Export: &ExportConfig{
+					RootDir: "/var/lib/pubsub/export",
+				},
+			},
+			nil,
+		},
+		{
+			"testdata/push_sinks.yaml",
+			&Config{
+				Datastore: &datastore.Config{},
+				PushSinks: &PushSinksConfig{
+					FileRoot:    "/var/lib/pubsub/push",
+					UnixSockets: []string{"/run/app/push.sock"},
+					Stdout:      true,
+				},
+			},
 			nil,
 		},
 	}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/datastore"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// Error codes of the ErrorResponse. these values are stable and used by the client.
+const (
+	CodeInvalidArgument    = "invalid_argument"
+	CodeUnauthenticated    = "unauthenticated"
+	CodePermissionDenied   = "permission_denied"
+	CodeNotFound           = "not_found"
+	CodeAlreadyExists      = "already_exists"
+	CodeEmptyMessage       = "empty_message"
+	CodeSchemaViolation    = "schema_violation"
+	CodeFailedPrecondition = "failed_precondition"
+	CodeRequestTooLarge    = "request_too_large"
+	CodeLimitExceeded      = "limit_exceeded"
+	CodeInternal           = "internal"
+)
+
+// errorStatus is pair of the HTTP status code and the error code
+type errorStatus struct {
+	status int
+	code   string
+}
+
+// modelErrors is mapping from the models and the server errors to the response status
+var modelErrors = map[error]errorStatus{
+	models.ErrAlreadyExistTopic:        {http.StatusConflict, CodeAlreadyExists},
+	models.ErrInvalidTopicName:         {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrAlreadyExistSubscription: {http.StatusConflict, CodeAlreadyExists},
+	models.ErrNotFoundAckID:            {http.StatusNotFound, CodeNotFound},
+	models.ErrInvalidEndpoint:          {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidPushEndpoint:      {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidPushFormat:        {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidPushAuth:          {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidPushConcurrency:   {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidPushBatchSize:     {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidPushTimeout:       {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidRetention:         {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidFilter:            {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrSubscriptionDetached:     {http.StatusConflict, CodeFailedPrecondition},
+	models.ErrInvalidExport:            {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrExportDisabled:           {http.StatusBadRequest, CodeFailedPrecondition},
+	models.ErrExportSubscription:       {http.StatusConflict, CodeFailedPrecondition},
+	models.ErrEmptyMessage:             {http.StatusNotFound, CodeEmptyMessage},
+	models.ErrAlreadyReadMessage:       {http.StatusConflict, CodeAlreadyExists},
+	models.ErrInvalidLabel:             {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidDescription:       {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrEmptyUpdateMask:          {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidUpdateMask:        {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrAlreadyExistSchema:       {http.StatusConflict, CodeAlreadyExists},
+	models.ErrInvalidSchema:            {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidSchemaType:        {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrInvalidSchemaSettings:    {http.StatusBadRequest, CodeInvalidArgument},
+	models.ErrSchemaInUse:              {http.StatusConflict, CodeFailedPrecondition},
+	models.ErrSchemaViolation:          {http.StatusBadRequest, CodeSchemaViolation},
+	models.ErrNotFoundEntry:            {http.StatusNotFound, CodeNotFound},
+	datastore.ErrNotFoundEntry:         {http.StatusNotFound, CodeNotFound},
+	ErrRequestTooLarge:                 {http.StatusRequestEntityTooLarge, CodeRequestTooLarge},
+	ErrTooManyMessages:                 {http.StatusBadRequest, CodeLimitExceeded},
+	ErrMessageTooLarge:                 {http.StatusBadRequest, CodeLimitExceeded},
+	ErrTooManyAttributes:               {http.StatusBadRequest, CodeLimitExceeded},
+	ErrAttributeKeyLong:                {http.StatusBadRequest, CodeLimitExceeded},
+	ErrAttributeValueLong:              {http.StatusBadRequest, CodeLimitExceeded},
+}
+
+// statusCodes is default error code for the HTTP status code
+var statusCodes = map[int]string{
+	http.StatusBadRequest:   CodeInvalidArgument,
+	http.StatusUnauthorized: CodeUnauthenticated,
+	http.StatusForbidden:    CodePermissionDenied,
+	http.StatusNotFound:     CodeNotFound,
+	http.StatusConflict:     CodeAlreadyExists,
+
+	http.StatusRequestEntityTooLarge: CodeRequestTooLarge,
+}
+
+// statusFromError returns the HTTP status code corresponding to the error
+func statusFromError(err error) int {
+	if s, ok := modelErrors[errors.Cause(err)]; ok {
+		return s.status
+	}
+	return http.StatusInternalServerError
+}
+
+// errorCode returns the error code, prefer the code corresponding to the error
+func errorCode(status int, err error) string {
+	if s, ok := modelErrors[errors.Cause(err)]; ok && s.status == status {
+		return s.code
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return CodeInternal
+}
+
+// errorDetail returns ErrorDetail of the item failed with the error
+func errorDetail(index int, err error) ErrorDetail {
+	return ErrorDetail{
+		Index:  index,
+		Code:   errorCode(statusFromError(err), err),
+		Reason: err.Error(),
+	}
+}
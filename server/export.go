@@ -0,0 +1,18 @@
+package server
+
+import "github.com/takashabe/go-pubsub/models"
+
+// ExportConfig represent config for the export subscriptions, written under "export"
+type ExportConfig struct {
+	// RootDir is the directory of the files of the export subscriptions, the export is disabled when empty
+	RootDir string `yaml:"root_dir"`
+}
+
+// setExportRoot set the root directory of the export subscriptions
+func setExportRoot(cfg *ExportConfig) {
+	if cfg == nil {
+		models.SetExportRoot("")
+		return
+	}
+	models.SetExportRoot(cfg.RootDir)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Limit errors
+var (
+	ErrRequestTooLarge    = errors.New("request body too large")
+	ErrTooManyMessages    = errors.New("too many messages in the publish request")
+	ErrMessageTooLarge    = errors.New("message data too large")
+	ErrTooManyAttributes  = errors.New("too many message attributes")
+	ErrAttributeKeyLong   = errors.New("message attribute key too long")
+	ErrAttributeValueLong = errors.New("message attribute value too long")
+)
+
+// LimitsConfig represent the size limits of the requests, the zero fields use DefaultLimits
+type LimitsConfig struct {
+	// MaxRequestBytes is the maximum bytes of the request body
+	MaxRequestBytes int64 `yaml:"max_request_bytes"`
+	// MaxMessageBytes is the maximum bytes of the message data
+	MaxMessageBytes int `yaml:"max_message_bytes"`
+	// MaxAttributes is the maximum number of the attributes per message
+	MaxAttributes int `yaml:"max_attributes"`
+	// MaxAttributeKeyBytes and MaxAttributeValueBytes are the maximum bytes of the attribute key and value
+	MaxAttributeKeyBytes   int `yaml:"max_attribute_key_bytes"`
+	MaxAttributeValueBytes int `yaml:"max_attribute_value_bytes"`
+	// MaxPublishMessages is the maximum number of the messages per publish request
+	MaxPublishMessages int `yaml:"max_publish_messages"`
+}
+
+// DefaultLimits is the limits used when not configured.
+// MaxRequestBytes is larger than MaxMessageBytes encoded in base64 by the publish request.
+var DefaultLimits = LimitsConfig{
+	MaxRequestBytes:        16 << 20,
+	MaxMessageBytes:        10 << 20,
+	MaxAttributes:          100,
+	MaxAttributeKeyBytes:   256,
+	MaxAttributeValueBytes: 1024,
+	MaxPublishMessages:     1000,
+}
+
+// withDefaults returns LimitsConfig filled the zero fields by the default
+func (l *LimitsConfig) withDefaults() LimitsConfig {
+	res := DefaultLimits
+	if l == nil {
+		return res
+	}
+	if l.MaxRequestBytes > 0 {
+		res.MaxRequestBytes = l.MaxRequestBytes
+	}
+	if l.MaxMessageBytes > 0 {
+		res.MaxMessageBytes = l.MaxMessageBytes
+	}
+	if l.MaxAttributes > 0 {
+		res.MaxAttributes = l.MaxAttributes
+	}
+	if l.MaxAttributeKeyBytes > 0 {
+		res.MaxAttributeKeyBytes = l.MaxAttributeKeyBytes
+	}
+	if l.MaxAttributeValueBytes > 0 {
+		res.MaxAttributeValueBytes = l.MaxAttributeValueBytes
+	}
+	if l.MaxPublishMessages > 0 {
+		res.MaxPublishMessages = l.MaxPublishMessages
+	}
+	return res
+}
+
+// validateMessage returns error when the message exceeds the limits
+func (l LimitsConfig) validateMessage(d PublishData) error {
+	if len(d.Data) > l.MaxMessageBytes {
+		return errors.Wrapf(ErrMessageTooLarge, "%d bytes, up to %d", len(d.Data), l.MaxMessageBytes)
+	}
+	if len(d.Attr) > l.MaxAttributes {
+		return errors.Wrapf(ErrTooManyAttributes, "%d attributes, up to %d", len(d.Attr), l.MaxAttributes)
+	}
+	for k, v := range d.Attr {
+		if len(k) > l.MaxAttributeKeyBytes {
+			return errors.Wrapf(ErrAttributeKeyLong, "up to %d bytes", l.MaxAttributeKeyBytes)
+		}
+		if len(v) > l.MaxAttributeValueBytes {
+			return errors.Wrapf(ErrAttributeValueLong, "key %s, up to %d bytes", k, l.MaxAttributeValueBytes)
+		}
+	}
+	return nil
+}
+
+var (
+	limitsMu sync.RWMutex
+	limits   = DefaultLimits
+)
+
+// setLimits replace the limits of the handlers
+func setLimits(l *LimitsConfig) {
+	limitsMu.Lock()
+	defer limitsMu.Unlock()
+	limits = l.withDefaults()
+}
+
+// currentLimits returns the limits of the handlers
+func currentLimits() LimitsConfig {
+	limitsMu.RLock()
+	defer limitsMu.RUnlock()
+	return limits
+}
+
+// decodeJSON decode the request body to v up to MaxRequestBytes,
+// the connection is closed after the response when the body is over the limit
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	max := currentLimits().MaxRequestBytes
+	if r.ContentLength > max {
+		return ErrRequestTooLarge
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, max)
+	err := json.NewDecoder(r.Body).Decode(v)
+	var maxBytesErr *http.MaxBytesError
+	if stderrors.As(err, &maxBytesErr) {
+		return ErrRequestTooLarge
+	}
+	return err
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// List parameter errors
+var (
+	ErrInvalidPageSize  = errors.New("invalid page_size, must be positive integer")
+	ErrInvalidPageToken = errors.New("invalid page_token")
+	ErrInvalidOrderBy   = errors.New("invalid order_by, choose from \"name\" or \"name desc\"")
+)
+
+// maxPageSize is upper limit of the page_size
+const maxPageSize = 1000
+
+// listOptions represent query parameters of the list endpoints
+type listOptions struct {
+	// pageSize is number of the resources in one page, 0 is unlimited
+	pageSize int
+	// after is the last resource name of the previous page
+	after  string
+	prefix string
+	desc   bool
+	// labels is label selectors formatted "key" or "key:value"
+	labels []string
+}
+
+// parseListOptions parse "page_size", "page_token", "prefix", "label" and "order_by" parameters
+func parseListOptions(r *http.Request) (*listOptions, error) {
+	q := r.URL.Query()
+	opts := &listOptions{
+		prefix: q.Get("prefix"),
+		labels: q["label"],
+	}
+
+	if v := q.Get("page_size"); len(v) != 0 {
+		size, err := strconv.Atoi(v)
+		if err != nil || size <= 0 {
+			return nil, ErrInvalidPageSize
+		}
+		if size > maxPageSize {
+			size = maxPageSize
+		}
+		opts.pageSize = size
+	}
+
+	if v := q.Get("page_token"); len(v) != 0 {
+		b, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || len(b) == 0 {
+			return nil, ErrInvalidPageToken
+		}
+		opts.after = string(b)
+	}
+
+	switch strings.Join(strings.Fields(q.Get("order_by")), " ") {
+	case "", "name", "name asc":
+	case "name desc":
+		opts.desc = true
+	default:
+		return nil, ErrInvalidOrderBy
+	}
+	return opts, nil
+}
+
+// match returns whether the metadata satisfy the label selectors
+func (o *listOptions) match(meta models.Metadata) bool {
+	return meta.MatchLabels(o.labels)
+}
+
+// paginate returns names in the page and the token for the next page.
+// the next token is empty when reached the last page.
+func (o *listOptions) paginate(names []string) ([]string, string) {
+	sorted := make([]string, 0, len(names))
+	for _, n := range names {
+		if strings.HasPrefix(n, o.prefix) {
+			sorted = append(sorted, n)
+		}
+	}
+	if o.desc {
+		sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	} else {
+		sort.Strings(sorted)
+	}
+
+	if len(o.after) != 0 {
+		start := sort.Search(len(sorted), func(i int) bool {
+			if o.desc {
+				return sorted[i] < o.after
+			}
+			return sorted[i] > o.after
+		})
+		sorted = sorted[start:]
+	}
+	if o.pageSize == 0 || len(sorted) <= o.pageSize {
+		return sorted, ""
+	}
+	page := sorted[:o.pageSize]
+	return page, base64.RawURLEncoding.EncodeToString([]byte(page[len(page)-1]))
+}
@@ -13,7 +13,7 @@ type Monitoring struct{}
 func (m *Monitoring) Summary(w http.ResponseWriter, r *http.Request) {
 	b, err := stats.Summary()
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "failed to get metrics")
+		Error(w, http.StatusInternalServerError, err, "failed to get metrics")
 		return
 	}
 	JSON(w, http.StatusOK, b)
@@ -23,7 +23,7 @@ func (m *Monitoring) Summary(w http.ResponseWriter, r *http.Request) {
 func (m *Monitoring) TopicSummary(w http.ResponseWriter, r *http.Request) {
 	b, err := stats.TopicSummary()
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "failed to get metrics")
+		Error(w, http.StatusInternalServerError, err, "failed to get metrics")
 		return
 	}
 	JSON(w, http.StatusOK, b)
@@ -33,7 +33,7 @@ func (m *Monitoring) TopicSummary(w http.ResponseWriter, r *http.Request) {
 func (m *Monitoring) SubscriptionSummary(w http.ResponseWriter, r *http.Request) {
 	b, err := stats.SubscriptionSummary()
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "failed to get metrics")
+		Error(w, http.StatusInternalServerError, err, "failed to get metrics")
 		return
 	}
 	JSON(w, http.StatusOK, b)
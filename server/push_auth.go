@@ -0,0 +1,92 @@
+package server
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// JWKSPath is the path of the public keys to verify the OIDC token of the push request
+const JWKSPath = "/.well-known/jwks.json"
+
+// push auth errors
+var (
+	// ErrInvalidPushSigningKey is the key file is not a RSA private key
+	ErrInvalidPushSigningKey = errors.New("invalid push signing key, require PEM encoded RSA private key")
+
+	// ErrPushSigningKeyRequired is the key file is not specified for the servers sharing the push,
+	// the tokens signed by a server must be verified with the JWKS of the other servers
+	ErrPushSigningKeyRequired = errors.New("push_auth.key_file is required with push_lease")
+)
+
+// PushAuthConfig represent config for the OIDC token of the push request, written under "push_auth"
+type PushAuthConfig struct {
+	// Issuer is the "iss" claim, default is "go-pubsub"
+	Issuer string `yaml:"issuer"`
+	// KeyFile is the PEM encoded RSA private key in PKCS#1 or PKCS#8, generated at startup when empty.
+	// it is required when the servers share the push by the push lease.
+	KeyFile string `yaml:"key_file"`
+}
+
+// setPushSigningKey load the key file and set to the push signer with the issuer.
+// when not specified the key file, the key is generated at startup, and it is not allowed for the shared push.
+func setPushSigningKey(cfg *PushAuthConfig, shared bool) error {
+	if cfg == nil {
+		cfg = &PushAuthConfig{}
+	}
+	if len(cfg.KeyFile) == 0 {
+		if shared {
+			return ErrPushSigningKeyRequired
+		}
+		return models.GeneratePushSigningKey(cfg.Issuer)
+	}
+	key, err := loadRSAPrivateKey(cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	models.SetPushSigningKey(key, cfg.Issuer)
+	return nil
+}
+
+func loadRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(d)
+	if block == nil {
+		return nil, ErrInvalidPushSigningKey
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, ErrInvalidPushSigningKey
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidPushSigningKey
+	}
+	return rsaKey, nil
+}
+
+// ResponseJWKS represent response json of JWKS
+type ResponseJWKS struct {
+	Keys []models.JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys to verify the OIDC token of the push request
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := models.PushJWKS()
+	if err != nil {
+		Error(w, http.StatusInternalServerError, err, "failed to get push signing key")
+		return
+	}
+	JSON(w, http.StatusOK, ResponseJWKS{Keys: keys})
+}
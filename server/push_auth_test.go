@@ -0,0 +1,114 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadRSAPrivateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "push_auth")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key, got err %v", err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key, got err %v", err)
+	}
+	writeKey := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		d := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+		if err := ioutil.WriteFile(path, d, 0600); err != nil {
+			t.Fatalf("failed to write key, got err %v", err)
+		}
+		return path
+	}
+
+	cases := []struct {
+		path      string
+		expectErr error
+	}{
+		{writeKey("pkcs1.key", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)), nil},
+		{writeKey("pkcs8.key", "PRIVATE KEY", pkcs8), nil},
+		{writeKey("invalid.key", "PRIVATE KEY", []byte("invalid")), ErrInvalidPushSigningKey},
+	}
+	for i, c := range cases {
+		got, err := loadRSAPrivateKey(c.path)
+		if err != c.expectErr {
+			t.Errorf("#%d: want error %v, got %v", i, c.expectErr, err)
+		}
+		if err == nil && got.N.Cmp(key.N) != 0 {
+			t.Errorf("#%d: want same key", i)
+		}
+	}
+}
+
+func TestSetPushSigningKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "push_auth")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer setPushSigningKey(nil, false)
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key, got err %v", err)
+	}
+	path := filepath.Join(dir, "push.key")
+	d := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := ioutil.WriteFile(path, d, 0600); err != nil {
+		t.Fatalf("failed to write key, got err %v", err)
+	}
+
+	cases := []struct {
+		cfg       *PushAuthConfig
+		shared    bool
+		expectErr error
+	}{
+		{nil, false, nil},
+		{&PushAuthConfig{Issuer: "https://pubsub.example.com"}, false, nil},
+		{&PushAuthConfig{KeyFile: path}, true, nil},
+		{nil, true, ErrPushSigningKeyRequired},
+		{&PushAuthConfig{Issuer: "https://pubsub.example.com"}, true, ErrPushSigningKeyRequired},
+	}
+	for i, c := range cases {
+		if err := setPushSigningKey(c.cfg, c.shared); err != c.expectErr {
+			t.Errorf("#%d: want error %v, got %v", i, c.expectErr, err)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+
+	res, err := dummyClient(t).Get(ts.URL + JWKSPath)
+	if err != nil {
+		t.Fatalf("want non error, got %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("want status code %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	var body ResponseJWKS
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode body, got err %v", err)
+	}
+	if len(body.Keys) != 1 || body.Keys[0].KeyType != "RSA" || len(body.Keys[0].KeyID) == 0 {
+		t.Errorf("want a RSA key, got %v", body.Keys)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// ErrInvalidPushCA is the CA file of the push client has no certificate
+var ErrInvalidPushCA = errors.New("failed to append push CA certificates")
+
+// PushClientConfig represent config for the HTTP client of the push, written under "push_client"
+type PushClientConfig struct {
+	// Timeout is the deadline of a push request, default 30s
+	Timeout time.Duration `yaml:"timeout"`
+
+	// keep-alive connection pool, the zero uses the default of net/http
+	MaxIdleConns        int           `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout"`
+
+	// CAFile is the CA certificates to verify the endpoints, the system roots when empty
+	CAFile string `yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate for the mTLS endpoints
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+
+	// Proxy is the proxy URL, the environment variables (HTTP_PROXY, HTTPS_PROXY and NO_PROXY) when empty
+	Proxy string `yaml:"proxy"`
+}
+
+// newPushHTTPClient returns the HTTP client for the push
+func newPushHTTPClient(cfg *PushClientConfig) (*http.Client, error) {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if len(cfg.Proxy) != 0 {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid push proxy")
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{}
+	if len(cfg.CAFile) != 0 {
+		ca, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, ErrInvalidPushCA
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(cfg.CertFile) != 0 || len(cfg.KeyFile) != 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load push client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = models.DefaultPushTimeout
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// setPushHTTPClient replace the HTTP client of the push, nil keeps the default
+func setPushHTTPClient(cfg *PushClientConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	c, err := newPushHTTPClient(cfg)
+	if err != nil {
+		return err
+	}
+	models.SetPushHTTPClient(c)
+	return nil
+}
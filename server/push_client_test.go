@@ -0,0 +1,93 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPushHTTPClient(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-push-client")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := createTestCert(t, "ca", 1, nil)
+	serverCert := createTestCert(t, "localhost", 2, ca)
+	clientCert := createTestCert(t, "pubsub", 3, ca)
+	writeTestFile(t, filepath.Join(dir, "ca.crt"), ca.certPEM)
+	writeTestFile(t, filepath.Join(dir, "client.crt"), clientCert.certPEM)
+	writeTestFile(t, filepath.Join(dir, "client.key"), clientCert.keyPEM)
+	writeTestFile(t, filepath.Join(dir, "broken.crt"), []byte("broken"))
+
+	// the endpoint requires the client certificate
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	ts.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert.keyPair(t)},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	ts.StartTLS()
+	defer ts.Close()
+
+	cases := []struct {
+		cfg           *PushClientConfig
+		expectErr     bool
+		expectSendErr bool
+	}{
+		{
+			&PushClientConfig{
+				Timeout:  5 * time.Second,
+				CAFile:   filepath.Join(dir, "ca.crt"),
+				CertFile: filepath.Join(dir, "client.crt"),
+				KeyFile:  filepath.Join(dir, "client.key"),
+			},
+			false, false,
+		},
+		{
+			// without the client certificate
+			&PushClientConfig{CAFile: filepath.Join(dir, "ca.crt")},
+			false, true,
+		},
+		{
+			// unknown CA
+			&PushClientConfig{},
+			false, true,
+		},
+		{
+			&PushClientConfig{CAFile: filepath.Join(dir, "broken.crt")},
+			true, false,
+		},
+		{
+			&PushClientConfig{Proxy: "://invalid"},
+			true, false,
+		},
+	}
+	for i, c := range cases {
+		client, err := newPushHTTPClient(c.cfg)
+		if (err != nil) != c.expectErr {
+			t.Fatalf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		if err != nil {
+			continue
+		}
+		res, err := client.Get(ts.URL)
+		if (err != nil) != c.expectSendErr {
+			t.Errorf("#%d: want send error %t, got %v", i, c.expectSendErr, err)
+		}
+		if err == nil {
+			res.Body.Close()
+		}
+	}
+}
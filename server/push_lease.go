@@ -0,0 +1,24 @@
+package server
+
+import (
+	"time"
+
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// PushLeaseConfig represent config for the leadership of the push loops among the servers
+// sharing the datastore, written under "push_lease"
+type PushLeaseConfig struct {
+	// Owner is the unique ID of the server, generated from the hostname when empty
+	Owner string `yaml:"owner"`
+	// TTL is the lifetime of the lease, the other server takes over the push after it expires. default 30s
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// setPushLease set the owner ID and the lifetime of the push leases
+func setPushLease(cfg *PushLeaseConfig) {
+	if cfg == nil {
+		return
+	}
+	models.SetPushLease(cfg.Owner, cfg.TTL)
+}
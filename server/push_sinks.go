@@ -0,0 +1,27 @@
+package server
+
+import "github.com/takashabe/go-pubsub/models"
+
+// PushSinksConfig represent config for the local sinks allowed as the push endpoint, written under "push_sinks".
+// the "file", "unix" and "stdout" endpoints are rejected without it.
+type PushSinksConfig struct {
+	// FileRoot is the directory of the files of the "file" endpoints, the path of the endpoint is relative to it
+	FileRoot string `yaml:"file_root"`
+	// UnixSockets is the socket paths allowed as the "unix" endpoints
+	UnixSockets []string `yaml:"unix_sockets"`
+	// Stdout allows the "stdout" endpoint
+	Stdout bool `yaml:"stdout"`
+}
+
+// setPushSinks set the local sinks allowed as the push endpoint
+func setPushSinks(cfg *PushSinksConfig) {
+	if cfg == nil {
+		models.SetPushSinks(models.PushSinks{})
+		return
+	}
+	models.SetPushSinks(models.PushSinks{
+		FileRoot:    cfg.FileRoot,
+		UnixSockets: cfg.UnixSockets,
+		Stdout:      cfg.Stdout,
+	})
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/takashabe/go-pubsub/models"
+)
+
+// SchemaServer is schema frontend server
+type SchemaServer struct{}
+
+// RequestCreateSchema represent request json for Create
+type RequestCreateSchema struct {
+	Type       models.SchemaType `json:"type"`
+	Definition string            `json:"definition"`
+}
+
+// Create is create the first revision of the schema
+func (s *SchemaServer) Create(w http.ResponseWriter, r *http.Request, id string) {
+	var req RequestCreateSchema
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
+		return
+	}
+	schema, err := models.NewSchema(id, req.Type, req.Definition)
+	if err != nil {
+		ErrorFrom(w, err, "failed to create schema")
+		return
+	}
+	JSON(w, http.StatusCreated, schema)
+}
+
+// Get is get the latest revision of the schema, or the revision specified by the "revision_id" parameter
+func (s *SchemaServer) Get(w http.ResponseWriter, r *http.Request, id string) {
+	var (
+		schema *models.Schema
+		err    error
+	)
+	if rev := r.URL.Query().Get("revision_id"); len(rev) != 0 {
+		schema, err = models.GetSchemaRevision(id, rev)
+	} else {
+		schema, err = models.GetSchema(id)
+	}
+	if err != nil {
+		ErrorFrom(w, err, "not found schema")
+		return
+	}
+	JSON(w, http.StatusOK, schema)
+}
+
+// RequestCommitSchema represent request json for Commit
+type RequestCommitSchema struct {
+	Definition string `json:"definition"`
+}
+
+// Commit is add the new revision to the schema
+func (s *SchemaServer) Commit(w http.ResponseWriter, r *http.Request, id string) {
+	var req RequestCommitSchema
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
+		return
+	}
+	schema, err := models.CommitSchema(id, req.Definition)
+	if err != nil {
+		ErrorFrom(w, err, "failed to commit schema")
+		return
+	}
+	JSON(w, http.StatusOK, schema)
+}
+
+// ResponseListSchema represent response json of List and ListRevisions
+type ResponseListSchema struct {
+	Schemas       []*models.Schema `json:"schemas"`
+	NextPageToken string           `json:"next_page_token,omitempty"`
+}
+
+// List is gets the latest revision of the schemas
+func (s *SchemaServer) List(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err, "invalid list parameter")
+		return
+	}
+	list, err := models.ListSchemas()
+	if err != nil {
+		ErrorFrom(w, err, "failed to list schema")
+		return
+	}
+	schemas := make(map[string]*models.Schema, len(list))
+	names := make([]string, 0, len(list))
+	for _, schema := range list {
+		schemas[schema.Name] = schema
+		names = append(names, schema.Name)
+	}
+
+	page, next := opts.paginate(names)
+	res := ResponseListSchema{
+		Schemas:       make([]*models.Schema, 0, len(page)),
+		NextPageToken: next,
+	}
+	for _, name := range page {
+		res.Schemas = append(res.Schemas, schemas[name])
+	}
+	JSON(w, http.StatusOK, res)
+}
+
+// ListRevisions is gets the all revisions of the schema, ordered by oldest first
+func (s *SchemaServer) ListRevisions(w http.ResponseWriter, r *http.Request, id string) {
+	revisions, err := models.ListSchemaRevisions(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found schema")
+		return
+	}
+	JSON(w, http.StatusOK, ResponseListSchema{Schemas: revisions})
+}
+
+// Delete is delete the schema and the all revisions
+func (s *SchemaServer) Delete(w http.ResponseWriter, r *http.Request, id string) {
+	if err := models.DeleteSchema(id); err != nil {
+		ErrorFrom(w, err, "failed to delete schema")
+		return
+	}
+	JSON(w, http.StatusNoContent, "")
+}
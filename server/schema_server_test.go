@@ -0,0 +1,185 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/takashabe/go-pubsub/models"
+)
+
+func TestSchemaLifecycle(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+
+	cases := []struct {
+		method     string
+		path       string
+		body       string
+		expectCode int
+		expectRev  string
+	}{
+		{"PUT", "/schema/s", `{"type": "json_schema", "definition": "{\"type\": \"object\"}"}`, http.StatusCreated, "1"},
+		{"PUT", "/schema/s", `{"type": "json_schema", "definition": "{}"}`, http.StatusConflict, ""},
+		{"PUT", "/schema/x", `{"type": "xml", "definition": "{}"}`, http.StatusBadRequest, ""},
+		{"PUT", "/schema/x", `{"type": "avro", "definition": "\"unknown\""}`, http.StatusBadRequest, ""},
+		{"POST", "/schema/s/commit", `{"definition": "{\"type\": \"object\", \"required\": [\"id\"]}"}`, http.StatusOK, "2"},
+		{"POST", "/schema/none/commit", `{"definition": "{}"}`, http.StatusNotFound, ""},
+		{"GET", "/schema/s", "", http.StatusOK, "2"},
+		{"GET", "/schema/s?revision_id=1", "", http.StatusOK, "1"},
+		{"GET", "/schema/s?revision_id=3", "", http.StatusNotFound, ""},
+		{"PUT", "/topic/a", `{"schema_settings": {"schema": "s", "encoding": "binary"}}`, http.StatusBadRequest, ""},
+		{"PUT", "/topic/a", `{"schema_settings": {"schema": "s", "encoding": "json"}}`, http.StatusCreated, ""},
+		{"DELETE", "/schema/s", "", http.StatusConflict, ""},
+		{"PATCH", "/topic/a", `{"update_mask": "schema_settings"}`, http.StatusOK, ""},
+		{"DELETE", "/schema/s", "", http.StatusNoContent, ""},
+		{"GET", "/schema/s", "", http.StatusNotFound, ""},
+	}
+	for i, c := range cases {
+		client := dummyClient(t)
+		req, err := http.NewRequest(c.method, ts.URL+c.path, bytes.NewBufferString(c.body))
+		if err != nil {
+			t.Fatal("failed to create request")
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal("failed to send request")
+		}
+		defer res.Body.Close()
+
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if len(c.expectRev) == 0 {
+			continue
+		}
+		var got models.Schema
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+		}
+		if got.RevisionID != c.expectRev {
+			t.Errorf("#%d: want revision %s, got %s", i, c.expectRev, got.RevisionID)
+		}
+	}
+}
+
+func TestPublishWithSchema(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	createDummySchema(t, ts, "s", RequestCreateSchema{
+		Type:       models.SchemaTypeJSON,
+		Definition: `{"type": "object", "required": ["id"]}`,
+	})
+	createDummyTopicWithBody(t, ts, "a", `{"schema_settings": {"schema": "s", "encoding": "json"}}`)
+	createDummySubscription(t, ts, ResourceSubscription{Name: "A", Topic: "a", AckTimeout: 10})
+
+	cases := []struct {
+		input          PublishDatas
+		expectCode     int
+		expectMsgCount int
+		expectDetails  []int
+	}{
+		{
+			PublishDatas{
+				Messages: []PublishData{
+					PublishData{Data: []byte(`{"id": 1}`)},
+					PublishData{Data: []byte(`{"id": 2, "name": "b"}`)},
+				},
+			},
+			http.StatusOK,
+			2,
+			nil,
+		},
+		{
+			PublishDatas{
+				Messages: []PublishData{
+					PublishData{Data: []byte(`{"id": 3}`)},
+					PublishData{Data: []byte(`{"name": "b"}`)},
+					PublishData{Data: []byte(`not json`)},
+				},
+			},
+			http.StatusOK,
+			1,
+			[]int{1, 2},
+		},
+		{
+			PublishDatas{
+				Messages: []PublishData{
+					PublishData{Data: []byte(`{"name": "c"}`)},
+				},
+			},
+			http.StatusBadRequest,
+			0,
+			[]int{0},
+		},
+	}
+	for i, c := range cases {
+		b, err := json.Marshal(c.input)
+		if err != nil {
+			t.Fatal("failed to encode to json")
+		}
+		client := dummyClient(t)
+		res, err := client.Post(fmt.Sprintf("%s/topic/a/publish", ts.URL), "application/json", bytes.NewBuffer(b))
+		if err != nil {
+			t.Fatal("failed to send request")
+		}
+		defer res.Body.Close()
+
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			var e ErrorResponse
+			if err := json.NewDecoder(res.Body).Decode(&e); err != nil {
+				t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+			}
+			if e.Code != CodeSchemaViolation {
+				t.Errorf("#%d: want code %s, got %s", i, CodeSchemaViolation, e.Code)
+			}
+			indexes := []int{}
+			for _, d := range e.Details {
+				indexes = append(indexes, d.Index)
+			}
+			if !reflect.DeepEqual(indexes, c.expectDetails) {
+				t.Errorf("#%d: want details %v, got %v", i, c.expectDetails, indexes)
+			}
+			continue
+		}
+		var msgs ResponsePublish
+		if err := json.NewDecoder(res.Body).Decode(&msgs); err != nil {
+			t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+		}
+		published := 0
+		var indexes []int
+		for j, r := range msgs.Results {
+			if len(r.MessageID) != 0 {
+				published++
+				continue
+			}
+			if r.Code != CodeSchemaViolation {
+				t.Errorf("#%d: want code %s, got %s", i, CodeSchemaViolation, r.Code)
+			}
+			indexes = append(indexes, j)
+		}
+		if published != c.expectMsgCount {
+			t.Errorf("#%d: want %d, got %d", i, c.expectMsgCount, published)
+		}
+		if !reflect.DeepEqual(indexes, c.expectDetails) {
+			t.Errorf("#%d: want details %v, got %v", i, c.expectDetails, indexes)
+		}
+	}
+
+	// the valid message is published with the rejected messages
+	res := pullMessage(t, ts, "A", 10)
+	defer res.Body.Close()
+	var pulled ResponsePull
+	if err := json.NewDecoder(res.Body).Decode(&pulled); err != nil {
+		t.Fatalf("failed to decode response, got err %v", err)
+	}
+	if got := len(pulled.Messages); got != 3 {
+		t.Errorf("want 3 messages, got %d", got)
+	}
+}
@@ -1,11 +1,16 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/datastore"
@@ -14,6 +19,9 @@ import (
 	"github.com/takashabe/go-router"
 )
 
+// ErrAlreadyRunning is already called Run
+var ErrAlreadyRunning = errors.New("server already running")
+
 // PrintDebugf behaves like log.Printf only in the debug env
 func PrintDebugf(format string, args ...interface{}) {
 	if env := os.Getenv("GO_PUBSUB_DEBUG"); len(env) != 0 {
@@ -23,12 +31,21 @@ func PrintDebugf(format string, args ...interface{}) {
 
 // ErrorResponse is Error response template
 type ErrorResponse struct {
-	Message string `json:"reason"`
-	Error   error  `json:"-"`
+	Code    string        `json:"code"`
+	Message string        `json:"reason"`
+	Details []ErrorDetail `json:"details,omitempty"`
+	Error   error         `json:"-"`
+}
+
+// ErrorDetail is the error of the each item in the request, e.g. the messages of the publish
+type ErrorDetail struct {
+	Index  int    `json:"index"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
 }
 
 func (e *ErrorResponse) String() string {
-	return fmt.Sprintf("reason: %s, error: %v", e.Message, e.Error)
+	return fmt.Sprintf("code: %s, reason: %s, error: %v", e.Code, e.Message, e.Error)
 }
 
 // Respond is response write to ResponseWriter
@@ -50,7 +67,7 @@ func Respond(w http.ResponseWriter, code int, src interface{}) {
 		if body, err = json.Marshal(src); err != nil {
 			w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("{\"reason\":\"failed to parse json\"}"))
+			w.Write([]byte("{\"code\":\"internal\",\"reason\":\"failed to parse json\"}"))
 			return
 		}
 	default:
@@ -65,7 +82,11 @@ func Respond(w http.ResponseWriter, code int, src interface{}) {
 
 // Error is wrapped Respond when error response
 func Error(w http.ResponseWriter, code int, err error, msg string) {
+	if errors.Cause(err) == ErrRequestTooLarge {
+		code = http.StatusRequestEntityTooLarge
+	}
 	e := &ErrorResponse{
+		Code:    errorCode(code, err),
 		Message: msg,
 		Error:   err,
 	}
@@ -74,12 +95,50 @@ func Error(w http.ResponseWriter, code int, err error, msg string) {
 	Respond(w, code, e)
 }
 
+// ErrorWithDetails is wrapped Respond when error response with the errors of the each item
+func ErrorWithDetails(w http.ResponseWriter, code int, err error, msg string, details []ErrorDetail) {
+	e := &ErrorResponse{
+		Code:    errorCode(code, err),
+		Message: msg,
+		Details: details,
+		Error:   err,
+	}
+	PrintDebugf("%v", e)
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	Respond(w, code, e)
+}
+
+// ErrorFrom is wrapped Error, decide the status code from the error
+func ErrorFrom(w http.ResponseWriter, err error, msg string) {
+	Error(w, statusFromError(err), err, msg)
+}
+
 // JSON is wrapped Respond when success response
 func JSON(w http.ResponseWriter, code int, src interface{}) {
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	Respond(w, code, src)
 }
 
+// decodeOptionalJSON decode the request body to v, an empty body is not error
+func decodeOptionalJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	err := decodeJSON(w, r, v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// parseUpdateMask split the comma separated update mask to the paths
+func parseUpdateMask(mask string) []string {
+	paths := []string{}
+	for _, p := range strings.Split(mask, ",") {
+		if p = strings.TrimSpace(p); len(p) != 0 {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
 // Routes returns initialized for the topic and subscription router
 func Routes() *router.Router {
 	r := router.NewRouter()
@@ -90,6 +149,7 @@ func Routes() *router.Router {
 	r.Get(topicRoot+"/:id", ts.Get)
 	r.Get(topicRoot+"/:id/subscriptions", ts.ListSubscription)
 	r.Put(topicRoot+"/:id", ts.Create)
+	r.Patch(topicRoot+"/:id", ts.Update)
 	r.Post(topicRoot+"/:id/publish", ts.Publish)
 	r.Delete(topicRoot+"/:id", ts.Delete)
 
@@ -98,12 +158,26 @@ func Routes() *router.Router {
 	r.Get(subscriptionRoot+"/", ss.List)
 	r.Get(subscriptionRoot+"/:id", ss.Get)
 	r.Put(subscriptionRoot+"/:id", ss.Create)
+	r.Patch(subscriptionRoot+"/:id", ss.Update)
 	r.Post(subscriptionRoot+"/:id/pull", ss.Pull)
 	r.Post(subscriptionRoot+"/:id/ack", ss.Ack)
 	r.Post(subscriptionRoot+"/:id/ack/modify", ss.ModifyAck)
 	r.Post(subscriptionRoot+"/:id/push/modify", ss.ModifyPush)
+	r.Post(subscriptionRoot+"/:id/detach", ss.Detach)
+	r.Post(subscriptionRoot+"/:id/purge", ss.Purge)
+	r.Get(subscriptionRoot+"/:id/messages", ss.ListMessages)
+	r.Get(subscriptionRoot+"/:id/messages/:message_id", ss.GetMessage)
 	r.Delete(subscriptionRoot+"/:id", ss.Delete)
 
+	schemas := SchemaServer{}
+	schemaRoot := "/schema"
+	r.Get(schemaRoot+"/", schemas.List)
+	r.Get(schemaRoot+"/:id", schemas.Get)
+	r.Get(schemaRoot+"/:id/revisions", schemas.ListRevisions)
+	r.Put(schemaRoot+"/:id", schemas.Create)
+	r.Post(schemaRoot+"/:id/commit", schemas.Commit)
+	r.Delete(schemaRoot+"/:id", schemas.Delete)
+
 	ms := Monitoring{}
 	monitoringRoot := "/stats"
 	r.Get(monitoringRoot+"/", ms.Summary)
@@ -111,12 +185,18 @@ func Routes() *router.Router {
 	r.Get(monitoringRoot+"/topic/:id", ms.TopicDetail)
 	r.Get(monitoringRoot+"/subscription", ms.SubscriptionSummary)
 	r.Get(monitoringRoot+"/subscription/:id", ms.SubscriptionDetail)
+
+	r.Get(JWKSPath, JWKS)
 	return r
 }
 
 // Server is topic and subscription frontend server
 type Server struct {
 	cfg *Config
+
+	httpServer *http.Server
+	closed     bool
+	mu         sync.Mutex
 }
 
 // NewServer return initialized server
@@ -130,10 +210,31 @@ func NewServer(path string) (*Server, error) {
 	}, nil
 }
 
-// PrepareServer settings datastore and stats configuration
+// PrepareServer settings datastore, stats, limits, push signing key, push client, push lease and export configuration,
+// and resume the push loops of the existing push subscriptions
 func (s *Server) PrepareServer() error {
 	stats.Initialize()
-	return s.InitDatastore()
+	setLimits(s.cfg.Limits)
+	if err := setPushSigningKey(s.cfg.PushAuth, s.cfg.PushLease != nil); err != nil {
+		return errors.Wrap(err, "failed to load push signing key")
+	}
+	if err := setPushHTTPClient(s.cfg.PushClient); err != nil {
+		return errors.Wrap(err, "failed to create push client")
+	}
+	setPushLease(s.cfg.PushLease)
+	setExportRoot(s.cfg.Export)
+	setPushSinks(s.cfg.PushSinks)
+	if err := s.InitDatastore(); err != nil {
+		return err
+	}
+	if err := models.CheckPushLease(); err != nil {
+		return errors.Wrap(err, "failed to check push lease")
+	}
+	if err := models.ResumePushLoops(); err != nil {
+		return errors.Wrap(err, "failed to resume push loops")
+	}
+	models.WatchPushLoops()
+	return nil
 }
 
 // InitDatastore prepare datastore initialize
@@ -151,11 +252,90 @@ func (s *Server) InitDatastore() error {
 	if err := models.InitDatastoreMessageStatus(); err != nil {
 		return errors.Wrap(err, "failed to init datastore message status")
 	}
+	if err := models.InitDatastoreSchema(); err != nil {
+		return errors.Wrap(err, "failed to init datastore schema")
+	}
 	return nil
 }
 
-// Run start server
+// Run start server, and block until the server is shutdown
 func (s *Server) Run(port int) error {
-	log.Printf("Pubsub server running at http://localhost:%d/", port)
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), Routes())
+	server := &http.Server{
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: Routes(),
+	}
+	if s.cfg.TLS == nil {
+		if err := s.setHTTPServer(server); err != nil {
+			return ignoreServerClosed(err)
+		}
+		log.Printf("Pubsub server running at http://localhost:%d/", port)
+		return ignoreServerClosed(server.ListenAndServe())
+	}
+
+	reloader, err := newCertReloader(s.cfg.TLS)
+	if err != nil {
+		return errors.Wrap(err, "failed to load certificates")
+	}
+	tlsConfig, err := reloader.tlsConfig()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.watchReload(ctx)
+
+	server.Handler = authenticate(s.cfg.TLS, server.Handler)
+	server.TLSConfig = tlsConfig
+	if err := s.setHTTPServer(server); err != nil {
+		return ignoreServerClosed(err)
+	}
+	log.Printf("Pubsub server running at https://localhost:%d/", port)
+	return ignoreServerClosed(server.ListenAndServeTLS("", ""))
+}
+
+func (s *Server) setHTTPServer(server *http.Server) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return http.ErrServerClosed
+	}
+	if s.httpServer != nil {
+		return ErrAlreadyRunning
+	}
+	s.httpServer = server
+	return nil
+}
+
+func ignoreServerClosed(err error) error {
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// ShutdownTimeout returns deadline for the Shutdown
+func (s *Server) ShutdownTimeout() time.Duration {
+	if s.cfg.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return s.cfg.ShutdownTimeout
+}
+
+// Shutdown gracefully shutdown the server. stop accepting requests, and wait for the in-flight requests
+// and the push loops, after that close the datastore. returns error when ctx is done before finished.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.httpServer
+	s.closed = true
+	s.mu.Unlock()
+
+	if server != nil {
+		if err := server.Shutdown(ctx); err != nil {
+			return errors.Wrap(err, "failed to wait for in-flight requests")
+		}
+	}
+	if err := models.StopPushLoops(ctx); err != nil {
+		return err
+	}
+	return models.CloseDatastore()
 }
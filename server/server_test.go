@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func freePort(t *testing.T) int {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("failed to listen, got err %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestShutdown(t *testing.T) {
+	cases := []struct {
+		runBeforeShutdown bool
+	}{
+		{true},
+		{false},
+	}
+	for i, c := range cases {
+		s, err := NewServer("testdata/config/memory.yaml")
+		if err != nil {
+			t.Fatalf("#%d: failed to NewServer, got err %v", i, err)
+		}
+		if err := s.PrepareServer(); err != nil {
+			t.Fatalf("#%d: failed to PrepareServer, got err %v", i, err)
+		}
+
+		port := freePort(t)
+		errCh := make(chan error, 1)
+		if c.runBeforeShutdown {
+			go func() {
+				errCh <- s.Run(port)
+			}()
+			waitServerListen(t, port)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if !c.runBeforeShutdown {
+			go func() {
+				errCh <- s.Run(port)
+			}()
+		}
+
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Errorf("#%d: want no error from Run, got %v", i, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("#%d: want Run returned after Shutdown", i)
+		}
+	}
+}
+
+func waitServerListen(t *testing.T, port int) {
+	client := dummyClient(t)
+	for i := 0; i < 100; i++ {
+		res, err := client.Get("http://" + fmt.Sprintf("localhost:%d", port) + "/topic/")
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode == http.StatusOK {
+				return
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("failed to wait server listen, timeout error")
+}
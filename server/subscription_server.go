@@ -1,9 +1,11 @@
 package server
 
 import (
-	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
-	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/takashabe/go-pubsub/models"
@@ -19,20 +21,164 @@ type ResourceSubscription struct {
 	Topic      string     `json:"topic"`
 	Push       PushConfig `json:"push_config"`
 	AckTimeout int64      `json:"ack_deadline_seconds"`
+
+	// Retention is seconds to retain the undelivered messages, 0 is unlimited
+	Retention int64  `json:"message_retention_seconds,omitempty"`
+	Filter    string `json:"filter,omitempty"`
+
+	// Detached is output only, the subscription detached from the topic
+	Detached bool `json:"detached,omitempty"`
+	// PushHealth is output only, the delivery state of the push endpoint shared by the subscriptions
+	PushHealth *ResourcePushHealth `json:"push_health,omitempty"`
+	// Export makes the export subscription writing the messages to the files, it is set only at the creation
+	Export *ExportParam `json:"export_config,omitempty"`
+	models.Metadata
+}
+
+// ExportParam represent the files of the export subscription
+type ExportParam struct {
+	// Directory is relative to the export root of the server config
+	Directory string `json:"directory"`
+	// Format is "jsonl" or "avro"
+	Format           string `json:"format,omitempty"`
+	FilenameTemplate string `json:"filename_template,omitempty"`
+	// MaxBytes and MaxDurationSeconds rotate the file
+	MaxBytes           int64 `json:"max_bytes,omitempty"`
+	MaxDurationSeconds int64 `json:"max_duration_seconds,omitempty"`
+}
+
+// export returns the export config of the models
+func (p *ExportParam) export() *models.Export {
+	if p == nil {
+		return nil
+	}
+	return &models.Export{
+		Directory:        p.Directory,
+		Format:           models.ExportFormat(p.Format),
+		FilenameTemplate: p.FilenameTemplate,
+		MaxBytes:         p.MaxBytes,
+		MaxDuration:      time.Duration(p.MaxDurationSeconds) * time.Second,
+	}
+}
+
+// exportToParam is Export convert to ExportParam
+func exportToParam(e *models.Export) *ExportParam {
+	if e == nil {
+		return nil
+	}
+	return &ExportParam{
+		Directory:          e.Directory,
+		Format:             string(e.Format),
+		FilenameTemplate:   e.FilenameTemplate,
+		MaxBytes:           e.MaxBytes,
+		MaxDurationSeconds: int64(e.MaxDuration / time.Second),
+	}
+}
+
+// ResourcePushHealth represent the delivery state of the push endpoint
+type ResourcePushHealth struct {
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorTime       *time.Time `json:"last_error_time,omitempty"`
+	LastSuccessTime     *time.Time `json:"last_success_time,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	NextAttemptTime     *time.Time `json:"next_attempt_time,omitempty"`
+	CircuitOpen         bool       `json:"circuit_open"`
+}
+
+// pushHealthToResource is PushHealth convert to ResourcePushHealth, the zero times are omitted
+func pushHealthToResource(h models.PushHealth) *ResourcePushHealth {
+	timeOrNil := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	return &ResourcePushHealth{
+		LastError:           h.LastError,
+		LastErrorTime:       timeOrNil(h.LastErrorAt),
+		LastSuccessTime:     timeOrNil(h.LastSuccessAt),
+		ConsecutiveFailures: h.ConsecutiveFailures,
+		NextAttemptTime:     timeOrNil(h.NextAttemptAt),
+		CircuitOpen:         h.CircuitOpen(),
+	}
+}
+
+// options returns optional fields of the subscription
+func (r ResourceSubscription) options() models.SubscriptionOptions {
+	return models.SubscriptionOptions{
+		MessageRetention: time.Duration(r.Retention) * time.Second,
+		Filter:           r.Filter,
+		Push:             r.Push.options(),
+		Export:           r.Export.export(),
+		Metadata:         r.Metadata,
+	}
 }
 
 // PushConfig represent parmeter of push message
 type PushConfig struct {
 	Endpoint string            `json:"endpoint"`
 	Attr     map[string]string `json:"attributes"`
+	// Format is the payload format, "wrapped", "no_wrapper", "cloudevents_binary", "cloudevents_structured" or "batch"
+	Format string         `json:"format,omitempty"`
+	Auth   *PushAuthParam `json:"auth,omitempty"`
+
+	// MaxConcurrency is the number of the in-flight requests, BatchSize is the messages per request of the "batch" format
+	MaxConcurrency int `json:"max_concurrency,omitempty"`
+	BatchSize      int `json:"batch_size,omitempty"`
+	// TimeoutSeconds overrides the timeout of the push client, the attributes are sent as the HTTP headers
+	TimeoutSeconds int64 `json:"timeout_seconds,omitempty"`
+}
+
+// PushAuthParam represent authentication of the push request, the token and the secret are not responded
+type PushAuthParam struct {
+	// Type is "bearer", "hmac" or "oidc"
+	Type     string `json:"type"`
+	Token    string `json:"token,omitempty"`
+	Secret   string `json:"secret,omitempty"`
+	Audience string `json:"audience,omitempty"`
+}
+
+// options returns optional fields of the push
+func (p PushConfig) options() models.PushOptions {
+	opts := models.PushOptions{
+		Format:         models.PushFormat(p.Format),
+		MaxConcurrency: p.MaxConcurrency,
+		BatchSize:      p.BatchSize,
+		Timeout:        time.Duration(p.TimeoutSeconds) * time.Second,
+	}
+	if p.Auth != nil {
+		opts.Auth = models.PushAuth{
+			Type:     models.PushAuthType(p.Auth.Type),
+			Token:    p.Auth.Token,
+			Secret:   p.Auth.Secret,
+			Audience: p.Auth.Audience,
+		}
+	}
+	return opts
 }
 
 // subscriptionToResource is Subscription object convert to ResourceSubscription
 func subscriptionToResource(s *models.Subscription) ResourceSubscription {
 	pushConfig := PushConfig{}
+	var pushHealth *ResourcePushHealth
 	if s.PushConfig != nil && s.PushConfig.HasValidEndpoint() {
+		h, err := s.PushConfig.Health()
+		if err != nil {
+			log.Printf("failed to get push health, subscription=%s, error=%v", s.Name, err)
+		}
+		pushHealth = pushHealthToResource(h)
 		pushConfig.Endpoint = s.PushConfig.Endpoint.String()
 		pushConfig.Attr = s.PushConfig.Attributes.Dump()
+		pushConfig.Format = string(s.PushConfig.Format)
+		pushConfig.MaxConcurrency = s.PushConfig.MaxConcurrency
+		pushConfig.BatchSize = s.PushConfig.BatchSize
+		pushConfig.TimeoutSeconds = int64(s.PushConfig.Timeout / time.Second)
+		if auth := s.PushConfig.Auth; auth.Type != models.PushAuthNone {
+			pushConfig.Auth = &PushAuthParam{
+				Type:     string(auth.Type),
+				Audience: auth.Audience,
+			}
+		}
 	}
 
 	return ResourceSubscription{
@@ -40,6 +186,12 @@ func subscriptionToResource(s *models.Subscription) ResourceSubscription {
 		Topic:      s.TopicID,
 		Push:       pushConfig,
 		AckTimeout: int64(s.DefaultAckDeadline / time.Second),
+		Retention:  int64(s.MessageRetention / time.Second),
+		Filter:     s.Filter,
+		Detached:   s.Detached,
+		PushHealth: pushHealth,
+		Export:     exportToParam(s.ExportConfig),
+		Metadata:   s.Metadata,
 	}
 }
 
@@ -47,15 +199,15 @@ func subscriptionToResource(s *models.Subscription) ResourceSubscription {
 func (s *SubscriptionServer) Create(w http.ResponseWriter, r *http.Request, id string) {
 	// parse request
 	var req ResourceSubscription
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to parsed request")
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
 		return
 	}
 
 	// create subscription
-	sub, err := models.NewSubscription(id, req.Topic, req.AckTimeout, req.Push.Endpoint, req.Push.Attr)
+	sub, err := models.NewSubscription(id, req.Topic, req.AckTimeout, req.Push.Endpoint, req.Push.Attr, req.options())
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "failed to create subscription")
+		ErrorFrom(w, err, "failed to create subscription")
 		return
 	}
 	JSON(w, http.StatusCreated, subscriptionToResource(sub))
@@ -67,25 +219,82 @@ func (s *SubscriptionServer) Create(w http.ResponseWriter, r *http.Request, id s
 func (s *SubscriptionServer) Get(w http.ResponseWriter, r *http.Request, id string) {
 	sub, err := models.GetSubscription(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "not found subscription")
 		return
 	}
 	JSON(w, http.StatusOK, subscriptionToResource(sub))
 }
 
+// RequestUpdateSubscription represent request json for Update
+type RequestUpdateSubscription struct {
+	ResourceSubscription
+	// UpdateMask is comma separated field names to update.
+	// "ack_deadline_seconds", "push_config", "message_retention_seconds", "filter", "labels" and "description"
+	UpdateMask string `json:"update_mask"`
+}
+
+// Update overwrite the subscription fields specified by the update mask
+func (s *SubscriptionServer) Update(w http.ResponseWriter, r *http.Request, id string) {
+	var req RequestUpdateSubscription
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
+		return
+	}
+	sub, err := models.GetSubscription(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found subscription")
+		return
+	}
+	update := models.SubscriptionUpdate{
+		AckDeadlineSeconds:  req.AckTimeout,
+		PushEndpoint:        req.Push.Endpoint,
+		PushAttributes:      req.Push.Attr,
+		SubscriptionOptions: req.options(),
+	}
+	if err := sub.Update(update, parseUpdateMask(req.UpdateMask)); err != nil {
+		ErrorFrom(w, err, "failed to update subscription")
+		return
+	}
+	JSON(w, http.StatusOK, subscriptionToResource(sub))
+}
+
+// ResponseListSubscriptionResource represent response json of List
+type ResponseListSubscriptionResource struct {
+	Subscriptions []ResourceSubscription `json:"subscriptions"`
+	NextPageToken string                 `json:"next_page_token,omitempty"`
+}
+
 // List is gets subscription list
 func (s *SubscriptionServer) List(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err, "invalid list parameter")
+		return
+	}
 	subs, err := models.ListSubscription()
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "failed to list subscription")
 		return
 	}
-	sort.Sort(models.BySubscriptionName(subs))
-	resourceSubs := make([]ResourceSubscription, 0)
+	subMap := make(map[string]*models.Subscription, len(subs))
+	names := make([]string, 0, len(subs))
 	for _, sub := range subs {
-		resourceSubs = append(resourceSubs, subscriptionToResource(sub))
+		if !opts.match(sub.Metadata) {
+			continue
+		}
+		subMap[sub.Name] = sub
+		names = append(names, sub.Name)
+	}
+
+	page, next := opts.paginate(names)
+	res := ResponseListSubscriptionResource{
+		Subscriptions: make([]ResourceSubscription, 0, len(page)),
+		NextPageToken: next,
+	}
+	for _, name := range page {
+		res.Subscriptions = append(res.Subscriptions, subscriptionToResource(subMap[name]))
 	}
-	JSON(w, http.StatusOK, resourceSubs)
+	JSON(w, http.StatusOK, res)
 }
 
 // RequestPull is represents request json for Pull
@@ -104,20 +313,20 @@ func (s *SubscriptionServer) Pull(w http.ResponseWriter, r *http.Request, id str
 	// TODO: response timing flag, "immediately" and "wait untile at least one message"
 	// parse request
 	var req RequestPull
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to parsed request")
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
 		return
 	}
 
 	// pull messages
 	sub, err := models.GetSubscription(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "not found subscription")
 		return
 	}
 	msgs, err := sub.Pull(req.MaxMessages)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found message")
+		ErrorFrom(w, err, "not found message")
 		return
 	}
 	JSON(w, http.StatusOK, ResponsePull{Messages: msgs})
@@ -128,30 +337,62 @@ type RequestAck struct {
 	AckIDs []string `json:"ack_ids"`
 }
 
+// AckResult is the result of the each ack id in the ack request
+type AckResult struct {
+	AckID  string `json:"ack_id"`
+	Code   string `json:"code,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// ResponseAck represent response ack API json, Results are the same order as the request
+type ResponseAck struct {
+	Results []AckResult `json:"results"`
+}
+
 // Ack is setting ack state
 func (s *SubscriptionServer) Ack(w http.ResponseWriter, r *http.Request, id string) {
 	// parse request
 	var req RequestAck
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to parsed request")
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
 		return
 	}
 	if len(req.AckIDs) == 0 {
-		Error(w, http.StatusNotFound, nil, "invalid request payload")
+		Error(w, http.StatusBadRequest, nil, "invalid request payload")
 		return
 	}
 
 	// ack message
 	sub, err := models.GetSubscription(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "not found subscription")
 		return
 	}
-	if err := sub.Ack(req.AckIDs...); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to ack message")
+
+	// the failed ack id does not abort the others, the result of the each ack id is responded
+	res := ResponseAck{Results: make([]AckResult, 0, len(req.AckIDs))}
+	var (
+		firstErr error
+		failed   []ErrorDetail
+	)
+	errs := sub.AckEach(req.AckIDs...)
+	for i, ackID := range req.AckIDs {
+		if errs == nil || errs[i] == nil {
+			res.Results = append(res.Results, AckResult{AckID: ackID})
+			continue
+		}
+		if firstErr == nil {
+			firstErr = errs[i]
+		}
+		detail := errorDetail(i, errs[i])
+		failed = append(failed, detail)
+		res.Results = append(res.Results, AckResult{AckID: ackID, Code: detail.Code, Reason: detail.Reason})
+	}
+	if len(failed) == len(req.AckIDs) {
+		ErrorWithDetails(w, statusFromError(firstErr), firstErr, "failed to ack message", failed)
 		return
 	}
-	JSON(w, http.StatusOK, "")
+	JSON(w, http.StatusOK, res)
 }
 
 // RequestModifyAck represent request ModifyAck API json
@@ -164,20 +405,20 @@ type RequestModifyAck struct {
 func (s *SubscriptionServer) ModifyAck(w http.ResponseWriter, r *http.Request, id string) {
 	// parse request
 	var req RequestModifyAck
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to parsed request")
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
 		return
 	}
 
 	// modify ack
 	sub, err := models.GetSubscription(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "not found subscription")
 		return
 	}
 	for _, ackID := range req.AckIDs {
 		if err := sub.ModifyAckDeadline(ackID, req.AckDeadlineSeconds); err != nil {
-			Error(w, http.StatusNotFound, err, "failed to modify ack deadline seconds")
+			ErrorFrom(w, err, "failed to modify ack deadline seconds")
 			return
 		}
 	}
@@ -193,37 +434,199 @@ type RequestModifyPush struct {
 func (s *SubscriptionServer) ModifyPush(w http.ResponseWriter, r *http.Request, id string) {
 	// parse request
 	var req RequestModifyPush
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to parsed request")
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
 		return
 	}
 
 	// modify push
 	sub, err := models.GetSubscription(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "not found subscription")
 		return
 	}
 	if req.PushConfig == nil {
 		req.PushConfig = &PushConfig{}
 	}
-	err = sub.SetPushConfig(req.PushConfig.Endpoint, req.PushConfig.Attr)
+	err = sub.SetPushConfig(req.PushConfig.Endpoint, req.PushConfig.Attr, req.PushConfig.options())
 	if err != nil {
-		Error(w, http.StatusInternalServerError, err, "failed to modify push config")
+		ErrorFrom(w, err, "failed to modify push config")
 		return
 	}
 	JSON(w, http.StatusOK, "")
 }
 
+// ResourcePeekMessage represent the message not yet acked and the status
+type ResourcePeekMessage struct {
+	Message       *models.Message `json:"message"`
+	State         string          `json:"state"`
+	DeliveryCount int             `json:"delivery_count"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	AckDeadline   *time.Time      `json:"ack_deadline,omitempty"`
+}
+
+func peekedMessageToResource(p *models.PeekedMessage) ResourcePeekMessage {
+	res := ResourcePeekMessage{
+		Message:       p.Message,
+		State:         p.State,
+		DeliveryCount: p.DeliveryCount,
+	}
+	if !p.DeliveredAt.IsZero() {
+		deliveredAt, deadline := p.DeliveredAt, p.AckDeadline
+		res.DeliveredAt = &deliveredAt
+		res.AckDeadline = &deadline
+	}
+	return res
+}
+
+// ResponseListMessages represent response json of ListMessages
+type ResponseListMessages struct {
+	Messages      []ResourcePeekMessage `json:"messages"`
+	NextPageToken string                `json:"next_page_token,omitempty"`
+}
+
+// messageFilterExpr returns the filter expression and the label selectors "key" or "key:value" on the message attributes
+func messageFilterExpr(filter string, labels []string) string {
+	exprs := make([]string, 0, len(labels)+1)
+	if len(strings.TrimSpace(filter)) != 0 {
+		exprs = append(exprs, "("+filter+")")
+	}
+	for _, sel := range labels {
+		kv := strings.SplitN(sel, ":", 2)
+		if len(kv) == 2 {
+			exprs = append(exprs, fmt.Sprintf("attributes.%s = %s", strconv.Quote(kv[0]), strconv.Quote(kv[1])))
+		} else {
+			exprs = append(exprs, "attributes:"+strconv.Quote(kv[0]))
+		}
+	}
+	return strings.Join(exprs, " AND ")
+}
+
+// ListMessages is gets the messages not yet acked without leasing them.
+// the messages are filtered by the "state", the "filter" and the "label" parameters on the attributes,
+// and paginated by the MessageID.
+func (s *SubscriptionServer) ListMessages(w http.ResponseWriter, r *http.Request, id string) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err, "invalid list parameter")
+		return
+	}
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", models.PeekStateWaiting, models.PeekStateDelivered:
+	default:
+		Error(w, http.StatusBadRequest, nil, "invalid state parameter, waiting or delivered")
+		return
+	}
+	filter, err := models.ParseFilter(messageFilterExpr(r.URL.Query().Get("filter"), opts.labels))
+	if err != nil {
+		Error(w, http.StatusBadRequest, err, "invalid filter or label parameter")
+		return
+	}
+
+	sub, err := models.GetSubscription(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found subscription")
+		return
+	}
+	list, err := sub.Message.Peek()
+	if err != nil {
+		ErrorFrom(w, err, "failed to peek messages")
+		return
+	}
+	msgs := make(map[string]*models.PeekedMessage, len(list))
+	ids := make([]string, 0, len(list))
+	for _, p := range list {
+		if len(state) != 0 && p.State != state {
+			continue
+		}
+		if !filter.Match(p.Message.Attributes) {
+			continue
+		}
+		msgs[p.Message.ID] = p
+		ids = append(ids, p.Message.ID)
+	}
+
+	page, next := opts.paginate(ids)
+	res := ResponseListMessages{
+		Messages:      make([]ResourcePeekMessage, 0, len(page)),
+		NextPageToken: next,
+	}
+	for _, msgID := range page {
+		res.Messages = append(res.Messages, peekedMessageToResource(msgs[msgID]))
+	}
+	JSON(w, http.StatusOK, res)
+}
+
+// GetMessage is gets the message not yet acked without leasing it
+func (s *SubscriptionServer) GetMessage(w http.ResponseWriter, r *http.Request, id, msgID string) {
+	sub, err := models.GetSubscription(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found subscription")
+		return
+	}
+	p, err := sub.Message.PeekByID(msgID)
+	if err != nil {
+		ErrorFrom(w, err, "not found message")
+		return
+	}
+	JSON(w, http.StatusOK, peekedMessageToResource(p))
+}
+
+// RequestPurge represent request purge API json
+type RequestPurge struct {
+	// OlderThan purges the messages published before it, zero value purges the all messages
+	OlderThan time.Time `json:"older_than"`
+}
+
+// ResponsePurge represent response purge API json
+type ResponsePurge struct {
+	PurgedCount int `json:"purged_count"`
+}
+
+// Purge is ack the messages not yet acked in bulk, the request body is optional
+func (s *SubscriptionServer) Purge(w http.ResponseWriter, r *http.Request, id string) {
+	var req RequestPurge
+	if err := decodeOptionalJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
+		return
+	}
+	sub, err := models.GetSubscription(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found subscription")
+		return
+	}
+	n, err := sub.Purge(req.OlderThan)
+	if err != nil {
+		ErrorFrom(w, err, "failed to purge messages")
+		return
+	}
+	JSON(w, http.StatusOK, ResponsePurge{PurgedCount: n})
+}
+
+// Detach is detach the subscription from the topic, the config is kept and the messages not yet acked are dropped
+func (s *SubscriptionServer) Detach(w http.ResponseWriter, r *http.Request, id string) {
+	sub, err := models.GetSubscription(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found subscription")
+		return
+	}
+	if err := sub.Detach(); err != nil {
+		ErrorFrom(w, err, "failed to detach subscription")
+		return
+	}
+	JSON(w, http.StatusOK, subscriptionToResource(sub))
+}
+
 // Delete is delete subscription
 func (s *SubscriptionServer) Delete(w http.ResponseWriter, r *http.Request, id string) {
 	sub, err := models.GetSubscription(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "subscription already not exist")
+		ErrorFrom(w, err, "subscription already not exist")
 		return
 	}
 	if err := sub.Delete(); err != nil {
-		Error(w, http.StatusInternalServerError, err, "failed to delete subscription")
+		ErrorFrom(w, err, "failed to delete subscription")
 		return
 	}
 	JSON(w, http.StatusNoContent, "")
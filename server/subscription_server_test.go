@@ -2,13 +2,18 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/takashabe/go-pubsub/models"
 )
 
 func TestCreateSubscription(t *testing.T) {
@@ -33,7 +38,7 @@ func TestCreateSubscription(t *testing.T) {
 				AckTimeout: 10,
 			},
 			http.StatusCreated,
-			[]byte(`{"name":"A","topic":"a","push_config":{"endpoint":"test","attributes":{"1":"2"}},"ack_deadline_seconds":10}`),
+			[]byte(`{"name":"A","topic":"a","push_config":{"endpoint":"test","attributes":{"1":"2"}},"ack_deadline_seconds":10,"push_health":{"consecutive_failures":0,"circuit_open":false}}`),
 		},
 		{
 			"A",
@@ -45,8 +50,8 @@ func TestCreateSubscription(t *testing.T) {
 				},
 				AckTimeout: 10,
 			},
-			http.StatusNotFound,
-			[]byte(`{"reason":"failed to create subscription"}`),
+			http.StatusConflict,
+			[]byte(`{"code":"already_exists","reason":"failed to create subscription"}`),
 		},
 		{
 			"B",
@@ -60,8 +65,27 @@ func TestCreateSubscription(t *testing.T) {
 		{
 			"C",
 			"",
+			http.StatusBadRequest,
+			[]byte(`{"code":"invalid_argument","reason":"failed to parsed request"}`),
+		},
+		{
+			"D",
+			ResourceSubscription{
+				Topic:      "unknown",
+				AckTimeout: 10,
+			},
 			http.StatusNotFound,
-			[]byte(`{"reason":"failed to parsed request"}`),
+			[]byte(`{"code":"not_found","reason":"failed to create subscription"}`),
+		},
+		{
+			"E",
+			ResourceSubscription{
+				Topic:      "a",
+				AckTimeout: 10,
+				Export:     &ExportParam{Directory: "archive"},
+			},
+			http.StatusBadRequest,
+			[]byte(`{"code":"failed_precondition","reason":"failed to create subscription"}`),
 		},
 	}
 	for i, c := range cases {
@@ -112,7 +136,7 @@ func TestGetSubscription(t *testing.T) {
 		{
 			"C",
 			http.StatusNotFound,
-			[]byte(`{"reason":"not found subscription"}`),
+			[]byte(`{"code":"not_found","reason":"not found subscription"}`),
 		},
 	}
 	for i, c := range cases {
@@ -154,7 +178,7 @@ func TestDeleteSubscription(t *testing.T) {
 		{
 			"A",
 			http.StatusNotFound,
-			[]byte(`{"reason":"subscription already not exist"}`),
+			[]byte(`{"code":"not_found","reason":"subscription already not exist"}`),
 		},
 	}
 	for i, c := range cases {
@@ -188,27 +212,46 @@ func TestListSubscription(t *testing.T) {
 	defer ts.Close()
 	setupDummyTopicAndSub(t, ts)
 
-	client := dummyClient(t)
-	res, err := client.Get(fmt.Sprintf("%s/subscription/", ts.URL))
-	if err != nil {
-		t.Fatalf("failed to send request, got err %v", err)
+	cases := []struct {
+		query       string
+		expectCode  int
+		expectNames []string
+		expectToken string
+	}{
+		{"", http.StatusOK, []string{"A", "B"}, ""},
+		{"page_size=1", http.StatusOK, []string{"A"}, "QQ"},
+		{"page_size=1&page_token=QQ", http.StatusOK, []string{"B"}, ""},
+		{"order_by=name%20desc", http.StatusOK, []string{"B", "A"}, ""},
+		{"prefix=B", http.StatusOK, []string{"B"}, ""},
+		{"page_size=-1", http.StatusBadRequest, nil, ""},
 	}
-	defer res.Body.Close()
+	for i, c := range cases {
+		client := dummyClient(t)
+		res, err := client.Get(fmt.Sprintf("%s/subscription/?%s", ts.URL, c.query))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
 
-	wantCode := http.StatusOK
-	if got := res.StatusCode; got != wantCode {
-		t.Errorf("want %d, got %d", wantCode, got)
-	}
-	// want sub names
-	wantNames := []string{"A", "B"}
-	var subs []ResourceSubscription
-	if err := json.NewDecoder(res.Body).Decode(&subs); err != nil {
-		body, _ := ioutil.ReadAll(res.Body)
-		t.Fatalf("failed to decode response body, body=%v", body)
-	}
-	for i, n := range wantNames {
-		if subs[i].Name != n {
-			t.Errorf("#%d: want %s, got %s, got sub %v", i, n, subs[i].Name, subs[i])
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+		var body ResponseListSubscriptionResource
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("#%d: failed to decode response body, got err %v", i, err)
+		}
+		names := []string{}
+		for _, sub := range body.Subscriptions {
+			names = append(names, sub.Name)
+		}
+		if !reflect.DeepEqual(names, c.expectNames) {
+			t.Errorf("#%d: want %v, got %v", i, c.expectNames, names)
+		}
+		if body.NextPageToken != c.expectToken {
+			t.Errorf("#%d: want token %s, got %s", i, c.expectToken, body.NextPageToken)
 		}
 	}
 }
@@ -301,7 +344,8 @@ func TestAck(t *testing.T) {
 	}{
 		{RequestAck{AckIDs: ackIDs}, http.StatusOK},
 		{RequestAck{AckIDs: ackIDs}, http.StatusNotFound}, // used ackID want error
-		{"", http.StatusNotFound},
+		{RequestAck{}, http.StatusBadRequest},
+		{"", http.StatusBadRequest},
 	}
 	for i, c := range cases {
 		var buf bytes.Buffer
@@ -322,6 +366,253 @@ func TestAck(t *testing.T) {
 	}
 }
 
+func TestAckPartialFailure(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	dummyPublishMessage(t, ts)
+
+	response := pullMessage(t, ts, "A", 1)
+	defer response.Body.Close()
+	var responsePull ResponsePull
+	if err := json.NewDecoder(response.Body).Decode(&responsePull); err != nil {
+		t.Fatalf("failed to beforehand encode json, got err %v", err)
+	}
+	if len(responsePull.Messages) != 1 {
+		t.Fatalf("want 1 message, got %d", len(responsePull.Messages))
+	}
+	ackID := responsePull.Messages[0].AckID
+
+	cases := []struct {
+		input        []string
+		expectStatus int
+		expectCodes  []string
+	}{
+		// the unknown ack id does not abort the valid ack id
+		{[]string{"unknown", ackID}, http.StatusOK, []string{CodeNotFound, ""}},
+		// the all ack ids failed
+		{[]string{ackID, "unknown"}, http.StatusNotFound, []string{CodeNotFound, CodeNotFound}},
+	}
+	for i, c := range cases {
+		b, err := json.Marshal(RequestAck{AckIDs: c.input})
+		if err != nil {
+			t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+		}
+		res, err := dummyClient(t).Post(
+			fmt.Sprintf("%s/subscription/%s/ack", ts.URL, "A"),
+			"application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectStatus {
+			t.Errorf("#%d: code want %d, got %d", i, c.expectStatus, got)
+		}
+
+		var codes []string
+		if res.StatusCode == http.StatusOK {
+			var body ResponseAck
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+			}
+			for _, r := range body.Results {
+				codes = append(codes, r.Code)
+			}
+		} else {
+			var body ErrorResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+			}
+			for _, d := range body.Details {
+				codes = append(codes, d.Code)
+			}
+		}
+		if !reflect.DeepEqual(codes, c.expectCodes) {
+			t.Errorf("#%d: want codes %v, got %v", i, c.expectCodes, codes)
+		}
+	}
+}
+
+func TestDetach(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	dummyPublishMessage(t, ts)
+
+	cases := []struct {
+		input      string
+		expectCode int
+	}{
+		{"A", http.StatusOK},
+		{"A", http.StatusOK}, // already detached
+		{"Z", http.StatusNotFound},
+	}
+	for i, c := range cases {
+		res, err := dummyClient(t).Post(fmt.Sprintf("%s/subscription/%s/detach", ts.URL, c.input), "application/json", nil)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+		var body ResourceSubscription
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+		}
+		if !body.Detached {
+			t.Errorf("#%d: want detached, got %v", i, body)
+		}
+	}
+
+	// the detached subscription can not pull, the other subscription can pull
+	res := pullMessage(t, ts, "A", 1)
+	defer res.Body.Close()
+	var body ErrorResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response, got err %v", err)
+	}
+	if res.StatusCode != http.StatusConflict || body.Code != CodeFailedPrecondition {
+		t.Errorf("want %d %s, got %d %s", http.StatusConflict, CodeFailedPrecondition, res.StatusCode, body.Code)
+	}
+	res = pullMessage(t, ts, "B", 1)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	dummyPublishMessage(t, ts)
+
+	cases := []struct {
+		input       string
+		body        string
+		expectCode  int
+		expectCount int
+	}{
+		{"A", `{"older_than":"2000-01-01T00:00:00Z"}`, http.StatusOK, 0},
+		{"A", `{"older_than":"x"}`, http.StatusBadRequest, 0},
+		{"A", ``, http.StatusOK, 3},
+		{"A", ``, http.StatusOK, 0},
+		{"Z", ``, http.StatusNotFound, 0},
+	}
+	for i, c := range cases {
+		res, err := dummyClient(t).Post(fmt.Sprintf("%s/subscription/%s/purge", ts.URL, c.input), "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+		var body ResponsePurge
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+		}
+		if body.PurgedCount != c.expectCount {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCount, body.PurgedCount)
+		}
+	}
+
+	// the other subscription keeps the messages
+	res := pullMessage(t, ts, "B", 2)
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("want %d, got %d", http.StatusOK, res.StatusCode)
+	}
+}
+
+func TestListMessages(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	dummyPublishMessage(t, ts)
+
+	// lease one message
+	res := pullMessage(t, ts, "A", 1)
+	defer res.Body.Close()
+	var pulled ResponsePull
+	if err := json.NewDecoder(res.Body).Decode(&pulled); err != nil || len(pulled.Messages) != 1 {
+		t.Fatalf("failed to pull message, got %v, %v", pulled, err)
+	}
+
+	cases := []struct {
+		query       string
+		expectCode  int
+		expectCount int
+		expectNext  bool
+	}{
+		{"", http.StatusOK, 3, false},
+		{"?state=waiting", http.StatusOK, 2, false},
+		{"?state=delivered", http.StatusOK, 1, false},
+		{"?filter=" + url.QueryEscape(`attributes:"1" OR attributes:"2"`), http.StatusOK, 2, false},
+		{"?state=waiting&page_size=1", http.StatusOK, 1, true},
+		{"?state=acked", http.StatusBadRequest, 0, false},
+		{"?filter=" + url.QueryEscape("("), http.StatusBadRequest, 0, false},
+		{"?label=1", http.StatusOK, 1, false},
+		{"?label=2:3", http.StatusOK, 1, false},
+		{"?label=2:4", http.StatusOK, 0, false},
+		{"?label=1&label=2", http.StatusOK, 0, false},
+		{"?filter=" + url.QueryEscape(`attributes:"1" OR attributes:"2"`) + "&label=2", http.StatusOK, 1, false},
+	}
+	for i, c := range cases {
+		res, err := dummyClient(t).Get(fmt.Sprintf("%s/subscription/A/messages%s", ts.URL, c.query))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Fatalf("#%d: code want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+		var body ResponseListMessages
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+		}
+		if got := len(body.Messages); got != c.expectCount {
+			t.Errorf("#%d: want %d messages, got %d", i, c.expectCount, got)
+		}
+		if got := len(body.NextPageToken) != 0; got != c.expectNext {
+			t.Errorf("#%d: want next page %t, got %t", i, c.expectNext, got)
+		}
+	}
+
+	// get the leased message
+	msgID := pulled.Messages[0].Message.ID
+	res, err := dummyClient(t).Get(fmt.Sprintf("%s/subscription/A/messages/%s", ts.URL, msgID))
+	if err != nil {
+		t.Fatalf("failed to send request, got err %v", err)
+	}
+	defer res.Body.Close()
+	var got ResourcePeekMessage
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatalf("failed to decode response, got err %v", err)
+	}
+	if got.Message.ID != msgID || got.State != "delivered" || got.DeliveryCount != 1 || got.AckDeadline == nil {
+		t.Errorf("want delivered message %s, got %#v", msgID, got)
+	}
+	res, err = dummyClient(t).Get(fmt.Sprintf("%s/subscription/A/messages/unknown", ts.URL))
+	if err != nil {
+		t.Fatalf("failed to send request, got err %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("want %d, got %d", http.StatusNotFound, res.StatusCode)
+	}
+}
+
 // testing for ack timeout
 func TestPullAck(t *testing.T) {
 	ts := setupServer(t)
@@ -511,6 +802,72 @@ func TestModifyPush(t *testing.T) {
 			RequestModifyPush{},
 			http.StatusOK,
 		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: ":", Attr: nil},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", Format: "cloudevents_binary"},
+			},
+			http.StatusOK,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", Format: "xml"},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", Auth: &PushAuthParam{Type: "hmac", Secret: "s"}},
+			},
+			http.StatusOK,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", Auth: &PushAuthParam{Type: "bearer"}},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", Format: "batch", MaxConcurrency: 4, BatchSize: 10},
+			},
+			http.StatusOK,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", MaxConcurrency: 101},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "localhost:8080", TimeoutSeconds: 601},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "file:///tmp/push.jsonl", Format: "no_wrapper"},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "file:///etc/passwd"},
+			},
+			http.StatusBadRequest,
+		},
+		{
+			RequestModifyPush{
+				PushConfig: &PushConfig{Endpoint: "unix:///var/run/docker.sock?path=/containers/create"},
+			},
+			http.StatusBadRequest,
+		},
 	}
 	for i, c := range cases {
 		res := requestModifyPush(c.body)
@@ -523,3 +880,93 @@ func TestModifyPush(t *testing.T) {
 		}
 	}
 }
+
+func TestUpdateSubscription(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopics(t, ts)
+	createDummySubscription(t, ts, ResourceSubscription{
+		Name:       "A",
+		Topic:      "a",
+		AckTimeout: 10,
+		Metadata:   models.Metadata{Labels: map[string]string{"env": "dev"}},
+	})
+
+	cases := []struct {
+		input      string
+		expectCode int
+		expect     ResourceSubscription
+	}{
+		{
+			`{"description":"desc","update_mask":"description"}`,
+			http.StatusOK,
+			ResourceSubscription{
+				Name: "A", Topic: "a", AckTimeout: 10,
+				Metadata: models.Metadata{Labels: map[string]string{"env": "dev"}, Description: "desc"},
+			},
+		},
+		{
+			`{"ack_deadline_seconds":30,"message_retention_seconds":600,"filter":"attributes:env","labels":{"env":"prod"},"update_mask":"ack_deadline_seconds,message_retention_seconds,filter,labels"}`,
+			http.StatusOK,
+			ResourceSubscription{
+				Name: "A", Topic: "a", AckTimeout: 30, Retention: 600, Filter: "attributes:env",
+				Metadata: models.Metadata{Labels: map[string]string{"env": "prod"}, Description: "desc"},
+			},
+		},
+		{
+			`{"push_config":{"endpoint":"localhost:8080"},"update_mask":"push_config"}`,
+			http.StatusOK,
+			ResourceSubscription{
+				Name: "A", Topic: "a", AckTimeout: 30, Retention: 600, Filter: "attributes:env",
+				Push:       PushConfig{Endpoint: "localhost:8080", Attr: map[string]string{}},
+				PushHealth: &ResourcePushHealth{},
+				Metadata:   models.Metadata{Labels: map[string]string{"env": "prod"}, Description: "desc"},
+			},
+		},
+		{
+			// invalid filter, nothing is changed
+			`{"ack_deadline_seconds":60,"push_config":{},"filter":"attributes.env = dev","update_mask":"ack_deadline_seconds,push_config,filter"}`,
+			http.StatusBadRequest,
+			ResourceSubscription{
+				Name: "A", Topic: "a", AckTimeout: 30, Retention: 600, Filter: "attributes:env",
+				Push:       PushConfig{Endpoint: "localhost:8080", Attr: map[string]string{}},
+				PushHealth: &ResourcePushHealth{},
+				Metadata:   models.Metadata{Labels: map[string]string{"env": "prod"}, Description: "desc"},
+			},
+		},
+		{
+			`{"topic":"b","update_mask":"topic"}`,
+			http.StatusBadRequest,
+			ResourceSubscription{
+				Name: "A", Topic: "a", AckTimeout: 30, Retention: 600, Filter: "attributes:env",
+				Push:       PushConfig{Endpoint: "localhost:8080", Attr: map[string]string{}},
+				PushHealth: &ResourcePushHealth{},
+				Metadata:   models.Metadata{Labels: map[string]string{"env": "prod"}, Description: "desc"},
+			},
+		},
+	}
+	for i, c := range cases {
+		client := dummyClient(t)
+		req, err := http.NewRequest("PATCH", ts.URL+"/subscription/A", bytes.NewBufferString(c.input))
+		if err != nil {
+			t.Fatalf("#%d: failed to create request, got err %v", i, err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+
+		sub, err := models.GetSubscription("A")
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		if got := subscriptionToResource(sub); !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("#%d: want %#v, got %#v", i, c.expect, got)
+		}
+	}
+	models.StopPushLoops(context.Background())
+}
@@ -89,6 +89,19 @@ func createDummyTopic(t *testing.T, ts *httptest.Server, id string) {
 	defer res.Body.Close()
 }
 
+func createDummyTopicWithBody(t *testing.T, ts *httptest.Server, id, body string) {
+	client := dummyClient(t)
+	req, err := http.NewRequest("PUT", ts.URL+"/topic/"+id, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal("failed to create request")
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal("failed to send request")
+	}
+	defer res.Body.Close()
+}
+
 func createDummySubscription(t *testing.T, ts *httptest.Server, resource ResourceSubscription) {
 	client := dummyClient(t)
 	b, err := json.Marshal(resource)
@@ -151,7 +164,7 @@ func dummyPublishMessage(t *testing.T, ts *httptest.Server) {
 // warning: direct access to models package
 func hackCreateShortAckSubscription(t *testing.T) {
 	// require created topic "a"
-	s, err := models.NewSubscription("A", "a", 0, "", nil)
+	s, err := models.NewSubscription("A", "a", 0, "", nil, models.SubscriptionOptions{})
 	if err != nil {
 		t.Fatalf("failed to create subscription, got err %v", err)
 	}
@@ -178,3 +191,23 @@ func pullMessage(t *testing.T, ts *httptest.Server, sub string, size int) *http.
 	}
 	return res
 }
+
+func createDummySchema(t *testing.T, ts *httptest.Server, id string, req RequestCreateSchema) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal("failed to encode json")
+	}
+	client := dummyClient(t)
+	httpReq, err := http.NewRequest("PUT", ts.URL+"/schema/"+id, bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal("failed to create request")
+	}
+	res, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatal("failed to send request")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("failed to create schema, status code %d", res.StatusCode)
+	}
+}
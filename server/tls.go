@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// TLS errors
+var (
+	ErrInvalidClientAuth = errors.New("invalid client_auth, choose from none, request or require")
+	ErrInvalidClientCA   = errors.New("failed to append client CA certificates")
+)
+
+// TLSConfig represent config for the TLS, written under "tls"
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"`
+
+	// ClientAuth is policy for the client certificate. "none", "request" or "require"
+	ClientAuth string `yaml:"client_auth"`
+
+	// Identities is mapping from the client certificate subject to the identity name.
+	// the key is matched to the full subject (e.g. "CN=foo,O=bar") first, and the common name next.
+	Identities map[string]string `yaml:"identities"`
+}
+
+func (c *TLSConfig) clientAuthType() (tls.ClientAuthType, error) {
+	switch c.ClientAuth {
+	case "", "none":
+		if len(c.ClientCAFile) != 0 {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, ErrInvalidClientAuth
+	}
+}
+
+// certReloader holds the certificates, and reload them from the files
+type certReloader struct {
+	cfg       *TLSConfig
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	mu        sync.RWMutex
+}
+
+func newCertReloader(cfg *TLSConfig) (*certReloader, error) {
+	r := &certReloader{cfg: cfg}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload read the certificate files, keep current certificates if failed to load
+func (r *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load key pair")
+	}
+	var pool *x509.CertPool
+	if len(r.cfg.ClientCAFile) != 0 {
+		pem, err := ioutil.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to load client CA")
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return ErrInvalidClientCA
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = pool
+	return nil
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// tlsConfig returns tls.Config which always refer to the latest certificates
+func (r *certReloader) tlsConfig() (*tls.Config, error) {
+	authType, err := r.cfg.clientAuthType()
+	if err != nil {
+		return nil, err
+	}
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+		ClientAuth:     authType,
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = r.clientCAs
+		return c, nil
+	}
+	return base, nil
+}
+
+// watchReload reload certificates at receive SIGHUP, until ctx is done
+func (r *certReloader) watchReload(ctx context.Context) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case <-ch:
+			if err := r.Reload(); err != nil {
+				log.Printf("failed to reload certificates, keep current certificates: %v", err)
+				continue
+			}
+			log.Println("reloaded certificates")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity of the client certificate
+func IdentityFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(identityKey{}).(string)
+	return id, ok
+}
+
+// lookupIdentity returns the identity matched the certificate subject
+func lookupIdentity(identities map[string]string, cert *x509.Certificate) (string, bool) {
+	if id, ok := identities[cert.Subject.String()]; ok {
+		return id, true
+	}
+	id, ok := identities[cert.Subject.CommonName]
+	return id, ok
+}
+
+// authenticate associate the client certificate to the identity.
+// when specified Identities, reject the unknown certificate subjects. JWKSPath is public for the push receivers.
+func authenticate(cfg *TLSConfig, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == JWKSPath {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			if len(cfg.Identities) != 0 {
+				Error(w, http.StatusUnauthorized, nil, "require client certificate")
+				return
+			}
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cert := r.TLS.PeerCertificates[0]
+		id, ok := lookupIdentity(cfg.Identities, cert)
+		if !ok {
+			if len(cfg.Identities) != 0 {
+				Error(w, http.StatusForbidden, nil, "unknown client identity")
+				return
+			}
+			id = cert.Subject.CommonName
+		}
+		PrintDebugf("authenticated client identity: %s", id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, id)))
+	})
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func (c *testCert) keyPair(t *testing.T) tls.Certificate {
+	pair, err := tls.X509KeyPair(c.certPEM, c.keyPEM)
+	if err != nil {
+		t.Fatalf("failed to create key pair, got err %v", err)
+	}
+	return pair
+}
+
+// createTestCert returns self-signed certificate when parent is nil
+func createTestCert(t *testing.T, cn string, serial int64, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key, got err %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"pubsub"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signerCert, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate, got err %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate, got err %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key, got err %v", err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("failed to write file %s, got err %v", path, err)
+	}
+}
+
+func TestCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-tls")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := createTestCert(t, "ca", 1, nil)
+	cfg := &TLSConfig{
+		CertFile: filepath.Join(dir, "server.crt"),
+		KeyFile:  filepath.Join(dir, "server.key"),
+	}
+
+	first := createTestCert(t, "localhost", 2, ca)
+	writeTestFile(t, cfg.CertFile, first.certPEM)
+	writeTestFile(t, cfg.KeyFile, first.keyPEM)
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+
+	cases := []struct {
+		prepare      func()
+		expectSerial int64
+		expectErr    bool
+	}{
+		{
+			func() {},
+			2, false,
+		},
+		{
+			func() {
+				second := createTestCert(t, "localhost", 3, ca)
+				writeTestFile(t, cfg.CertFile, second.certPEM)
+				writeTestFile(t, cfg.KeyFile, second.keyPEM)
+			},
+			3, false,
+		},
+		{
+			// broken files keep current certificate
+			func() {
+				writeTestFile(t, cfg.CertFile, []byte("broken"))
+			},
+			3, true,
+		},
+	}
+	for i, c := range cases {
+		c.prepare()
+		if err := r.Reload(); (err != nil) != c.expectErr {
+			t.Fatalf("#%d: want error %t, got %v", i, c.expectErr, err)
+		}
+		cert, err := r.getCertificate(nil)
+		if err != nil {
+			t.Fatalf("#%d: want no error, got %v", i, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("#%d: failed to parse certificate, got err %v", i, err)
+		}
+		if got := leaf.SerialNumber.Int64(); got != c.expectSerial {
+			t.Errorf("#%d: want serial %d, got %d", i, c.expectSerial, got)
+		}
+	}
+}
+
+func TestAuthenticateClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pubsub-tls")
+	if err != nil {
+		t.Fatalf("failed to create temp dir, got err %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ca := createTestCert(t, "ca", 1, nil)
+	serverCert := createTestCert(t, "localhost", 2, ca)
+	cfg := &TLSConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+		ClientAuth:   "request",
+		Identities:   map[string]string{"publisher": "app-publisher"},
+	}
+	writeTestFile(t, cfg.CertFile, serverCert.certPEM)
+	writeTestFile(t, cfg.KeyFile, serverCert.keyPEM)
+	writeTestFile(t, cfg.ClientCAFile, ca.certPEM)
+
+	r, err := newCertReloader(cfg)
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	tlsConfig, err := r.tlsConfig()
+	if err != nil {
+		t.Fatalf("want no error, got %v", err)
+	}
+	ts := httptest.NewUnstartedServer(authenticate(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := IdentityFromContext(r.Context())
+		w.Write([]byte(id))
+	})))
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	cases := []struct {
+		clientCert     *testCert
+		expectCode     int
+		expectIdentity string
+	}{
+		{createTestCert(t, "publisher", 10, ca), http.StatusOK, "app-publisher"},
+		{createTestCert(t, "stranger", 11, ca), http.StatusForbidden, ""},
+		{nil, http.StatusUnauthorized, ""},
+	}
+	for i, c := range cases {
+		clientTLS := &tls.Config{RootCAs: roots}
+		if c.clientCert != nil {
+			clientTLS.Certificates = []tls.Certificate{c.clientCert.keyPair(t)}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+		res, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if c.expectCode != http.StatusOK {
+			continue
+		}
+		if got, _ := ioutil.ReadAll(res.Body); string(got) != c.expectIdentity {
+			t.Errorf("#%d: want identity %s, got %s", i, c.expectIdentity, got)
+		}
+	}
+}
@@ -1,10 +1,10 @@
 package server
 
 import (
-	"encoding/json"
 	"net/http"
-	"sort"
+	"strconv"
 
+	"github.com/pkg/errors"
 	"github.com/takashabe/go-pubsub/models"
 	"github.com/takashabe/go-pubsub/stats"
 )
@@ -12,11 +12,29 @@ import (
 // TopicServer is topic frontend server
 type TopicServer struct{}
 
-// Create is create topic
+// RequestCreateTopic represent request json for Create
+type RequestCreateTopic struct {
+	SchemaSettings *models.SchemaSettings `json:"schema_settings"`
+	models.Metadata
+}
+
+func (r RequestCreateTopic) options() models.TopicOptions {
+	return models.TopicOptions{
+		SchemaSettings: r.SchemaSettings,
+		Metadata:       r.Metadata,
+	}
+}
+
+// Create is create topic, the request body is optional
 func (s *TopicServer) Create(w http.ResponseWriter, r *http.Request, id string) {
-	t, err := models.NewTopic(id)
+	var req RequestCreateTopic
+	if err := decodeOptionalJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
+		return
+	}
+	t, err := models.NewTopic(id, req.options())
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "failed to create topic")
+		ErrorFrom(w, err, "failed to create topic")
 		return
 	}
 	JSON(w, http.StatusCreated, t)
@@ -28,59 +46,146 @@ func (s *TopicServer) Create(w http.ResponseWriter, r *http.Request, id string)
 func (s *TopicServer) Get(w http.ResponseWriter, r *http.Request, id string) {
 	t, err := models.GetTopic(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found topic")
+		ErrorFrom(w, err, "not found topic")
+		return
+	}
+	JSON(w, http.StatusOK, t)
+}
+
+// RequestUpdateTopic represent request json for Update
+type RequestUpdateTopic struct {
+	RequestCreateTopic
+	// UpdateMask is comma separated field names to update. "schema_settings", "labels" and "description"
+	UpdateMask string `json:"update_mask"`
+}
+
+// Update overwrite the topic fields specified by the update mask
+func (s *TopicServer) Update(w http.ResponseWriter, r *http.Request, id string) {
+	var req RequestUpdateTopic
+	if err := decodeJSON(w, r, &req); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
+		return
+	}
+	t, err := models.GetTopic(id)
+	if err != nil {
+		ErrorFrom(w, err, "not found topic")
+		return
+	}
+	if err := t.Update(req.options(), parseUpdateMask(req.UpdateMask)); err != nil {
+		ErrorFrom(w, err, "failed to update topic")
 		return
 	}
 	JSON(w, http.StatusOK, t)
 }
 
+// ResponseListTopic represent response json of List
+type ResponseListTopic struct {
+	Topics        []*models.Topic `json:"topics"`
+	NextPageToken string          `json:"next_page_token,omitempty"`
+}
+
 // List is gets topic list
 func (s *TopicServer) List(w http.ResponseWriter, r *http.Request) {
-	t, err := models.ListTopic()
+	opts, err := parseListOptions(r)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found topic")
+		Error(w, http.StatusBadRequest, err, "invalid list parameter")
 		return
 	}
-	sort.Sort(models.ByTopicName(t))
-	JSON(w, http.StatusOK, t)
+	ts, err := models.ListTopic()
+	if err != nil {
+		ErrorFrom(w, err, "failed to list topic")
+		return
+	}
+	topics := make(map[string]*models.Topic, len(ts))
+	names := make([]string, 0, len(ts))
+	for _, t := range ts {
+		if !opts.match(t.Metadata) {
+			continue
+		}
+		topics[t.Name] = t
+		names = append(names, t.Name)
+	}
+
+	page, next := opts.paginate(names)
+	res := ResponseListTopic{
+		Topics:        make([]*models.Topic, 0, len(page)),
+		NextPageToken: next,
+	}
+	for _, name := range page {
+		res.Topics = append(res.Topics, topics[name])
+	}
+	JSON(w, http.StatusOK, res)
 }
 
 // ResponseListSubscription represent response json of ListSubscription
 type ResponseListSubscription struct {
 	SubscriptionNames []string `json:"subscriptions"`
+	NextPageToken     string   `json:"next_page_token,omitempty"`
 }
 
 // ListSubscription is gets topic depends subscription list
 func (s *TopicServer) ListSubscription(w http.ResponseWriter, r *http.Request, id string) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		Error(w, http.StatusBadRequest, err, "invalid list parameter")
+		return
+	}
 	t, err := models.GetTopic(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found topic")
+		ErrorFrom(w, err, "not found topic")
 		return
 	}
 	subs, err := t.GetSubscriptions()
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found subscription")
+		ErrorFrom(w, err, "failed to list subscription")
 		return
 	}
-	sort.Sort(models.BySubscriptionName(subs))
-	res := ResponseListSubscription{
-		SubscriptionNames: make([]string, 0, len(subs)),
-	}
+	names := make([]string, 0, len(subs))
 	for _, s := range subs {
-		res.SubscriptionNames = append(res.SubscriptionNames, s.Name)
+		if opts.match(s.Metadata) {
+			names = append(names, s.Name)
+		}
 	}
-	JSON(w, http.StatusOK, res)
+
+	page, next := opts.paginate(names)
+	JSON(w, http.StatusOK, ResponseListSubscription{
+		SubscriptionNames: page,
+		NextPageToken:     next,
+	})
 }
 
-// Delete is delete topic
+// Delete is delete topic, the subscriptions of the topic are detached or deleted by the "cascade" parameter
 func (s *TopicServer) Delete(w http.ResponseWriter, r *http.Request, id string) {
+	cascade := false
+	if v := r.URL.Query().Get("cascade"); len(v) != 0 {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			Error(w, http.StatusBadRequest, err, "invalid cascade parameter")
+			return
+		}
+		cascade = b
+	}
 	t, err := models.GetTopic(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "topic already not exist")
+		ErrorFrom(w, err, "topic already not exist")
 		return
 	}
+	if cascade {
+		subs, err := t.GetSubscriptions()
+		if err != nil {
+			ErrorFrom(w, err, "failed to get subscriptions")
+			return
+		}
+		for _, sub := range subs {
+			if err := sub.Delete(); err != nil {
+				ErrorFrom(w, err, "failed to delete subscription")
+				return
+			}
+			stats.GetSubscriptionAdapter().AddSubscription(sub.Name, -1)
+		}
+	}
 	if err := t.Delete(); err != nil {
-		Error(w, http.StatusInternalServerError, err, "failed to delete topic")
+		ErrorFrom(w, err, "failed to delete topic")
 		return
 	}
 	JSON(w, http.StatusNoContent, "")
@@ -99,37 +204,92 @@ type PublishDatas struct {
 	Messages []PublishData `json:"messages"`
 }
 
-// ResponsePublish represent reponse publish api
+// PublishResult is the result of the each message in the publish request
+type PublishResult struct {
+	MessageID string `json:"message_id,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// ResponsePublish represent reponse publish api.
+// MessageIDs and Results are the same order as the request, the failed message has empty ID and the error code.
 type ResponsePublish struct {
-	MessageIDs []string `json:"message_ids"`
+	MessageIDs []string        `json:"message_ids"`
+	Results    []PublishResult `json:"results"`
 }
 
 // Publish is publish message
 func (s *TopicServer) Publish(w http.ResponseWriter, r *http.Request, id string) {
 	// parse request
-	decorder := json.NewDecoder(r.Body)
 	var datas PublishDatas
-	if err := decorder.Decode(&datas); err != nil {
-		Error(w, http.StatusNotFound, err, "failed to parsed request")
+	if err := decodeJSON(w, r, &datas); err != nil {
+		Error(w, http.StatusBadRequest, err, "failed to parsed request")
 		return
 	}
 
-	// publish message
+	// the request is rejected when the number of the messages exceeds the limit
+	l := currentLimits()
+	if len(datas.Messages) > l.MaxPublishMessages {
+		Error(w, http.StatusBadRequest, ErrTooManyMessages, "too many messages")
+		return
+	}
 	t, err := models.GetTopic(id)
 	if err != nil {
-		Error(w, http.StatusNotFound, err, "not found topic")
+		ErrorFrom(w, err, "not found topic")
 		return
 	}
-	pubIDs := make([]string, 0)
-	for _, d := range datas.Messages {
-		id, err := t.Publish(d.Data, d.Attr)
+
+	// the messages exceeding the limits or not conforming to the schema are rejected,
+	// they do not abort the others
+	rejected := make([]error, len(datas.Messages))
+	for i, d := range datas.Messages {
+		if err := l.validateMessage(d); err != nil {
+			rejected[i] = err
+			continue
+		}
+		if err := t.ValidateMessage(d.Data); err != nil {
+			if errors.Cause(err) != models.ErrSchemaViolation {
+				ErrorFrom(w, err, "failed to validate message")
+				return
+			}
+			rejected[i] = err
+		}
+	}
+
+	// the failed message does not abort the others, the result of the each message is responded
+	res := ResponsePublish{
+		MessageIDs: make([]string, 0, len(datas.Messages)),
+		Results:    make([]PublishResult, 0, len(datas.Messages)),
+	}
+	var (
+		firstErr error
+		failed   []ErrorDetail
+	)
+	for i, d := range datas.Messages {
+		err := rejected[i]
+		id := ""
+		if err == nil {
+			id, err = t.Publish(d.Data, d.Attr)
+		}
 		if err != nil {
-			Error(w, http.StatusInternalServerError, err, "failed publish message")
-			return
+			if firstErr == nil {
+				firstErr = err
+			}
+			detail := errorDetail(i, err)
+			failed = append(failed, detail)
+			res.MessageIDs = append(res.MessageIDs, "")
+			res.Results = append(res.Results, PublishResult{Code: detail.Code, Reason: detail.Reason})
+			continue
 		}
-		pubIDs = append(pubIDs, id)
+		res.MessageIDs = append(res.MessageIDs, id)
+		res.Results = append(res.Results, PublishResult{MessageID: id})
 	}
-	JSON(w, http.StatusOK, ResponsePublish{MessageIDs: pubIDs})
+	if firstErr != nil && len(failed) == len(datas.Messages) {
+		// nothing is published, the request is retryable as a whole when the error is retryable
+		ErrorWithDetails(w, statusFromError(firstErr), firstErr, "failed publish message", failed)
+		return
+	}
+	JSON(w, http.StatusOK, res)
 
-	stats.GetTopicAdapter().AddMessage(t.Name, len(datas.Messages))
+	stats.GetTopicAdapter().AddMessage(t.Name, len(datas.Messages)-len(failed))
 }
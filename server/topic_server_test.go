@@ -7,7 +7,10 @@ import (
 	"io/ioutil"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/takashabe/go-pubsub/models"
 )
 
 func TestCreateAndGetTopic(t *testing.T) {
@@ -29,8 +32,8 @@ func TestCreateAndGetTopic(t *testing.T) {
 		},
 		{
 			"A",
-			http.StatusNotFound, http.StatusOK,
-			[]byte(`{"reason":"failed to create topic"}`),
+			http.StatusConflict, http.StatusOK,
+			[]byte(`{"code":"already_exists","reason":"failed to create topic"}`),
 			[]byte(`{"name":"A"}`),
 		},
 	}
@@ -72,6 +75,71 @@ func TestCreateAndGetTopic(t *testing.T) {
 	}
 }
 
+func TestUpdateTopic(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+
+	client := dummyClient(t)
+	create, err := http.NewRequest("PUT", ts.URL+"/topic/a",
+		bytes.NewBufferString(`{"labels":{"env":"dev"},"description":"first"}`))
+	if err != nil {
+		t.Fatal("failed to create request")
+	}
+	res, err := client.Do(create)
+	if err != nil {
+		t.Fatal("failed to send request")
+	}
+	defer res.Body.Close()
+	if got, _ := ioutil.ReadAll(res.Body); string(got) != `{"name":"a","labels":{"env":"dev"},"description":"first"}` {
+		t.Errorf("want created topic with metadata, got %s", got)
+	}
+
+	cases := []struct {
+		input      string
+		expectCode int
+		expectBody []byte
+	}{
+		{
+			`{"labels":{"env":"prod"},"update_mask":"labels"}`,
+			http.StatusOK,
+			[]byte(`{"name":"a","labels":{"env":"prod"},"description":"first"}`),
+		},
+		{
+			`{"description":"second","update_mask":"labels, description"}`,
+			http.StatusOK,
+			[]byte(`{"name":"a","description":"second"}`),
+		},
+		{
+			`{"description":"third"}`,
+			http.StatusBadRequest,
+			[]byte(`{"code":"invalid_argument","reason":"failed to update topic"}`),
+		},
+		{
+			`{"labels":{"-":"v"},"update_mask":"labels"}`,
+			http.StatusBadRequest,
+			[]byte(`{"code":"invalid_argument","reason":"failed to update topic"}`),
+		},
+	}
+	for i, c := range cases {
+		req, err := http.NewRequest("PATCH", ts.URL+"/topic/a", bytes.NewBufferString(c.input))
+		if err != nil {
+			t.Fatalf("#%d: failed to create request", i)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request", i)
+		}
+		defer res.Body.Close()
+
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if got, _ := ioutil.ReadAll(res.Body); !reflect.DeepEqual(got, c.expectBody) {
+			t.Errorf("#%d: want %s, got %s", i, c.expectBody, got)
+		}
+	}
+}
+
 func TestGetTopic(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
@@ -113,7 +181,7 @@ func TestDelete(t *testing.T) {
 		expectBody []byte
 	}{
 		{"a", http.StatusNoContent, []byte("")},
-		{"a", http.StatusNotFound, []byte(`{"reason":"topic already not exist"}`)},
+		{"a", http.StatusNotFound, []byte(`{"code":"not_found","reason":"topic already not exist"}`)},
 	}
 	for i, c := range cases {
 		client := dummyClient(t)
@@ -136,30 +204,227 @@ func TestDelete(t *testing.T) {
 	}
 }
 
-func TestListTopic(t *testing.T) {
+func TestPublishLimits(t *testing.T) {
 	ts := setupServer(t)
 	defer ts.Close()
 	setupDummyTopics(t, ts)
+	setLimits(&LimitsConfig{
+		MaxRequestBytes:        512,
+		MaxMessageBytes:        8,
+		MaxAttributes:          1,
+		MaxAttributeKeyBytes:   4,
+		MaxAttributeValueBytes: 4,
+		MaxPublishMessages:     2,
+	})
+	defer setLimits(nil)
 
-	client := dummyClient(t)
-	req, err := http.NewRequest("GET", ts.URL+"/topic/", nil)
+	msg := func(data string, attr map[string]string) PublishData {
+		return PublishData{Data: []byte(data), Attr: attr}
+	}
+	cases := []struct {
+		input        []PublishData
+		expectStatus int
+		expectCode   string
+		expectIndex  []int
+	}{
+		{[]PublishData{msg("ok", map[string]string{"key": "val"})}, http.StatusOK, "", nil},
+		{[]PublishData{msg("ok", nil), msg("too large data", nil)}, http.StatusOK, CodeLimitExceeded, []int{1}},
+		{[]PublishData{msg("a", map[string]string{"a": "1", "b": "2"}), msg("b", map[string]string{"long key": "1"})}, http.StatusBadRequest, CodeLimitExceeded, []int{0, 1}},
+		{[]PublishData{msg("a", map[string]string{"a": "long value"})}, http.StatusBadRequest, CodeLimitExceeded, []int{0}},
+		{[]PublishData{msg("a", nil), msg("b", nil), msg("c", nil)}, http.StatusBadRequest, CodeLimitExceeded, nil},
+		{[]PublishData{msg(strings.Repeat("a", 512), nil)}, http.StatusRequestEntityTooLarge, CodeRequestTooLarge, nil},
+	}
+	for i, c := range cases {
+		b, err := json.Marshal(PublishDatas{Messages: c.input})
+		if err != nil {
+			t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+		}
+		res, err := dummyClient(t).Post(fmt.Sprintf("%s/topic/a/publish", ts.URL), "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectStatus {
+			t.Errorf("#%d: want %d, got %d", i, c.expectStatus, got)
+		}
+
+		// the rejected messages are in the results, or in the details when all of them are rejected
+		var (
+			code  string
+			index []int
+		)
+		if res.StatusCode == http.StatusOK {
+			var body ResponsePublish
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+			}
+			for j, r := range body.Results {
+				if len(r.Code) != 0 {
+					code = r.Code
+					index = append(index, j)
+				}
+			}
+		} else {
+			var body ErrorResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+			}
+			code = body.Code
+			for _, d := range body.Details {
+				index = append(index, d.Index)
+			}
+		}
+		if code != c.expectCode {
+			t.Errorf("#%d: want code %s, got %s", i, c.expectCode, code)
+		}
+		if !reflect.DeepEqual(index, c.expectIndex) {
+			t.Errorf("#%d: want details %v, got %v", i, c.expectIndex, index)
+		}
+	}
+
+	// the body without the content length is limited while reading
+	b, err := json.Marshal(PublishDatas{Messages: []PublishData{msg(strings.Repeat("a", 512), nil)}})
 	if err != nil {
-		t.Fatal("failed to create request")
+		t.Fatalf("failed to encode json, got err %v", err)
 	}
-	res, err := client.Do(req)
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/topic/a/publish", ts.URL), ioutil.NopCloser(bytes.NewReader(b)))
 	if err != nil {
-		t.Fatal("failed to send request")
+		t.Fatalf("failed to create request, got err %v", err)
+	}
+	res, err := dummyClient(t).Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request, got err %v", err)
 	}
 	defer res.Body.Close()
+	var body ErrorResponse
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response, got err %v", err)
+	}
+	if res.StatusCode != http.StatusRequestEntityTooLarge || body.Code != CodeRequestTooLarge {
+		t.Errorf("want %d %s, got %d %s", http.StatusRequestEntityTooLarge, CodeRequestTooLarge, res.StatusCode, body.Code)
+	}
 
-	var want interface{}
-	want = http.StatusOK
-	if got := res.StatusCode; got != want {
-		t.Errorf("want %d, got %d", want, got)
+	// the default request limit accepts the message data up to the limit encoded in base64
+	setLimits(nil)
+	sizes := []struct {
+		size         int
+		expectStatus int
+		expectCode   string
+	}{
+		{DefaultLimits.MaxMessageBytes, http.StatusOK, ""},
+		{DefaultLimits.MaxMessageBytes + 1, http.StatusBadRequest, CodeLimitExceeded},
 	}
-	want = []byte(`[{"name":"a"},{"name":"b"},{"name":"c"}]`)
-	if got, _ := ioutil.ReadAll(res.Body); !reflect.DeepEqual(got, want) {
-		t.Errorf("want %s, got %s", want, got)
+	for i, c := range sizes {
+		b, err := json.Marshal(PublishDatas{Messages: []PublishData{msg(strings.Repeat("a", c.size), nil)}})
+		if err != nil {
+			t.Fatalf("#%d: failed to encode json, got err %v", i, err)
+		}
+		res, err := dummyClient(t).Post(fmt.Sprintf("%s/topic/a/publish", ts.URL), "application/json", bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+		var body ErrorResponse
+		json.NewDecoder(res.Body).Decode(&body)
+		if res.StatusCode != c.expectStatus || body.Code != c.expectCode {
+			t.Errorf("#%d: want %d %s, got %d %s", i, c.expectStatus, c.expectCode, res.StatusCode, body.Code)
+		}
+	}
+}
+
+func TestDeleteWithSubscriptions(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopicAndSub(t, ts)
+	createDummySubscription(t, ts, ResourceSubscription{Name: "C", Topic: "b", AckTimeout: 10})
+
+	cases := []struct {
+		input       string
+		expectCode  int
+		sub         string
+		expectTopic string // empty is the deleted subscription
+	}{
+		{"a?cascade=x", http.StatusBadRequest, "A", "a"},
+		{"a", http.StatusNoContent, "A", models.DeletedTopic},
+		{"b?cascade=true", http.StatusNoContent, "C", ""},
+	}
+	for i, c := range cases {
+		client := dummyClient(t)
+		req, err := http.NewRequest("DELETE", ts.URL+"/topic/"+c.input, nil)
+		if err != nil {
+			t.Fatalf("#%d: failed to create request", i)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request", i)
+		}
+		defer res.Body.Close()
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+
+		res, err = client.Get(ts.URL + "/subscription/" + c.sub)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request", i)
+		}
+		defer res.Body.Close()
+		if len(c.expectTopic) == 0 {
+			if res.StatusCode != http.StatusNotFound {
+				t.Errorf("#%d: want deleted subscription, got status %d", i, res.StatusCode)
+			}
+			continue
+		}
+		var got ResourceSubscription
+		if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+			t.Fatalf("#%d: failed to decode response, got err %v", i, err)
+		}
+		if got.Topic != c.expectTopic {
+			t.Errorf("#%d: want topic %s, got %s", i, c.expectTopic, got.Topic)
+		}
+	}
+}
+
+func TestListTopic(t *testing.T) {
+	ts := setupServer(t)
+	defer ts.Close()
+	setupDummyTopics(t, ts)
+	createDummyTopicWithBody(t, ts, "d", `{"labels":{"env":"prod","team":"x"}}`)
+	createDummyTopicWithBody(t, ts, "e", `{"labels":{"env":"dev"}}`)
+
+	// page_token is base64 encoded last name of the previous page
+	cases := []struct {
+		query      string
+		expectCode int
+		expectBody []byte
+	}{
+		{"", http.StatusOK, []byte(`{"topics":[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d","labels":{"env":"prod","team":"x"}},{"name":"e","labels":{"env":"dev"}}]}`)},
+		{"label=env", http.StatusOK, []byte(`{"topics":[{"name":"d","labels":{"env":"prod","team":"x"}},{"name":"e","labels":{"env":"dev"}}]}`)},
+		{"label=env:prod&label=team", http.StatusOK, []byte(`{"topics":[{"name":"d","labels":{"env":"prod","team":"x"}}]}`)},
+		{"page_size=2", http.StatusOK, []byte(`{"topics":[{"name":"a"},{"name":"b"}],"next_page_token":"Yg"}`)},
+		{"page_size=2&page_token=Yg&prefix=c", http.StatusOK, []byte(`{"topics":[{"name":"c"}]}`)},
+		{"order_by=name%20desc&page_size=2&label=env", http.StatusOK, []byte(`{"topics":[{"name":"e","labels":{"env":"dev"}},{"name":"d","labels":{"env":"prod","team":"x"}}]}`)},
+		{"order_by=name%20desc&page_size=4", http.StatusOK, []byte(`{"topics":[{"name":"e","labels":{"env":"dev"}},{"name":"d","labels":{"env":"prod","team":"x"}},{"name":"c"},{"name":"b"}],"next_page_token":"Yg"}`)},
+		{"order_by=name%20desc&page_token=Yg", http.StatusOK, []byte(`{"topics":[{"name":"a"}]}`)},
+		{"prefix=b", http.StatusOK, []byte(`{"topics":[{"name":"b"}]}`)},
+		{"prefix=x", http.StatusOK, []byte(`{"topics":[]}`)},
+		{"page_size=0", http.StatusBadRequest, []byte(`{"code":"invalid_argument","reason":"invalid list parameter"}`)},
+		{"page_token=!", http.StatusBadRequest, []byte(`{"code":"invalid_argument","reason":"invalid list parameter"}`)},
+		{"order_by=created", http.StatusBadRequest, []byte(`{"code":"invalid_argument","reason":"invalid list parameter"}`)},
+	}
+	for i, c := range cases {
+		client := dummyClient(t)
+		res, err := client.Get(ts.URL + "/topic/?" + c.query)
+		if err != nil {
+			t.Fatalf("#%d: failed to send request, got err %v", i, err)
+		}
+		defer res.Body.Close()
+
+		if got := res.StatusCode; got != c.expectCode {
+			t.Errorf("#%d: want %d, got %d", i, c.expectCode, got)
+		}
+		if got, _ := ioutil.ReadAll(res.Body); !reflect.DeepEqual(got, c.expectBody) {
+			t.Errorf("#%d: want %s, got %s", i, c.expectBody, got)
+		}
 	}
 }
 
@@ -170,14 +435,17 @@ func TestListTopicSubscription(t *testing.T) {
 
 	cases := []struct {
 		input      string
+		query      string
 		expectCode int
 		expectBody []byte
 	}{
-		{"a", http.StatusOK, []byte(`{"subscriptions":["A","B"]}`)},
+		{"a", "", http.StatusOK, []byte(`{"subscriptions":["A","B"]}`)},
+		{"a", "page_size=1", http.StatusOK, []byte(`{"subscriptions":["A"],"next_page_token":"QQ"}`)},
+		{"a", "page_size=1&page_token=QQ", http.StatusOK, []byte(`{"subscriptions":["B"]}`)},
 	}
 	for i, c := range cases {
 		client := dummyClient(t)
-		req, err := http.NewRequest("GET", fmt.Sprintf("%s/topic/%s/subscriptions", ts.URL, c.input), nil)
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/topic/%s/subscriptions?%s", ts.URL, c.input, c.query), nil)
 		if err != nil {
 			t.Fatal("failed to create request")
 		}
@@ -218,7 +486,7 @@ func TestPublish(t *testing.T) {
 		},
 		{
 			"",
-			http.StatusNotFound,
+			http.StatusBadRequest,
 			0,
 		},
 	}
@@ -249,5 +517,8 @@ func TestPublish(t *testing.T) {
 		if got := len(msgs.MessageIDs); got != c.expectMsgCount {
 			t.Errorf("#%d: want %d, got %d, got json %v", i, c.expectCode, got, msgs)
 		}
+		if got := len(msgs.Results); got != c.expectMsgCount {
+			t.Errorf("#%d: want %d results, got %d", i, c.expectMsgCount, got)
+		}
 	}
 }
@@ -52,6 +52,13 @@ func getSubscriptionDetailKeys(id string) []string {
 		adapter.assembleMetricsKey(id, "created_at"),
 		adapter.assembleMetricsKey(id, "message_count"),
 		adapter.assembleMetricsKey(id, "current_messages"),
+		adapter.assembleMetricsKey(id, "push_consecutive_failures"),
+		adapter.assembleMetricsKey(id, "push_last_success_at"),
+		adapter.assembleMetricsKey(id, "push_last_error_at"),
+		adapter.assembleMetricsKey(id, "export_files"),
+		adapter.assembleMetricsKey(id, "export_bytes"),
+		adapter.assembleMetricsKey(id, "export_messages"),
+		adapter.assembleMetricsKey(id, "export_last_write_at"),
 	}
 }
 
@@ -134,6 +141,28 @@ func (t *SubscriptionAdapter) CurrentMessages(subID string, msgs []string) {
 	t.collect.Snapshot(t.assembleMetricsKey(subID, "current_messages"), msgs)
 }
 
+// PushHealth send metrics the push delivery state, the zero time is sent as 0
+func (t *SubscriptionAdapter) PushHealth(subID string, failures int, lastSuccess, lastError time.Time) {
+	t.collect.Gauge(t.assembleMetricsKey(subID, "push_consecutive_failures"), float64(failures))
+	t.collect.Gauge(t.assembleMetricsKey(subID, "push_last_success_at"), unixOrZero(lastSuccess))
+	t.collect.Gauge(t.assembleMetricsKey(subID, "push_last_error_at"), unixOrZero(lastError))
+}
+
+// ExportProgress send metrics the written files, bytes and messages of the export subscription
+func (t *SubscriptionAdapter) ExportProgress(subID string, files, bytes, messages int) {
+	t.collect.Add(t.assembleMetricsKey(subID, "export_files"), float64(files))
+	t.collect.Add(t.assembleMetricsKey(subID, "export_bytes"), float64(bytes))
+	t.collect.Add(t.assembleMetricsKey(subID, "export_messages"), float64(messages))
+	t.collect.Gauge(t.assembleMetricsKey(subID, "export_last_write_at"), float64(time.Now().Unix()))
+}
+
+func unixOrZero(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
 func prepareMetrics() {
 	// NOTE: premise that following metrics keys is Counter type
 	for _, key := range getSummaryKeys() {
@@ -153,6 +182,13 @@ func prepareDetailSubscriptionMetrics(id string) {
 	adapter := GetSubscriptionAdapter()
 	collector.Gauge(adapter.assembleMetricsKey(id, "created_at"), 0)
 	collector.Add(adapter.assembleMetricsKey(id, "message_count"), 0)
+	collector.Gauge(adapter.assembleMetricsKey(id, "push_consecutive_failures"), 0)
+	collector.Gauge(adapter.assembleMetricsKey(id, "push_last_success_at"), 0)
+	collector.Gauge(adapter.assembleMetricsKey(id, "push_last_error_at"), 0)
+	collector.Add(adapter.assembleMetricsKey(id, "export_files"), 0)
+	collector.Add(adapter.assembleMetricsKey(id, "export_bytes"), 0)
+	collector.Add(adapter.assembleMetricsKey(id, "export_messages"), 0)
+	collector.Gauge(adapter.assembleMetricsKey(id, "export_last_write_at"), 0)
 }
 
 // Summary returns summary of the all stats